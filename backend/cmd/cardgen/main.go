@@ -1,50 +1,241 @@
 package main
 
 import (
+	"crypto/aes"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"link/internal/config"
+	"link/internal/pkg/cardbatch"
 	"link/internal/pkg/cardtoken"
+	"link/internal/pkg/ndef"
+	"link/internal/pkg/qrcode"
+	"link/internal/pkg/sun"
+
+	"github.com/joho/godotenv"
 )
 
+// cardgen generates card pairs for an encoding run.
+//
+// Typical use:
+//
+//	cardgen -n 100 -batch B2026-10 -format ndef,csv,svg,batch -out ./run
+//
+// then write run/ndef/*.ndef to the cards, print run/qr/*.svg on the inserts and import
+// run/B2026-10.batch.json with POST /api/v1/admin/inventory/batches/import.
+// Secrets and the base URL are read from the same environment (.env) as the server. When SUN is
+// configured the chips get the /tap mirror template instead, and the token URL only goes on the QR.
 func main() {
-	baseURL := flag.String("url", "https://localhost:5173", "Base URL for the frontend")
-	secret := flag.String("secret", "default-card-token-secret-change-me", "Secret key for HMAC (use same as server)")
+	_ = godotenv.Load()
+	cfg := config.Load()
+
+	baseURL := flag.String("url", cfg.BaseURL, "Base URL written to the cards (same as server BASE_URL)")
+	secret := flag.String("secret", cfg.CardTokenSecret, "Secret key for HMAC (same as server CARD_TOKEN_SECRET)")
+	keys := flag.String("keys", cfg.CardTokenKeys, "v2 token keys \"kid:secret,...\" (same as server CARD_TOKEN_KEYS)")
+	kid := flag.String("kid", cfg.CardTokenKeyID, "Key ID that signs the new cards; issues legacy tokens if empty")
+	useSUN := flag.Bool("sun", cfg.SUNMetaKey != "", "Write the SUN /tap template to the chips (default when SUN_META_KEY is set)")
 	count := flag.Int("n", 1, "Number of pairs to generate")
+	batchID := flag.String("batch", "B"+time.Now().Format("20060102-150405"), "Batch ID, prefixes the serial numbers")
+	formats := flag.String("format", "text", "Comma-separated outputs: text, ndef, csv, json, svg, batch")
+	outDir := flag.String("out", ".", "Directory for file outputs")
 	flag.Parse()
 
 	gen := cardtoken.NewGenerator(*secret)
+	if *kid != "" {
+		keyMap, err := cardtoken.ParseKeys(*keys)
+		if err != nil {
+			fail("invalid -keys: %v", err)
+		}
+		gen, err = cardtoken.NewKeyedGenerator(*secret, keyMap, *kid)
+		if err != nil {
+			fail("invalid -kid: %v", err)
+		}
+	}
+	if !cardbatch.ValidBatchID(*batchID) {
+		fail("invalid -batch: use up to 24 letters, digits, '-' or '_'")
+	}
 
-	fmt.Println("=== LINK 卡片產生器 ===")
-	fmt.Printf("Base URL: %s\n", *baseURL)
-	fmt.Println()
-
+	batch := &cardbatch.Batch{
+		Version:   cardbatch.Version,
+		BatchID:   *batchID,
+		CreatedAt: time.Now().UTC(),
+	}
 	for i := 0; i < *count; i++ {
 		primary, backup, err := gen.GeneratePair()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating pair: %v\n", err)
-			os.Exit(1)
+			fail("generating pair: %v", err)
 		}
+		batch.Pairs = append(batch.Pairs, cardbatch.Pair{
+			SerialNumber: cardbatch.SerialNumber(*batchID, i),
+			PrimaryToken: primary,
+			BackupToken:  backup,
+		})
+	}
+
+	chipURL := ""
+	if *useSUN {
+		chipURL = sunTemplateURL(*baseURL)
+	}
 
-		if *count > 1 {
-			fmt.Printf("--- Pair %d ---\n", i+1)
+	for _, format := range strings.Split(*formats, ",") {
+		var err error
+		switch strings.TrimSpace(format) {
+		case "text":
+			printText(batch, *baseURL, chipURL)
+		case "ndef":
+			err = writeNDEF(batch, *baseURL, chipURL, filepath.Join(*outDir, "ndef"))
+		case "svg":
+			err = writeQR(batch, *baseURL, filepath.Join(*outDir, "qr"))
+		case "csv":
+			err = writeCSV(batch, *baseURL, filepath.Join(*outDir, *batchID+".csv"))
+		case "json":
+			err = writeManifest(batch, *baseURL, filepath.Join(*outDir, *batchID+".json"))
+		case "batch":
+			err = writeBatch(batch, *secret, filepath.Join(*outDir, *batchID+".batch.json"))
+		default:
+			fail("unknown format %q", format)
 		}
+		if err != nil {
+			fail("writing %s: %v", format, err)
+		}
+	}
+}
 
-		fmt.Println("主卡 (Primary):")
-		fmt.Printf("  Token: %s\n", primary)
-		fmt.Printf("  URL:   %s/register/start?token=%s\n", *baseURL, primary)
-		fmt.Println()
+// card is one physical card of the batch, labelled A/B like the admin page
+type card struct {
+	SerialNumber string `json:"serial_number"`
+	Card         string `json:"card"`
+	Token        string `json:"token"`
+	URL          string `json:"url"`
+}
 
-		fmt.Println("副卡 (Backup):")
-		fmt.Printf("  Token: %s\n", backup)
-		fmt.Printf("  URL:   %s/register/start?token=%s\n", *baseURL, backup)
-		fmt.Println()
+func cards(batch *cardbatch.Batch, baseURL string) []card {
+	var out []card
+	for _, p := range batch.Pairs {
+		out = append(out,
+			card{p.SerialNumber, "A", p.PrimaryToken, cardbatch.CardURL(baseURL, p.PrimaryToken)},
+			card{p.SerialNumber, "B", p.BackupToken, cardbatch.CardURL(baseURL, p.BackupToken)},
+		)
+	}
+	return out
+}
+
+// sunTemplateURL is the NDEF URL for NTAG 424 DNA chips. The zeros are placeholders the chip
+// overwrites on every tap, so the SDM mirror offsets must point at them when encoding.
+func sunTemplateURL(baseURL string) string {
+	return fmt.Sprintf("%s/tap?picc_data=%s&cmac=%s", strings.TrimRight(baseURL, "/"),
+		strings.Repeat("0", 2*aes.BlockSize), strings.Repeat("0", 2*sun.MACLength))
+}
+
+func printText(batch *cardbatch.Batch, baseURL, chipURL string) {
+	fmt.Println("=== LINK 卡片產生器 ===")
+	fmt.Printf("Base URL: %s\n", baseURL)
+	fmt.Printf("Batch:    %s\n", batch.BatchID)
+	if chipURL != "" {
+		fmt.Printf("SUN URL:  %s\n", chipURL)
+	}
+	fmt.Println()
 
-		if *count > 1 {
-			fmt.Println()
+	for _, c := range cards(batch, baseURL) {
+		if c.Card == "A" {
+			fmt.Printf("--- %s ---\n", c.SerialNumber)
 		}
+		fmt.Printf("卡片 %s:\n", c.Card)
+		fmt.Printf("  Token: %s\n", c.Token)
+		fmt.Printf("  URL:   %s\n", c.URL)
+		fmt.Println()
 	}
 
+	if chipURL != "" {
+		fmt.Println("將 SUN URL 寫入 NTAG 424 DNA 卡片並設定 SDM 鏡像，再以 POST /api/v1/admin/cards/tags 綁定 UID 與 token")
+		return
+	}
 	fmt.Println("將以上 URL 寫入 NFC 卡片的 NDEF 記錄即可使用")
 }
+
+// writeNDEF writes one raw NDEF message per card, named {serial}-{A|B}.ndef. With SUN every
+// chip holds the same template, since the card is identified by its UID rather than the URL.
+func writeNDEF(batch *cardbatch.Batch, baseURL, chipURL, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, c := range cards(batch, baseURL) {
+		name := filepath.Join(dir, c.SerialNumber+"-"+c.Card+".ndef")
+		url := c.URL
+		if chipURL != "" {
+			url = chipURL
+		}
+		if err := os.WriteFile(name, ndef.URIRecord(url), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQR writes one SVG QR code per card for the printed inserts
+func writeQR(batch *cardbatch.Batch, baseURL, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, c := range cards(batch, baseURL) {
+		code, err := qrcode.Encode([]byte(c.URL), qrcode.Medium)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, c.SerialNumber+"-"+c.Card+".svg")
+		if err := os.WriteFile(name, code.SVG(8), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(batch *cardbatch.Batch, baseURL, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"serial_number", "card", "token", "url"})
+	for _, c := range cards(batch, baseURL) {
+		_ = w.Write([]string{c.SerialNumber, c.Card, c.Token, c.URL})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeManifest(batch *cardbatch.Batch, baseURL, path string) error {
+	data, err := json.MarshalIndent(struct {
+		BatchID   string    `json:"batch_id"`
+		CreatedAt time.Time `json:"created_at"`
+		BaseURL   string    `json:"base_url"`
+		Cards     []card    `json:"cards"`
+	}{batch.BatchID, batch.CreatedAt, baseURL, cards(batch, baseURL)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// writeBatch writes the signed file the server imports into its card inventory
+func writeBatch(batch *cardbatch.Batch, secret, path string) error {
+	data, err := cardbatch.Sign(batch, secret)
+	if err != nil {
+		return err
+	}
+	// Holds live card tokens, so keep it private
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "cardgen: "+format+"\n", args...)
+	os.Exit(1)
+}
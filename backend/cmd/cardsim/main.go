@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"link/internal/pkg/sun"
+)
+
+// cardsim emulates an NTAG 424 DNA card so the /tap flow can be exercised without hardware.
+//
+// Typical use:
+//
+//	cardsim -uid 04DE5F1EACC040 -n 3 -state .cardsim.json
+//
+// then bind the UID to a card token with POST /api/v1/admin/cards/tags and open the printed URLs.
+func main() {
+	baseURL := flag.String("url", getEnv("BACKEND_URL", "https://localhost:8443"), "Base URL of the backend serving /tap")
+	uidHex := flag.String("uid", "", "Card UID (14 hex chars); random if empty")
+	metaKey := flag.String("meta-key", getEnv("SUN_META_KEY", ""), "SDMMetaReadKey (hex, same as server)")
+	masterKeys := flag.String("master-keys", getEnv("SUN_MASTER_KEYS", ""), "Master keys \"1:hex,2:hex\" (same as server)")
+	systemID := flag.String("system-id", getEnv("SUN_SYSTEM_ID", "LINK"), "Diversification system identifier (same as server)")
+	keyVersion := flag.Int("key-version", 0, "Master key version to diversify with; newest if 0")
+	cardKey := flag.String("key", "", "Card SDMFileReadKey (hex); overrides diversification")
+	counter := flag.Uint("counter", 0, "Read counter before the first tap")
+	count := flag.Int("n", 1, "Number of taps to emulate")
+	statePath := flag.String("state", "", "JSON file remembering the counter per UID between runs")
+	flag.Parse()
+
+	uid, err := parseUID(*uidHex)
+	if err != nil {
+		fail("invalid uid: %v", err)
+	}
+
+	meta, err := hex.DecodeString(*metaKey)
+	if err != nil || len(meta) != sun.KeyLength {
+		fail("-meta-key must be %d hex chars", sun.KeyLength*2)
+	}
+
+	fileKey, version, err := resolveCardKey(uid, *cardKey, *masterKeys, *systemID, *keyVersion)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	uidStr := strings.ToUpper(hex.EncodeToString(uid))
+	state := loadState(*statePath)
+	if c, ok := state[uidStr]; ok && uint(c) > *counter {
+		*counter = uint(c)
+	}
+
+	card := &sun.Emulator{UID: uid, MetaKey: meta, FileKey: fileKey, Counter: uint32(*counter)}
+
+	fmt.Println("=== LINK NTAG 424 DNA 模擬器 ===")
+	fmt.Printf("UID:         %s\n", uidStr)
+	if version > 0 {
+		fmt.Printf("Key version: %d\n", version)
+	}
+	fmt.Printf("Card key:    %s\n", strings.ToUpper(hex.EncodeToString(fileKey)))
+	fmt.Println()
+
+	for i := 0; i < *count; i++ {
+		piccData, cmac, err := card.Tap()
+		if err != nil {
+			fail("tap failed: %v", err)
+		}
+		fmt.Printf("[%d] %s/tap?picc_data=%s&cmac=%s\n", card.Counter, *baseURL, piccData, cmac)
+	}
+
+	state[uidStr] = card.Counter
+	if err := saveState(*statePath, state); err != nil {
+		fail("failed to save state: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Println("首次使用前請以 POST /api/v1/admin/cards/tags 綁定 UID 與卡片 token")
+}
+
+func parseUID(s string) ([]byte, error) {
+	if s == "" {
+		// NXP UIDs start with the manufacturer byte 0x04
+		uid := make([]byte, sun.UIDLength)
+		if _, err := rand.Read(uid[1:]); err != nil {
+			return nil, err
+		}
+		uid[0] = 0x04
+		return uid, nil
+	}
+	uid, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(uid) != sun.UIDLength {
+		return nil, fmt.Errorf("expected %d bytes, got %d", sun.UIDLength, len(uid))
+	}
+	return uid, nil
+}
+
+func resolveCardKey(uid []byte, cardKey, masterKeys, systemID string, keyVersion int) ([]byte, int, error) {
+	if cardKey != "" {
+		key, err := hex.DecodeString(cardKey)
+		if err != nil || len(key) != sun.KeyLength {
+			return nil, 0, fmt.Errorf("-key must be %d hex chars", sun.KeyLength*2)
+		}
+		return key, 0, nil
+	}
+
+	keys, err := sun.ParseMasterKeys(masterKeys)
+	if err != nil {
+		return nil, 0, fmt.Errorf("-master-keys or -key is required: %v", err)
+	}
+
+	// The verifier needs a meta key, but only its key derivation is used here
+	v, err := sun.NewVerifier(strings.Repeat("00", sun.KeyLength), keys, systemID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if keyVersion == 0 {
+		keyVersion = v.KeyVersion()
+	}
+	key, err := v.CardKey(uid, keyVersion)
+	if err != nil {
+		return nil, 0, err
+	}
+	return key, keyVersion, nil
+}
+
+func loadState(path string) map[string]uint32 {
+	state := make(map[string]uint32)
+	if path == "" {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	_ = json.Unmarshal(data, &state)
+	return state
+}
+
+func saveState(path string, state map[string]uint32) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
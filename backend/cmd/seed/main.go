@@ -2,64 +2,17 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
 	"log"
 	"os"
-	"runtime"
 	"time"
 
+	"link/internal/config"
+	"link/internal/pkg/password"
+
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/argon2"
 )
 
-// Argon2id params (matching backend/internal/pkg/password/argon2.go)
-type Params struct {
-	Memory      uint32
-	Iterations  uint32
-	Parallelism uint8
-	SaltLength  uint32
-	KeyLength   uint32
-}
-
-func defaultParams() *Params {
-	return &Params{
-		Memory:      64 * 1024, // 64 MB
-		Iterations:  3,
-		Parallelism: uint8(runtime.NumCPU()),
-		SaltLength:  16,
-		KeyLength:   32,
-	}
-}
-
-func hashPassword(password string) (string, error) {
-	params := defaultParams()
-	salt := make([]byte, params.SaltLength)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
-	}
-
-	hash := argon2.IDKey(
-		[]byte(password),
-		salt,
-		params.Iterations,
-		params.Memory,
-		params.Parallelism,
-		params.KeyLength,
-	)
-
-	return fmt.Sprintf(
-		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
-		argon2.Version,
-		params.Memory,
-		params.Iterations,
-		params.Parallelism,
-		base64.RawStdEncoding.EncodeToString(salt),
-		base64.RawStdEncoding.EncodeToString(hash),
-	), nil
-}
-
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -92,6 +45,11 @@ func main() {
 
 	createDemoUser := demoPrimaryToken != "" && demoBackupToken != ""
 
+	// Hash with the server's Argon2 settings, so seeded passwords aren't rehashed on first login
+	if err := password.SetParams(config.LoadPasswordParams()); err != nil {
+		log.Fatalf("invalid ARGON2 settings: %v", err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -127,7 +85,7 @@ func main() {
 
 	// Create service user (小安)
 	log.Printf("Creating service user: %s", serviceNickname)
-	serviceHash, err := hashPassword(servicePassword)
+	serviceHash, err := password.Hash(servicePassword)
 	if err != nil {
 		log.Fatalf("Failed to hash service password: %v", err)
 	}
@@ -143,11 +101,11 @@ func main() {
 	}
 	log.Printf("Created service user: %s (ID: %s)", serviceNickname, serviceUserID)
 
-	// Create card pair for service user
+	// Create card pair for service user, already consumed by its registration
 	_, err = tx.Exec(ctx, `
-		INSERT INTO card_pairs (primary_token, backup_token, expires_at)
-		VALUES ($1, $2, NOW() + INTERVAL '365 days')
-	`, servicePrimaryToken, serviceBackupToken)
+		INSERT INTO card_pairs (primary_token, backup_token, status, issued_at, expires_at, registered_at, registered_by)
+		VALUES ($1, $2, 'registered', NOW(), NOW() + INTERVAL '365 days', NOW(), $3)
+	`, servicePrimaryToken, serviceBackupToken, serviceUserID)
 	if err != nil {
 		log.Fatalf("Failed to create service card pair: %v", err)
 	}
@@ -177,8 +135,8 @@ func main() {
 		// Only create card_pair - no user, no cards
 		// User will register by scanning the NFC card
 		_, err = tx.Exec(ctx, `
-			INSERT INTO card_pairs (primary_token, backup_token, expires_at)
-			VALUES ($1, $2, NOW() + INTERVAL '365 days')
+			INSERT INTO card_pairs (primary_token, backup_token, issued_at, expires_at)
+			VALUES ($1, $2, NOW(), NOW() + INTERVAL '365 days')
 		`, demoPrimaryToken, demoBackupToken)
 		if err != nil {
 			log.Fatalf("Failed to create demo card pair: %v", err)
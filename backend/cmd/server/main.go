@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,7 +15,10 @@ import (
 	"link/internal/handler"
 	"link/internal/middleware"
 	"link/internal/pkg/cardtoken"
+	"link/internal/pkg/password"
+	"link/internal/pkg/sun"
 	"link/internal/pkg/token"
+	"link/internal/pkg/webauthn"
 	"link/internal/repository/postgres"
 	"link/internal/service"
 	"link/internal/transport"
@@ -45,34 +49,113 @@ func main() {
 	}
 	defer pool.Close()
 
+	if err := password.SetParams(cfg.PasswordParams); err != nil {
+		log.Fatalf("invalid ARGON2 settings: %v", err)
+	}
+
 	tokenMgr := token.NewManager(cfg.JWTSecret, cfg.JWTExpiry)
+	if cfg.JWTKeyID != "" {
+		keys, err := token.LoadKeys(cfg.JWTKeys)
+		if err != nil {
+			log.Fatalf("invalid JWT_KEYS: %v", err)
+		}
+		tokenMgr, err = token.NewKeyedManager(cfg.JWTSecret, keys, cfg.JWTKeyID, cfg.JWTExpiry)
+		if err != nil {
+			log.Fatalf("invalid JWT_KEY_ID: %v", err)
+		}
+	}
 	cardTokenGen := cardtoken.NewGenerator(cfg.CardTokenSecret)
+	if cfg.CardTokenKeyID != "" {
+		keys, err := cardtoken.ParseKeys(cfg.CardTokenKeys)
+		if err != nil {
+			log.Fatalf("invalid CARD_TOKEN_KEYS: %v", err)
+		}
+		cardTokenGen, err = cardtoken.NewKeyedGenerator(cfg.CardTokenSecret, keys, cfg.CardTokenKeyID)
+		if err != nil {
+			log.Fatalf("invalid card token keys: %v", err)
+		}
+	}
+
+	var sunVerifier *sun.Verifier
+	if cfg.SUNMetaKey != "" {
+		masterKeys, err := sun.ParseMasterKeys(cfg.SUNMasterKeys)
+		if err != nil {
+			log.Fatalf("invalid SUN master keys: %v", err)
+		}
+		sunVerifier, err = sun.NewVerifier(cfg.SUNMetaKey, masterKeys, cfg.SUNSystemID)
+		if err != nil {
+			log.Fatalf("invalid SUN keys: %v", err)
+		}
+	}
+
+	// Passkeys are scoped to the frontend's origin, which is where the cards send users
+	var passkeyRP *webauthn.RelyingParty
+	if cfg.PasskeyLogin {
+		origin, err := url.Parse(cfg.BaseURL)
+		if err != nil || origin.Host == "" {
+			log.Fatalf("invalid BASE_URL for passkeys: %q", cfg.BaseURL)
+		}
+		rpID := cfg.WebAuthnRPID
+		if rpID == "" {
+			rpID = origin.Hostname()
+		}
+		passkeyRP = webauthn.NewRelyingParty(rpID, "LINK", origin.Scheme+"://"+origin.Host)
+	}
 
 	userRepo := postgres.NewUserRepository(pool)
 	cardRepo := postgres.NewCardRepository(pool)
 	sessionRepo := postgres.NewSessionRepository(pool)
+	refreshRepo := postgres.NewRefreshTokenRepository(pool)
+	attemptRepo := postgres.NewLoginAttemptRepository(pool)
 	friendRepo := postgres.NewFriendshipRepository(pool)
 	convRepo := postgres.NewConversationRepository(pool)
 	msgRepo := postgres.NewMessageRepository(pool)
+	adminRepo := postgres.NewAdminRepository(pool)
+	adminSessionRepo := postgres.NewAdminSessionRepository(pool)
+	auditRepo := postgres.NewAuditLogRepository(pool)
+	passkeyRepo := postgres.NewPasskeyRepository(pool)
+	uow := postgres.NewUnitOfWork(pool)
 
-	userSvc := service.NewUserService(userRepo)
-	cardSvc := service.NewCardService(cardRepo, sessionRepo, cardTokenGen)
-	authSvc := service.NewAuthService(userRepo, cardRepo, sessionRepo, friendRepo, tokenMgr, cardTokenGen, cfg.ServiceUserID)
+	hub := transport.NewHub()
+
+	sessionSvc := service.NewSessionService(sessionRepo, refreshRepo, userRepo, uow, tokenMgr, hub, cfg.RefreshExpiry)
+	userSvc := service.NewUserService(userRepo, cardRepo, sessionSvc, uow)
+	cardSvc := service.NewCardService(cardRepo, sessionSvc, uow, cardTokenGen, sunVerifier, cfg.CardTokenSecret)
+	passkeySvc := service.NewPasskeyService(passkeyRepo, userRepo, passkeyRP)
+	authSvc := service.NewAuthService(userRepo, cardRepo, friendRepo, attemptRepo, uow, sessionSvc, cardSvc, passkeySvc, hub, cardTokenGen, cfg.ServiceUserID, cfg.DeletionGrace, cfg.FreezeWindow)
 	friendSvc := service.NewFriendshipService(friendRepo, userRepo)
 	convSvc := service.NewConversationService(convRepo)
-	msgSvc := service.NewMessageService(msgRepo, convRepo)
+	msgSvc := service.NewMessageService(msgRepo, convRepo, friendRepo)
+	exportSvc := service.NewExportService(userRepo, cardRepo, passkeyRepo, friendRepo, convRepo, msgRepo)
+	adminSvc := service.NewAdminService(adminRepo, adminSessionRepo, auditRepo, cfg.AdminSessionTTL, cfg.AdminTOTP)
+
+	if cfg.AdminPassword != "" {
+		created, err := adminSvc.Bootstrap(ctx, cfg.AdminUsername, cfg.AdminPassword)
+		if err != nil {
+			log.Fatalf("failed to create initial admin: %v", err)
+		}
+		if created {
+			slog.Info("created initial superadmin, enroll TOTP and unset ADMIN_PASSWORD", "username", cfg.AdminUsername)
+		}
+	}
 
-	hub := transport.NewHub()
 	transportHandler := transport.NewHandler(hub, msgSvc, convSvc)
 
 	// Set up online/offline notifications
-	hub.SetOnConnect(func(userID string) {
-		friends, err := friendRepo.FindFriends(context.Background(), userID)
+	hub.SetOnConnect(func(c transport.Client) {
+		// Messages that arrived while offline go out before anything else is looked up
+		transportHandler.FlushUndelivered(context.Background(), c)
+
+		friends, err := friendRepo.FindFriends(context.Background(), c.GetUserID())
 		if err != nil {
-			slog.Error("failed to get friends for online notification", "user_id", userID, "error", err)
+			slog.Error("failed to get friends for online notification", "user_id", c.GetUserID(), "error", err)
 			return
 		}
-		transportHandler.NotifyOnline(userID, friends)
+		transportHandler.NotifyOnline(c.GetUserID(), friends)
+	})
+	hub.SetOnUnregister(transportHandler.Forget)
+	hub.SetSessionCheck(func(sessionID string) error {
+		return sessionSvc.CheckSession(context.Background(), sessionID)
 	})
 	hub.SetOnDisconnect(func(userID string) {
 		friends, err := friendRepo.FindFriends(context.Background(), userID)
@@ -84,12 +167,14 @@ func main() {
 	})
 
 	go hub.Run()
+	go purgeDeletedAccounts(userSvc)
 
-	authHandler := handler.NewAuthHandler(authSvc, cardSvc, cfg.BaseURL)
-	userHandler := handler.NewUserHandler(userSvc, cardSvc)
+	authHandler := handler.NewAuthHandler(authSvc, cardSvc, passkeySvc, cfg.BaseURL)
+	userHandler := handler.NewUserHandler(userSvc, authSvc, cardSvc, passkeySvc, sessionSvc, exportSvc)
 	friendHandler := handler.NewFriendHandler(friendSvc)
-	convHandler := handler.NewConversationHandler(convSvc, msgSvc, hub)
-	adminHandler := handler.NewAdminHandler(cardTokenGen, cfg.AdminPassword, cfg.BaseURL, pool)
+	convHandler := handler.NewConversationHandler(convSvc, msgSvc, hub, transportHandler)
+	adminHandler := handler.NewAdminHandler(cardSvc, adminSvc, userSvc, sessionSvc, hub, cfg.BaseURL)
+	keysHandler := handler.NewKeysHandler(tokenMgr)
 
 	handlers := &handler.Handlers{
 		Auth:   authHandler,
@@ -97,6 +182,7 @@ func main() {
 		Friend: friendHandler,
 		Conv:   convHandler,
 		Admin:  adminHandler,
+		Keys:   keysHandler,
 	}
 
 	app := fiber.New(fiber.Config{
@@ -111,14 +197,14 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.CORSOrigins,
 		AllowMethods:     "GET,POST,PATCH,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Admin-Password",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Admin-Token",
 		AllowCredentials: true,
 	}))
 
-	authMw := middleware.Auth(tokenMgr)
+	authMw := middleware.Auth(sessionSvc)
 	handler.Setup(app, handlers, authMw)
 
-	wsServer := transport.NewServer(hub, transportHandler, tokenMgr)
+	wsServer := transport.NewServer(hub, transportHandler, sessionSvc)
 	wsServer.SetupRoutes(app)
 
 	go func() {
@@ -144,3 +230,19 @@ func main() {
 		slog.Error("server shutdown error", "err", err)
 	}
 }
+
+// purgeDeletedAccounts hard-deletes accounts whose deletion grace period has passed, once an hour
+func purgeDeletedAccounts(userSvc *service.UserService) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		n, err := userSvc.PurgeDeletedAccounts(context.Background())
+		if err != nil {
+			slog.Error("failed to purge deleted accounts", "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.Info("purged deleted accounts", "count", n)
+		}
+	}
+}
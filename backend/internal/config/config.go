@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"time"
+
+	"link/internal/pkg/password"
 )
 
 type Config struct {
@@ -10,15 +13,33 @@ type Config struct {
 	ServerEnv       string
 	DatabaseURL     string
 	JWTSecret       string
-	JWTExpiry       time.Duration
-	CardTokenSecret string
+	JWTExpiry       time.Duration // access token 效期
+	RefreshExpiry   time.Duration // refresh token 效期，每次使用後順延
+	JWTKeys         string        // JWT 金鑰環，格式 "kid:hs256:secret,kid:file:/path/key.pem"
+	JWTKeyID        string        // 用來簽發 access token 的金鑰 ID，未設定則以 JWT_SECRET 簽發
+	CardTokenSecret string        // 驗證舊版 (v1) 卡片 token
+	CardTokenKeys   string        // v2 卡片 token 金鑰，格式 "kid:secret,kid:secret"
+	CardTokenKeyID  string        // 用來簽發新卡片的金鑰 ID，未設定則簽發 v1 token
 	TLSCert         string
 	TLSKey          string
 	CORSOrigins     string
 	LogLevel        string
-	AdminPassword   string
+	AdminPassword   string        // 僅用於建立第一個超級管理員，已有管理員帳號時忽略
+	AdminUsername   string        // 第一個超級管理員的帳號
+	AdminSessionTTL time.Duration // 管理員登入效期，閒置 30 分鐘亦會失效
+	AdminTOTP       bool          // 管理員須啟用兩步驟驗證才能操作
 	BaseURL         string
-	ServiceUserID   string // 小安服務帳號 ID，新用戶自動加為好友
+	ServiceUserID   string        // 小安服務帳號 ID，新用戶自動加為好友
+	DeletionGrace   time.Duration // 申請刪除帳號後、實際刪除前的保留期間，期間內重新登入即取消
+	FreezeWindow    time.Duration // 以副卡凍結帳號後，可用主卡解除凍結的期間
+	SUNMetaKey      string        // NTAG 424 DNA SDMMetaReadKey (hex)，未設定則停用 /tap
+	SUNMasterKeys   string        // 卡片金鑰分散用的主金鑰，格式 "1:hex,2:hex"
+	SUNSystemID     string        // AN10922 分散輸入中的系統識別碼
+	PasskeyLogin    bool          // 允許以通行金鑰 + 密碼取代主卡登入
+	WebAuthnRPID    string        // 通行金鑰綁定的網域，未設定則取 BASE_URL 的主機名稱
+
+	// Argon2id 密碼雜湊參數，調整後既有密碼會在下次登入時以新參數重新雜湊
+	PasswordParams *password.Params
 }
 
 func Load() *Config {
@@ -32,27 +53,64 @@ func Load() *Config {
 		panic("CARD_TOKEN_SECRET is required")
 	}
 
-	adminPassword := getEnv("ADMIN_PASSWORD", "")
-	if adminPassword == "" {
-		panic("ADMIN_PASSWORD is required")
-	}
-
-	expiry, _ := time.ParseDuration(getEnv("JWT_EXPIRY", "24h"))
+	expiry, _ := time.ParseDuration(getEnv("JWT_EXPIRY", "15m"))
+	refreshExpiry, _ := time.ParseDuration(getEnv("REFRESH_TOKEN_EXPIRY", "720h"))
+	adminSessionTTL, _ := time.ParseDuration(getEnv("ADMIN_SESSION_EXPIRY", "8h"))
+	deletionGrace, _ := time.ParseDuration(getEnv("ACCOUNT_DELETION_GRACE", "720h"))
+	freezeWindow, _ := time.ParseDuration(getEnv("ACCOUNT_FREEZE_WINDOW", "168h"))
 	return &Config{
 		ServerAddr:      getEnv("SERVER_ADDR", ":8443"),
 		ServerEnv:       getEnv("SERVER_ENV", "development"),
 		DatabaseURL:     getEnv("DATABASE_URL", ""),
 		JWTSecret:       secret,
 		JWTExpiry:       expiry,
+		RefreshExpiry:   refreshExpiry,
+		JWTKeys:         getEnv("JWT_KEYS", ""),
+		JWTKeyID:        getEnv("JWT_KEY_ID", ""),
 		CardTokenSecret: cardSecret,
+		CardTokenKeys:   getEnv("CARD_TOKEN_KEYS", ""),
+		CardTokenKeyID:  getEnv("CARD_TOKEN_KEY_ID", ""),
 		TLSCert:         getEnv("TLS_CERT_FILE", "../certs/localhost+2.pem"),
 		TLSKey:          getEnv("TLS_KEY_FILE", "../certs/localhost+2-key.pem"),
 		CORSOrigins:     getEnv("CORS_ORIGINS", "https://localhost:5173"),
 		LogLevel:        getEnv("LOG_LEVEL", "info"),
-		AdminPassword:   adminPassword,
+		AdminPassword:   getEnv("ADMIN_PASSWORD", ""),
+		AdminUsername:   getEnv("ADMIN_USERNAME", "admin"),
+		AdminSessionTTL: adminSessionTTL,
+		AdminTOTP:       getEnv("ADMIN_REQUIRE_TOTP", "true") != "false",
 		BaseURL:         getEnv("BASE_URL", "https://localhost:5173"),
 		ServiceUserID:   getEnv("SERVICE_USER_ID", ""), // 可選，設定後新用戶自動加好友
+		DeletionGrace:   deletionGrace,
+		FreezeWindow:    freezeWindow,
+		SUNMetaKey:      getEnv("SUN_META_KEY", ""),
+		SUNMasterKeys:   getEnv("SUN_MASTER_KEYS", ""),
+		SUNSystemID:     getEnv("SUN_SYSTEM_ID", "LINK"),
+		PasskeyLogin:    getEnv("PASSKEY_LOGIN", "true") != "false",
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		PasswordParams:  LoadPasswordParams(),
+	}
+}
+
+// LoadPasswordParams reads the ARGON2_* settings over the password package defaults. Load includes
+// them; tools that hash passwords without the rest of the server config, like seed, call it directly.
+func LoadPasswordParams() *password.Params {
+	p := password.DefaultParams()
+	p.Memory = uint32(getEnvUint("ARGON2_MEMORY", uint64(p.Memory), 32))
+	p.Iterations = uint32(getEnvUint("ARGON2_ITERATIONS", uint64(p.Iterations), 32))
+	p.Parallelism = uint8(getEnvUint("ARGON2_PARALLELISM", uint64(p.Parallelism), 8))
+	return p
+}
+
+func getEnvUint(key string, fallback uint64, bits int) uint64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseUint(v, 10, bits)
+	if err != nil {
+		panic(key + " must be a non-negative integer")
 	}
+	return n
 }
 
 func getEnv(key, fallback string) string {
@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type AdminRole string
+
+const (
+	AdminRoleCardOperator AdminRole = "card_operator"
+	AdminRoleSupport      AdminRole = "support"
+	AdminRoleSuperadmin   AdminRole = "superadmin"
+)
+
+type AdminPermission string
+
+const (
+	AdminPermCardsRead    AdminPermission = "cards:read"
+	AdminPermCardsWrite   AdminPermission = "cards:write"
+	AdminPermUsersRead    AdminPermission = "users:read"
+	AdminPermUsersWrite   AdminPermission = "users:write"
+	AdminPermAdminsManage AdminPermission = "admins:manage"
+	AdminPermAuditRead    AdminPermission = "audit:read"
+)
+
+// Superadmins hold every permission and are not listed here
+var adminRolePermissions = map[AdminRole][]AdminPermission{
+	AdminRoleCardOperator: {AdminPermCardsRead, AdminPermCardsWrite},
+	AdminRoleSupport:      {AdminPermCardsRead, AdminPermUsersRead, AdminPermUsersWrite},
+}
+
+func (r AdminRole) Valid() bool {
+	switch r {
+	case AdminRoleCardOperator, AdminRoleSupport, AdminRoleSuperadmin:
+		return true
+	}
+	return false
+}
+
+func (r AdminRole) Can(p AdminPermission) bool {
+	if r == AdminRoleSuperadmin {
+		return true
+	}
+	for _, allowed := range adminRolePermissions[r] {
+		if allowed == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminUser is a back-office account, separate from chat users. Admins are disabled rather than
+// deleted so the audit log keeps its actors.
+type AdminUser struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	Role         AdminRole  `json:"role"`
+	TOTPSecret   *string    `json:"-"`
+	TOTPEnabled  bool       `json:"totp_enabled"`
+	TOTPLastStep int64      `json:"-"` // last accepted TOTP time step, a code is never accepted twice
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type AdminSession struct {
+	ID         string
+	AdminID    string
+	TokenHash  string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// AuditEntry is one row of the append-only admin audit log
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	AdminID   *string                `json:"admin_id"`
+	Username  string                 `json:"username"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target"`
+	Status    int                    `json:"status"`
+	IP        string                 `json:"ip"`
+	Detail    map[string]interface{} `json:"detail,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AuditFilter struct {
+	AdminID string
+	Action  string // prefix match
+	Limit   int
+	Offset  int
+}
+
+type AdminRepository interface {
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, admin *AdminUser) error
+	FindByID(ctx context.Context, id string) (*AdminUser, error)
+	FindByUsername(ctx context.Context, username string) (*AdminUser, error)
+	List(ctx context.Context) ([]*AdminUser, error)
+	UpdateRole(ctx context.Context, id string, role AdminRole) error
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+	RecordLogin(ctx context.Context, id string) error
+	// SetTOTPSecret stores a secret awaiting confirmation; fails to match if TOTP is already enabled
+	SetTOTPSecret(ctx context.Context, id, secret string) (bool, error)
+	EnableTOTP(ctx context.Context, id string) error
+	ResetTOTP(ctx context.Context, id string) error
+	// UseTOTPStep records step as used; returns false if it is not newer than the last used step
+	UseTOTPStep(ctx context.Context, id string, step int64) (bool, error)
+}
+
+type AdminSessionRepository interface {
+	Create(ctx context.Context, session *AdminSession) error
+	FindByTokenHash(ctx context.Context, hash string) (*AdminSession, error)
+	Touch(ctx context.Context, id string, client ClientInfo) error
+	Revoke(ctx context.Context, id string) error
+	RevokeAllByAdmin(ctx context.Context, adminID string) error
+}
+
+type AuditLogRepository interface {
+	Append(ctx context.Context, entry *AuditEntry) error
+	// List returns entries newest first and the total matching the filter
+	List(ctx context.Context, filter AuditFilter) ([]*AuditEntry, int, error)
+}
@@ -22,34 +22,188 @@ type Card struct {
 	CardToken   string
 	CardType    CardType
 	Status      CardStatus
+	KeyVersion  *int // SUN key version of the chip, nil for static-token cards
 	CreatedAt   time.Time
 	ActivatedAt *time.Time
 	RevokedAt   *time.Time
 }
 
+type CardEventType string
+
+const (
+	CardEventRegistered  CardEventType = "registered"
+	CardEventRevoked     CardEventType = "revoked"
+	CardEventPromoted    CardEventType = "promoted"
+	CardEventBackupBound CardEventType = "backup_bound"
+
+	CardEventPasskeyRegistered CardEventType = "passkey_registered"
+	CardEventPasskeyUsed       CardEventType = "passkey_used"
+	CardEventPasskeyRevoked    CardEventType = "passkey_revoked"
+
+	CardEventAccountFrozen   CardEventType = "account_frozen"   // with the backup card
+	CardEventAccountUnfrozen CardEventType = "account_unfrozen" // with the primary card
+)
+
+// CardEvent is one entry of a user's card history. Passkey events carry PasskeyID instead of CardID.
+type CardEvent struct {
+	ID        string        `json:"id"`
+	UserID    string        `json:"-"`
+	CardID    string        `json:"card_id,omitempty"`
+	PasskeyID string        `json:"passkey_id,omitempty"`
+	Event     CardEventType `json:"event"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type CardPairStatus string
+
+// A pair is manufactured in a batch, issued to someone, then registered by its owner.
+// Lost and revoked pairs can never be registered again.
+const (
+	CardPairManufactured CardPairStatus = "manufactured"
+	CardPairIssued       CardPairStatus = "issued"
+	CardPairRegistered   CardPairStatus = "registered"
+	CardPairLost         CardPairStatus = "lost"
+	CardPairRevoked      CardPairStatus = "revoked"
+)
+
+var cardPairTransitions = map[CardPairStatus][]CardPairStatus{
+	CardPairManufactured: {CardPairIssued, CardPairLost, CardPairRevoked},
+	CardPairIssued:       {CardPairRegistered, CardPairLost, CardPairRevoked},
+	CardPairRegistered:   {CardPairLost, CardPairRevoked},
+	CardPairLost:         {CardPairRevoked},
+}
+
+func (s CardPairStatus) Valid() bool {
+	switch s {
+	case CardPairManufactured, CardPairIssued, CardPairRegistered, CardPairLost, CardPairRevoked:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether the inventory lifecycle allows moving from s to next
+func (s CardPairStatus) CanTransitionTo(next CardPairStatus) bool {
+	for _, allowed := range cardPairTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CardPair is one physical pair of cards in the inventory. Only issued, unexpired pairs
+// can be registered, and RegisteredAt/RegisteredBy record the registration that consumed it.
 type CardPair struct {
-	ID           string
-	PrimaryToken string
-	BackupToken  *string
-	CreatedAt    time.Time
-	ExpiresAt    time.Time
+	ID              string         `json:"id"`
+	PrimaryToken    string         `json:"primary_token"`
+	BackupToken     *string        `json:"backup_token"`
+	Status          CardPairStatus `json:"status"`
+	BatchID         *string        `json:"batch_id"`
+	SerialNumber    *string        `json:"serial_number"`
+	IssuedTo        *string        `json:"issued_to"`
+	IssuedAt        *time.Time     `json:"issued_at"`
+	ShippedAt       *time.Time     `json:"shipped_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	ExpiresAt       time.Time      `json:"expires_at"`
+	RegisteredAt    *time.Time     `json:"registered_at"`
+	RegisteredBy    *string        `json:"registered_by"`
+	StatusChangedAt time.Time      `json:"status_changed_at"`
+}
+
+// CardBatch is a manufactured batch with a count of pairs per status
+type CardBatch struct {
+	BatchID string                 `json:"batch_id"`
+	Counts  map[CardPairStatus]int `json:"counts"`
+	Pairs   []*CardPair            `json:"pairs"`
+}
+
+// CardPairState groups pairs the way the admin list filters them
+type CardPairState string
+
+const (
+	CardPairStateActivated CardPairState = "activated" // registered by a user
+	CardPairStateExpired   CardPairState = "expired"   // issued, registration window lapsed
+	CardPairStateUnused    CardPairState = "unused"    // manufactured, or issued and still registrable
+)
+
+// CardPairFilter selects a page of the admin pair list. Query matches a token or serial number prefix.
+type CardPairFilter struct {
+	State  CardPairState
+	Query  string
+	Limit  int
+	Offset int
+}
+
+// Registrable reports whether the pair has been issued and its registration window is still open
+func (p *CardPair) Registrable(now time.Time) bool {
+	return p.Status == CardPairIssued && now.Before(p.ExpiresAt)
+}
+
+// Contains reports whether token is either card of the pair
+func (p *CardPair) Contains(token string) bool {
+	return p.PrimaryToken == token || (p.BackupToken != nil && *p.BackupToken == token)
+}
+
+// CardTag binds an NTAG 424 DNA chip UID to the card token printed on it.
+// LastCounter is the highest SUN read counter accepted so far.
+type CardTag struct {
+	UID         string
+	CardToken   string
+	KeyVersion  int
+	LastCounter *uint32
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
 type CardRepository interface {
 	FindByToken(ctx context.Context, token string) (*Card, error)
 	FindByUserID(ctx context.Context, userID string) ([]*Card, error)
+	FindByUserIDs(ctx context.Context, userIDs []string) ([]*Card, error)
 	FindActiveByUserAndType(ctx context.Context, userID string, cardType CardType) (*Card, error)
 
 	Create(ctx context.Context, card *Card) error
 	Revoke(ctx context.Context, cardID string) error
 	PromoteBackupToPrimary(ctx context.Context, cardID string) error
 
+	RecordEvent(ctx context.Context, userID, cardID string, event CardEventType) error
+	FindEventsByUser(ctx context.Context, userID string) ([]*CardEvent, error)
+
 	CreatePair(ctx context.Context, primaryToken string) (*CardPair, error)
+	// CreatePairs inserts a manufactured batch in one transaction
+	CreatePairs(ctx context.Context, pairs []*CardPair) error
+	FindPairByID(ctx context.Context, id string) (*CardPair, error)
+	FindPairsByBatch(ctx context.Context, batchID string) ([]*CardPair, error)
 	FindPairByPrimaryToken(ctx context.Context, token string) (*CardPair, error)
 	FindPairByBackupToken(ctx context.Context, token string) (*CardPair, error)
 	UpdatePairBackupToken(ctx context.Context, pairID, backupToken string) error
-	DeletePair(ctx context.Context, pairID string) error
+	// ListPairs returns one page of pairs, newest first, and the total number of matches
+	ListPairs(ctx context.Context, filter CardPairFilter) ([]*CardPair, int, error)
+	// DeletePair removes a pair that was never registered. Returns false otherwise.
+	DeletePair(ctx context.Context, pairID string) (bool, error)
+	// ClaimPair marks an unexpired, unregistered pair as registered.
+	// Returns false when the pair has expired or another registration claimed it first; inside a
+	// unit of work, a concurrent claim blocks until the other transaction commits or rolls back.
+	ClaimPair(ctx context.Context, pairID string) (bool, error)
+	SetPairRegisteredBy(ctx context.Context, pairID, userID string) error
+	// IssuePair moves a manufactured pair to issued and opens its registration window
+	IssuePair(ctx context.Context, pairID, issuedTo string, expiresAt time.Time) (bool, error)
+	MarkPairShipped(ctx context.Context, pairID string) (bool, error)
+	// UpdatePairStatus changes the status only if it is still from, so concurrent changes cannot skip a state
+	UpdatePairStatus(ctx context.Context, pairID string, from, to CardPairStatus) (bool, error)
 	CleanupExpiredPairs(ctx context.Context) error
+
+	CreateTag(ctx context.Context, tag *CardTag) error
+	FindTagByUID(ctx context.Context, uid string) (*CardTag, error)
+	FindTagByToken(ctx context.Context, token string) (*CardTag, error)
+	// AdvanceTagCounter stores counter only if it is greater than the last one seen.
+	// Returns false when the tap is a replay or a rollback.
+	AdvanceTagCounter(ctx context.Context, uid string, counter uint32) (bool, error)
+	// CreateTapNonce stores the nonce of a verified tap, replacing the card's earlier ones
+	CreateTapNonce(ctx context.Context, nonceHash, token string, expiresAt time.Time) error
+	// TapNonceValid reports whether the nonce was issued for the card and is unexpired and unused
+	TapNonceValid(ctx context.Context, nonceHash, token string) (bool, error)
+	// UseTapNonce consumes the nonce; returns false when it is not valid for the card
+	UseTapNonce(ctx context.Context, nonceHash, token string) (bool, error)
 }
 
 type CardCheckResult struct {
@@ -6,11 +6,20 @@ import (
 )
 
 type Conversation struct {
-	ID            string     `json:"id"`
-	Participant1  string     `json:"participant_1"`
-	Participant2  string     `json:"participant_2"`
-	LastMessageAt *time.Time `json:"last_message_at"`
-	CreatedAt     time.Time  `json:"created_at"`
+	ID            string       `json:"id"`
+	Participant1  string       `json:"participant_1"`
+	Participant2  string       `json:"participant_2"`
+	LastMessageAt *time.Time   `json:"last_message_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	Sync          SyncPosition `json:"-"` // sync position of the latest change
+}
+
+// ConversationDeletion is the tombstone a conversation leaves for sync when either participant's
+// account is purged
+type ConversationDeletion struct {
+	ID        string       `json:"id"`
+	DeletedAt time.Time    `json:"deleted_at"`
+	Sync      SyncPosition `json:"-"`
 }
 
 type ConversationWithPeer struct {
@@ -25,4 +34,10 @@ type ConversationRepository interface {
 	FindByParticipants(ctx context.Context, userA, userB string) (*Conversation, error)
 	FindByUser(ctx context.Context, userID string) ([]*ConversationWithPeer, error)
 	GetOrCreate(ctx context.Context, userA, userB string) (*Conversation, error)
+	// FindChangedSince returns up to limit of the user's conversations created or updated after
+	// the sync position and below the horizon, in sync order
+	FindChangedSince(ctx context.Context, userID string, since SyncPosition, horizon int64, limit int) ([]*ConversationWithPeer, error)
+	// FindDeletedSince returns up to limit tombstones of the user's conversations after the sync
+	// position and below the horizon, in sync order
+	FindDeletedSince(ctx context.Context, userID string, since SyncPosition, horizon int64, limit int) ([]*ConversationDeletion, error)
 }
@@ -1,14 +1,21 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 const (
 	ErrCodeValidation   = "VALIDATION_ERROR"
 	ErrCodeNotFound     = "NOT_FOUND"
 	ErrCodeUnauthorized = "UNAUTHORIZED"
+	ErrCodeForbidden    = "FORBIDDEN"
 	ErrCodeConflict     = "CONFLICT"
 	ErrCodeInternal     = "INTERNAL_ERROR"
 	ErrCodeRateLimited  = "RATE_LIMITED"
+	// Lets clients offer unfreezing instead of a plain error
+	ErrCodeAccountFrozen = "ACCOUNT_FROZEN"
 )
 
 type AppError struct {
@@ -22,10 +29,17 @@ func (e *AppError) Error() string { return e.Message }
 func ErrValidation(msg string) *AppError   { return &AppError{ErrCodeValidation, msg, 400} }
 func ErrNotFound(msg string) *AppError     { return &AppError{ErrCodeNotFound, msg, 404} }
 func ErrUnauthorized(msg string) *AppError { return &AppError{ErrCodeUnauthorized, msg, 401} }
+func ErrForbidden(msg string) *AppError    { return &AppError{ErrCodeForbidden, msg, 403} }
 func ErrConflict(msg string) *AppError     { return &AppError{ErrCodeConflict, msg, 409} }
 func ErrInternal() *AppError               { return &AppError{ErrCodeInternal, "系統錯誤", 500} }
 func ErrRateLimited() *AppError            { return &AppError{ErrCodeRateLimited, "請求過於頻繁", 429} }
 
+// ErrLoginLocked is returned while a card is locked after repeated wrong passwords
+func ErrLoginLocked(until time.Time) *AppError {
+	secs := int(time.Until(until).Seconds()) + 1
+	return &AppError{ErrCodeRateLimited, fmt.Sprintf("密碼錯誤次數過多，請於 %d 秒後再試", secs), 429}
+}
+
 var (
 	ErrUserNotFound         = ErrNotFound("用戶不存在")
 	ErrInvalidPassword      = ErrUnauthorized("密碼錯誤")
@@ -34,8 +48,22 @@ var (
 	ErrAlreadyFriends       = ErrConflict("已經是好友")
 	ErrSelfFriendRequest    = ErrValidation("不能加自己為好友")
 	ErrConversationNotFound = ErrNotFound("對話不存在")
+	ErrNotFriends           = ErrForbidden("只能傳訊息給好友")
 	ErrCardRevoked          = ErrUnauthorized("此卡已失效")
 	ErrSessionRevoked       = ErrUnauthorized("Session 已失效")
+	ErrSessionNotFound      = ErrNotFound("裝置不存在")
+	ErrRefreshTokenReused   = ErrUnauthorized("Refresh token 已被使用過，此登入已撤銷")
+	ErrInvalidTap           = ErrUnauthorized("無效的卡片感應")
+	ErrTapReplayed          = ErrUnauthorized("卡片感應已被使用過")
+	ErrTapRequired          = ErrUnauthorized("請重新感應卡片")
+	ErrTagNotFound          = ErrNotFound("卡片未登錄")
+	ErrAccountSuspended     = ErrForbidden("帳號已被停用")
+	ErrAccountFrozen        = &AppError{ErrCodeAccountFrozen, "帳號已凍結，請使用主卡解除凍結", 403}
+	ErrAdminLoginFailed     = ErrUnauthorized("帳號、密碼或驗證碼錯誤")
+	ErrAdminSessionInvalid  = ErrUnauthorized("管理員登入已失效")
+	ErrAdminNotFound        = ErrNotFound("管理員不存在")
+	ErrAdminForbidden       = ErrForbidden("權限不足")
+	ErrAdminTOTPRequired    = ErrForbidden("請先啟用兩步驟驗證")
 )
 
 func IsAppError(err error) (*AppError, bool) {
@@ -0,0 +1,22 @@
+package domain
+
+// IsUUID reports whether id has the canonical form of the UUIDs every table uses as its key,
+// so ids from a URL or a message can be rejected before they reach a query and fail there
+func IsUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, c := range id {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
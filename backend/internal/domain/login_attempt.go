@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempts tracks failed password attempts against one card.
+// Failures counts consecutive failures, including attempts still being checked, and drives the
+// backoff; Unreported counts failures the owner has not been told about yet.
+type LoginAttempts struct {
+	CardID       string
+	Failures     int
+	Unreported   int
+	LockedUntil  *time.Time
+	LastFailedAt *time.Time
+}
+
+// LoginFailureNotice tells a user about failed attempts on their cards since their last login
+type LoginFailureNotice struct {
+	FailedAttempts int       `json:"failed_attempts"`
+	LastFailedAt   time.Time `json:"last_failed_at"`
+}
+
+type LoginAttemptRepository interface {
+	// Acquire returns the card's row, creating it if needed, locked until the transaction ends
+	Acquire(ctx context.Context, cardID string) (*LoginAttempts, error)
+	// Reserve counts an attempt as a failure before its password is checked and sets the lock
+	// that failure earns, nil for none
+	Reserve(ctx context.Context, cardID string, lockedUntil *time.Time) error
+	// RecordFailure counts a reserved attempt whose password was wrong towards the owner's
+	// notice and returns the updated row
+	RecordFailure(ctx context.Context, cardID string) (*LoginAttempts, error)
+	// Reset clears the consecutive failures and the lock of a card after a correct password
+	Reset(ctx context.Context, cardID string) error
+	// TakeUnreported returns and clears the unreported failures across all of a user's cards
+	TakeUnreported(ctx context.Context, userID string) (*LoginFailureNotice, error)
+}
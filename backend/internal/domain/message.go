@@ -6,20 +6,78 @@ import (
 )
 
 type Message struct {
-	ID               string     `json:"id"`
-	ConversationID   string     `json:"conversation_id"`
-	SenderID         string     `json:"sender_id"`
-	EncryptedContent string     `json:"encrypted_content"`
-	CreatedAt        time.Time  `json:"created_at"`
-	DeliveredAt      *time.Time `json:"delivered_at"`
-	ReadAt           *time.Time `json:"read_at"`
+	ID               string       `json:"id"`
+	ConversationID   string       `json:"conversation_id"`
+	SenderID         string       `json:"sender_id"`
+	EncryptedContent string       `json:"encrypted_content"`
+	CreatedAt        time.Time    `json:"created_at"`
+	DeliveredAt      *time.Time   `json:"delivered_at"`
+	ReadAt           *time.Time   `json:"read_at"`
+	TempID           string       `json:"temp_id,omitempty"` // the sender's own ID for the send, unique per sender
+	Sync             SyncPosition `json:"-"`                 // sync position of the latest change
+}
+
+// MessageDeletion is the tombstone a deleted message leaves for sync
+type MessageDeletion struct {
+	ID             string       `json:"id"`
+	ConversationID string       `json:"conversation_id"`
+	DeletedAt      time.Time    `json:"deleted_at"`
+	Sync           SyncPosition `json:"-"`
+}
+
+// SyncPosition orders changes for sync: by the transaction that made them, then by sync_seq
+// within it. Transactions commit out of order, so only positions below the horizon, the oldest
+// transaction still running, are final.
+type SyncPosition struct {
+	XID int64
+	Seq int64
+}
+
+// Before reports whether p comes before q in sync order
+func (p SyncPosition) Before(q SyncPosition) bool {
+	return p.XID < q.XID || (p.XID == q.XID && p.Seq < q.Seq)
+}
+
+// MessageCursor is a position in a conversation's (created_at, id) order. Without an ID it
+// only bounds by time, which is ambiguous between messages sharing a timestamp.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// MessagePage selects up to Limit messages of a conversation. With After it is the oldest ones
+// after that position, otherwise the newest ones before Before (or overall). Pages are oldest first.
+type MessagePage struct {
+	Limit  int
+	Before *MessageCursor
+	After  *MessageCursor
 }
 
 type MessageRepository interface {
-	Create(ctx context.Context, msg *Message) error
-	FindByConversation(ctx context.Context, convID string, limit int, before *time.Time) ([]*Message, error)
+	// Create stores the message and returns true. When the sender already sent one with the same
+	// TempID, msg is filled in with that message instead and false is returned.
+	Create(ctx context.Context, msg *Message) (bool, error)
+	FindByConversation(ctx context.Context, convID string, page MessagePage) ([]*Message, error)
 	FindByID(ctx context.Context, id string) (*Message, error)
+	// FindByTempID returns the sender's message with that TempID, or nil
+	FindByTempID(ctx context.Context, senderID, tempID string) (*Message, error)
+	// FindAllByUser returns every message of every conversation the user takes part in, oldest first
+	FindAllByUser(ctx context.Context, userID string) ([]*Message, error)
+	// SyncHorizon returns the transaction ID below which sync positions are final
+	SyncHorizon(ctx context.Context) (int64, error)
+	// FindChangedSince returns up to limit messages of the user's conversations created, delivered
+	// or read after the sync position and below the horizon, in sync order
+	FindChangedSince(ctx context.Context, userID string, since SyncPosition, horizon int64, limit int) ([]*Message, error)
+	// FindDeletedSince returns up to limit tombstones of the user's conversations after the sync
+	// position and below the horizon, in sync order
+	FindDeletedSince(ctx context.Context, userID string, since SyncPosition, horizon int64, limit int) ([]*MessageDeletion, error)
+	// Delete removes the message and leaves a tombstone for sync
 	Delete(ctx context.Context, id string) error
-	MarkDelivered(ctx context.Context, id string) error
+	// FindUndelivered returns up to limit messages waiting for the recipient after the cursor,
+	// oldest first in (created_at, id) order
+	FindUndelivered(ctx context.Context, recipientID string, after *MessageCursor, limit int) ([]*Message, error)
+	// MarkDelivered records delivery to the recipient and returns the updated message, or nil
+	// when it was already delivered or is not addressed to the recipient
+	MarkDelivered(ctx context.Context, id, recipientID string) (*Message, error)
 	MarkRead(ctx context.Context, id string) error
 }
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Passkey is a WebAuthn credential that can stand in for the primary card at login.
+// It is revoked together with the primary card when the backup card is used.
+type Passkey struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"-"`
+	CredentialID []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"` // COSE_Key
+	SignCount    uint32     `json:"-"`
+	AAGUID       []byte     `json:"-"`
+	Name         string     `json:"name"`
+	Status       CardStatus `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+}
+
+type WebAuthnPurpose string
+
+const (
+	WebAuthnRegister WebAuthnPurpose = "register"
+	WebAuthnLogin    WebAuthnPurpose = "login"
+)
+
+// WebAuthnChallenge is a started registration or login ceremony.
+// UserID is empty for logins, where the credential itself names the user.
+type WebAuthnChallenge struct {
+	ID        string
+	UserID    string
+	Purpose   WebAuthnPurpose
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+type PasskeyRepository interface {
+	Create(ctx context.Context, passkey *Passkey) error
+	FindByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error)
+	FindByUserID(ctx context.Context, userID string) ([]*Passkey, error)
+	// UpdateUsage stores the signature counter of a successful login.
+	// Returns false when a concurrent login already used the same or a later counter value.
+	UpdateUsage(ctx context.Context, passkeyID string, signCount uint32) (bool, error)
+	// Revoke revokes an active passkey of the user. Returns false if there is none with that ID.
+	Revoke(ctx context.Context, userID, passkeyID string) (bool, error)
+	// RevokeAllByUser revokes every active passkey of the user and returns their IDs
+	RevokeAllByUser(ctx context.Context, userID string) ([]string, error)
+	// RecordEvent adds a passkey entry to the user's card history
+	RecordEvent(ctx context.Context, userID, passkeyID string, event CardEventType) error
+
+	// CreateChallenge stores a new challenge and drops expired ones
+	CreateChallenge(ctx context.Context, challenge *WebAuthnChallenge) error
+	// TakeChallenge deletes and returns an unexpired challenge, so each can be answered only once
+	TakeChallenge(ctx context.Context, id string, purpose WebAuthnPurpose) (*WebAuthnChallenge, error)
+}
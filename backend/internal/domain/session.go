@@ -6,18 +6,74 @@ import (
 )
 
 type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	TokenHash  string     `json:"-"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// ClientInfo identifies the device a session is used from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+const maxUserAgentLength = 512
+
+func NewClientInfo(ip, userAgent string) ClientInfo {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return ClientInfo{IP: ip, UserAgent: userAgent}
+}
+
+// Why sessions were revoked. Their realtime clients get the reason in a security frame before
+// being disconnected.
+const (
+	RevokeReasonCardsRevoked     = "cards_revoked"
+	RevokeReasonAccountFrozen    = "account_frozen"
+	RevokeReasonAccountSuspended = "account_suspended"
+	RevokeReasonAccountDeleted   = "account_deleted"
+	RevokeReasonPasswordChanged  = "password_changed"
+	RevokeReasonSignedOut        = "signed_out" // by the owner from another device, or by support staff
+	RevokeReasonTokenReused      = "token_reused"
+)
+
+// RefreshToken is one link of a session's refresh token chain
+type RefreshToken struct {
 	ID        string
-	UserID    string
+	SessionID string
 	TokenHash string
 	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt *time.Time
+	UsedAt    *time.Time
 }
 
 type SessionRepository interface {
 	Create(ctx context.Context, session *Session) error
+	FindByID(ctx context.Context, id string) (*Session, error)
 	FindByTokenHash(ctx context.Context, hash string) (*Session, error)
+	// FindActiveByUser lists unrevoked, unexpired sessions, most recently used first
+	FindActiveByUser(ctx context.Context, userID string) ([]*Session, error)
+	// Touch records that the session was just used from the given client
+	Touch(ctx context.Context, id string, client ClientInfo) error
+	// Rotate points the session at a new access token and extends its lifetime
+	Rotate(ctx context.Context, id, tokenHash string, expiresAt time.Time) error
 	RevokeAllByUser(ctx context.Context, userID string) error
+	// RevokeOthers revokes every session of the user except keepID
+	RevokeOthers(ctx context.Context, userID, keepID string) error
 	Revoke(ctx context.Context, id string) error
 	CleanupExpired(ctx context.Context) error
 }
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, rt *RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// Consume marks an unused token as used and returns it; returns nil if it was already used or does not exist
+	Consume(ctx context.Context, hash string) (*RefreshToken, error)
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "context"
+
+// Repositories are the repositories a unit of work can write through, all bound to its transaction
+type Repositories struct {
+	Users         UserRepository
+	Cards         CardRepository
+	Passkeys      PasskeyRepository
+	Sessions      SessionRepository
+	RefreshTokens RefreshTokenRepository
+	Friendships   FriendshipRepository
+	// LoginAttempts must be acquired before a card's attempt is reserved
+	LoginAttempts LoginAttemptRepository
+}
+
+// UnitOfWork makes a multi-step write atomic. Do runs fn in one transaction and commits it
+// when fn returns nil; any error, or a panic, rolls every step back.
+// fn must only write through the repositories it is given.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(repos *Repositories) error) error
+}
@@ -5,15 +5,40 @@ import (
 	"time"
 )
 
+type UserStatus string
+
+// Suspended accounts cannot log in, refresh, use the API or connect to the realtime hub.
+// Frozen accounts are locked the same way, but by their owner, who can lift it with the primary card.
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusFrozen    UserStatus = "frozen"
+)
+
 type User struct {
-	ID           string     `json:"id"`
-	PasswordHash string     `json:"-"`
-	Nickname     string     `json:"nickname"`
-	PublicKey    string     `json:"public_key"`
-	AvatarURL    *string    `json:"avatar_url"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	LastSeenAt   *time.Time `json:"last_seen_at"`
+	ID            string     `json:"id"`
+	PasswordHash  string     `json:"-"`
+	Nickname      string     `json:"nickname"`
+	PublicKey     string     `json:"public_key"`
+	AvatarURL     *string    `json:"avatar_url"`
+	Status        UserStatus `json:"status,omitempty"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	SuspendReason *string    `json:"suspend_reason,omitempty"`
+	DeleteAfter   *time.Time `json:"delete_after,omitempty"` // set while a requested deletion is pending
+	// Set while frozen; the primary card can only unfreeze the account before UnfreezeBefore
+	FrozenAt       *time.Time `json:"frozen_at,omitempty"`
+	UnfreezeBefore *time.Time `json:"unfreeze_before,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+}
+
+// UserFilter selects users for the admin user list
+type UserFilter struct {
+	Query  string // nickname substring or exact user ID
+	Status UserStatus
+	Limit  int
+	Offset int
 }
 
 type UserRepository interface {
@@ -21,6 +46,27 @@ type UserRepository interface {
 	FindByID(ctx context.Context, id string) (*User, error)
 	GetPublicKey(ctx context.Context, id string) (string, error)
 	Update(ctx context.Context, user *User) error
+	// UpdateCredentials replaces the password hash and the public key derived from the password together
+	UpdateCredentials(ctx context.Context, id, passwordHash, publicKey string) error
+	UpdatePasswordHash(ctx context.Context, id, passwordHash string) error
 	UpdateLastSeen(ctx context.Context, id string) error
 	Search(ctx context.Context, query string, limit int) ([]*User, error)
+	// List returns one page of users, newest first, with LastSeenAt taken from their latest session
+	// use, and the total number of matches
+	List(ctx context.Context, filter UserFilter) ([]*User, int, error)
+	GetStatus(ctx context.Context, id string) (UserStatus, error)
+	// Suspend blocks the account whatever its status; a freeze is kept for when it is unsuspended
+	Suspend(ctx context.Context, id, reason string) error
+	// Unsuspend returns a suspended account to active, or to frozen if it was frozen before;
+	// false when it was not suspended
+	Unsuspend(ctx context.Context, id string) (bool, error)
+	// Freeze locks an active account until unfreezeBefore; false when the account was not active
+	Freeze(ctx context.Context, id string, unfreezeBefore time.Time) (bool, error)
+	// Unfreeze reactivates a frozen account; false when it was not frozen
+	Unfreeze(ctx context.Context, id string) (bool, error)
+	ScheduleDeletion(ctx context.Context, id string, deleteAfter time.Time) error
+	CancelDeletion(ctx context.Context, id string) error
+	// PurgeDeleted hard-deletes accounts whose deletion grace period has passed; their cards,
+	// sessions, friendships, conversations and messages go with them through ON DELETE CASCADE
+	PurgeDeleted(ctx context.Context) (int64, error)
 }
@@ -1,176 +1,202 @@
 package handler
 
 import (
-	"context"
-	"sync"
 	"time"
 
-	"link/internal/pkg/cardtoken"
+	"link/internal/domain"
+	"link/internal/service"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Disconnector drops users' realtime connections
+type Disconnector interface {
+	IsOnline(userID string) bool
+	CloseUser(userID string) bool
+}
+
 type AdminHandler struct {
-	tokenGen   *cardtoken.Generator
-	password   string
-	baseURL    string
-	cardPairs  []CardPairInfo
-	pairsMutex sync.RWMutex
-	nextID     int
-	db         *pgxpool.Pool
+	cardSvc      *service.CardService
+	adminSvc     *service.AdminService
+	userSvc      *service.UserService
+	sessionSvc   *service.SessionService
+	disconnector Disconnector
+	baseURL      string
 }
 
+// CardPairInfo is a pair as shown on the admin page, with the URLs written to the cards
 type CardPairInfo struct {
-	ID         int    `json:"id"`
-	FirstToken string `json:"first_token"`
-	SecondToken string `json:"second_token"`
-	FirstURL   string `json:"first_url"`
-	SecondURL  string `json:"second_url"`
-	IsActivated bool  `json:"is_activated"`
+	*domain.CardPair
+	FirstURL    string `json:"first_url"`
+	SecondURL   string `json:"second_url"`
+	IsActivated bool   `json:"is_activated"`
+	IsExpired   bool   `json:"is_expired"`
 }
 
-func NewAdminHandler(tokenGen *cardtoken.Generator, password, baseURL string, db *pgxpool.Pool) *AdminHandler {
+func NewAdminHandler(
+	cardSvc *service.CardService,
+	adminSvc *service.AdminService,
+	userSvc *service.UserService,
+	sessionSvc *service.SessionService,
+	disconnector Disconnector,
+	baseURL string,
+) *AdminHandler {
 	return &AdminHandler{
-		tokenGen:  tokenGen,
-		password:  password,
-		baseURL:   baseURL,
-		cardPairs: make([]CardPairInfo, 0),
-		nextID:    1,
-		db:        db,
+		cardSvc:      cardSvc,
+		adminSvc:     adminSvc,
+		userSvc:      userSvc,
+		sessionSvc:   sessionSvc,
+		disconnector: disconnector,
+		baseURL:      baseURL,
 	}
 }
 
-func (h *AdminHandler) AuthMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		password := c.Get("X-Admin-Password")
-		if password != h.password {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "invalid password",
-			})
-		}
-		return c.Next()
+func (h *AdminHandler) pairInfo(p *domain.CardPair) CardPairInfo {
+	info := CardPairInfo{
+		CardPair:    p,
+		FirstURL:    h.baseURL + "/w/" + p.PrimaryToken,
+		IsActivated: p.Status == domain.CardPairRegistered,
+		IsExpired:   p.Status == domain.CardPairIssued && !p.Registrable(time.Now()),
+	}
+	if p.BackupToken != nil {
+		info.SecondURL = h.baseURL + "/w/" + *p.BackupToken
 	}
+	return info
 }
 
 func (h *AdminHandler) GenerateCardPair(c *fiber.Ctx) error {
-	first, second, err := h.tokenGen.GeneratePair()
+	pair, err := h.cardSvc.GeneratePair(c.Context())
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, h.pairInfo(pair))
+}
+
+// ListCardPairs supports ?state=activated|expired|unused, ?q=<token or serial prefix>, ?limit= and ?offset=
+func (h *AdminHandler) ListCardPairs(c *fiber.Ctx) error {
+	pairs, total, err := h.cardSvc.ListPairs(c.Context(), domain.CardPairFilter{
+		State:  domain.CardPairState(c.Query("state")),
+		Query:  c.Query("q"),
+		Limit:  c.QueryInt("limit", 50),
+		Offset: c.QueryInt("offset", 0),
+	})
+	if err != nil {
+		return Error(c, err)
+	}
+
+	infos := make([]CardPairInfo, len(pairs))
+	for i, p := range pairs {
+		infos[i] = h.pairInfo(p)
+	}
+	return OK(c, fiber.Map{"pairs": infos, "total": total})
+}
+
+func (h *AdminHandler) DeleteCardPair(c *fiber.Ctx) error {
+	if err := h.cardSvc.DeletePair(c.Context(), c.Params("id")); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "deleted"})
+}
+
+func (h *AdminHandler) RevokeCardPair(c *fiber.Ctx) error {
+	pair, err := h.cardSvc.RevokeUnusedPair(c.Context(), c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to generate card pair",
-		})
+		return Error(c, err)
 	}
+	return OK(c, h.pairInfo(pair))
+}
 
-	// Save to database with 30 days expiry
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// BindCardTag registers the NTAG 424 DNA chip a card token was written to, so /tap can find it
+func (h *AdminHandler) BindCardTag(c *fiber.Ctx) error {
+	var req struct {
+		UID        string `json:"uid"`
+		CardToken  string `json:"card_token"`
+		KeyVersion int    `json:"key_version"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
 
-	_, err = h.db.Exec(ctx,
-		"INSERT INTO card_pairs (primary_token, backup_token, expires_at) VALUES ($1, $2, NOW() + INTERVAL '30 days')",
-		first, second)
+	tag, err := h.cardSvc.BindTag(c.Context(), req.UID, req.CardToken, req.KeyVersion)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to save card pair",
-		})
+		return Error(c, err)
 	}
+	return OK(c, fiber.Map{
+		"uid":         tag.UID,
+		"card_token":  tag.CardToken,
+		"key_version": tag.KeyVersion,
+	})
+}
 
-	pair := CardPairInfo{
-		ID:          h.nextID,
-		FirstToken:  first,
-		SecondToken: second,
-		FirstURL:    h.baseURL + "/w/" + first,
-		SecondURL:   h.baseURL + "/w/" + second,
+// ManufactureBatch adds a batch of printed pairs to the inventory
+func (h *AdminHandler) ManufactureBatch(c *fiber.Ctx) error {
+	var req struct {
+		BatchID string `json:"batch_id"`
+		Count   int    `json:"count"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
 	}
 
-	h.pairsMutex.Lock()
-	h.cardPairs = append(h.cardPairs, pair)
-	h.nextID++
-	h.pairsMutex.Unlock()
+	pairs, err := h.cardSvc.ManufactureBatch(c.Context(), req.BatchID, req.Count)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, pairs)
+}
 
-	return c.JSON(fiber.Map{"data": pair})
+// ImportBatch takes the signed batch file written by cardgen -format batch as the request body
+func (h *AdminHandler) ImportBatch(c *fiber.Ctx) error {
+	pairs, err := h.cardSvc.ImportBatch(c.Context(), c.Body())
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, pairs)
 }
 
-func (h *AdminHandler) ListCardPairs(c *fiber.Ctx) error {
-	// Get from database
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	rows, err := h.db.Query(ctx, `
-		SELECT 
-			cp.primary_token, 
-			cp.backup_token, 
-			cp.created_at,
-			CASE WHEN c.id IS NOT NULL THEN true ELSE false END as is_activated
-		FROM card_pairs cp
-		LEFT JOIN cards c ON c.card_token = cp.primary_token AND c.card_type = 'primary' AND c.status = 'active'
-		WHERE cp.expires_at > NOW() 
-		ORDER BY cp.created_at DESC
-	`)
+func (h *AdminHandler) GetBatch(c *fiber.Ctx) error {
+	batch, err := h.cardSvc.GetBatch(c.Context(), c.Params("batchId"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to fetch card pairs",
-		})
-	}
-	defer rows.Close()
-
-	// First, collect all pairs to count total
-	var tempPairs []struct {
-		primaryToken string
-		backupToken  string
-		createdAt    time.Time
-		isActivated  bool
-	}
-	
-	for rows.Next() {
-		var p struct {
-			primaryToken string
-			backupToken  string
-			createdAt    time.Time
-			isActivated  bool
-		}
-		if err := rows.Scan(&p.primaryToken, &p.backupToken, &p.createdAt, &p.isActivated); err != nil {
-			continue
-		}
-		tempPairs = append(tempPairs, p)
-	}
-
-	// Now assign IDs in reverse order (newest gets highest ID)
-	totalCount := len(tempPairs)
-	var pairs []CardPairInfo
-	
-	for i, p := range tempPairs {
-		pairs = append(pairs, CardPairInfo{
-			ID:          totalCount - i, // Reverse the ID
-			FirstToken:  p.primaryToken,
-			SecondToken: p.backupToken,
-			FirstURL:    h.baseURL + "/w/" + p.primaryToken,
-			SecondURL:   h.baseURL + "/w/" + p.backupToken,
-			IsActivated: p.isActivated,
-		})
-	}
-
-	return c.JSON(fiber.Map{"data": pairs})
+		return Error(c, err)
+	}
+	return OK(c, batch)
 }
 
-func (h *AdminHandler) DeleteCardPair(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func (h *AdminHandler) IssuePair(c *fiber.Ctx) error {
+	var req struct {
+		IssuedTo string `json:"issued_to"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	pair, err := h.cardSvc.IssuePair(c.Context(), c.Params("id"), req.IssuedTo)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "invalid id",
-		})
+		return Error(c, err)
 	}
+	return OK(c, pair)
+}
 
-	h.pairsMutex.Lock()
-	defer h.pairsMutex.Unlock()
+func (h *AdminHandler) ShipPair(c *fiber.Ctx) error {
+	pair, err := h.cardSvc.ShipPair(c.Context(), c.Params("id"))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, pair)
+}
 
-	for i, pair := range h.cardPairs {
-		if pair.ID == id {
-			h.cardPairs = append(h.cardPairs[:i], h.cardPairs[i+1:]...)
-			return c.JSON(fiber.Map{"message": "deleted"})
-		}
+// UpdatePairStatus marks a pair lost or revoked
+func (h *AdminHandler) UpdatePairStatus(c *fiber.Ctx) error {
+	var req struct {
+		Status domain.CardPairStatus `json:"status"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
 	}
 
-	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-		"error": "not found",
-	})
+	pair, err := h.cardSvc.SetPairStatus(c.Context(), c.Params("id"), req.Status)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, pair)
 }
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"strings"
+
+	"link/internal/domain"
+	"link/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const adminRoutePrefix = "/api/v1/admin"
+
+// AuthMiddleware resolves the X-Admin-Token session and writes every request it lets through
+// to the audit log once the handler has run
+func (h *AdminHandler) AuthMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		client := clientInfo(c)
+		admin, session, err := h.adminSvc.Authenticate(c.Context(), c.Get("X-Admin-Token"), client)
+		if err != nil {
+			return Error(c, err)
+		}
+		c.Locals("admin", admin)
+		c.Locals("adminSessionID", session.ID)
+
+		err = c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if fe, ok := err.(*fiber.Error); ok {
+				status = fe.Code
+			}
+		}
+		detail, _ := c.Locals("auditDetail").(map[string]interface{})
+		h.adminSvc.Record(c.Context(), &domain.AuditEntry{
+			AdminID:  &admin.ID,
+			Username: admin.Username,
+			Action:   c.Method() + " " + strings.TrimPrefix(c.Route().Path, adminRoutePrefix),
+			Target:   routeTarget(c),
+			Status:   status,
+			IP:       client.IP,
+			Detail:   detail,
+		})
+		return err
+	}
+}
+
+// Require rejects admins whose role lacks permission
+func (h *AdminHandler) Require(permission domain.AdminPermission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := h.adminSvc.Authorize(currentAdmin(c), permission); err != nil {
+			return Error(c, err)
+		}
+		return c.Next()
+	}
+}
+
+// setAuditDetail attaches extra context, such as a reason given, to the request's audit entry
+func setAuditDetail(c *fiber.Ctx, detail map[string]interface{}) {
+	c.Locals("auditDetail", detail)
+}
+
+func currentAdmin(c *fiber.Ctx) *domain.AdminUser {
+	return c.Locals("admin").(*domain.AdminUser)
+}
+
+// routeTarget names what a request acted on from its route params, e.g. "id=..."
+func routeTarget(c *fiber.Ctx) string {
+	var parts []string
+	for _, name := range c.Route().Params {
+		parts = append(parts, name+"="+c.Params(name))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (h *AdminHandler) Login(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		TOTPCode string `json:"totp_code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	res, err := h.adminSvc.Login(c.Context(), req.Username, req.Password, req.TOTPCode, clientInfo(c))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
+}
+
+func (h *AdminHandler) Logout(c *fiber.Ctx) error {
+	if err := h.adminSvc.Logout(c.Context(), c.Locals("adminSessionID").(string)); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "logged out"})
+}
+
+func (h *AdminHandler) Me(c *fiber.Ctx) error {
+	return OK(c, currentAdmin(c))
+}
+
+// SetupTOTP returns a fresh secret with its otpauth:// URI and QR code to scan
+func (h *AdminHandler) SetupTOTP(c *fiber.Ctx) error {
+	setup, err := h.adminSvc.SetupTOTP(c.Context(), currentAdmin(c))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, setup)
+}
+
+func (h *AdminHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	if err := h.adminSvc.ConfirmTOTP(c.Context(), currentAdmin(c).ID, req.Code); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "totp enabled"})
+}
+
+func (h *AdminHandler) ListAdmins(c *fiber.Ctx) error {
+	admins, err := h.adminSvc.ListAdmins(c.Context())
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, admins)
+}
+
+func (h *AdminHandler) CreateAdmin(c *fiber.Ctx) error {
+	var req struct {
+		Username string           `json:"username"`
+		Password string           `json:"password"`
+		Role     domain.AdminRole `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	admin, err := h.adminSvc.CreateAdmin(c.Context(), req.Username, req.Password, req.Role)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, admin)
+}
+
+// UpdateAdmin changes the role, password, disabled state or TOTP enrollment of an admin
+func (h *AdminHandler) UpdateAdmin(c *fiber.Ctx) error {
+	var req service.AdminUpdate
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	admin, err := h.adminSvc.UpdateAdmin(c.Context(), currentAdmin(c).ID, c.Params("id"), req)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, admin)
+}
+
+// ListAudit supports ?admin_id=, ?action=<prefix>, ?limit= and ?offset=
+func (h *AdminHandler) ListAudit(c *fiber.Ctx) error {
+	entries, total, err := h.adminSvc.ListAudit(c.Context(), domain.AuditFilter{
+		AdminID: c.Query("admin_id"),
+		Action:  c.Query("action"),
+		Limit:   c.QueryInt("limit", 50),
+		Offset:  c.QueryInt("offset", 0),
+	})
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"entries": entries, "total": total})
+}
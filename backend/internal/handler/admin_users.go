@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"time"
+
+	"link/internal/domain"
+	"link/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminCardView is a user's card as support staff see it, without the card token
+type adminCardView struct {
+	ID          string            `json:"id"`
+	CardType    domain.CardType   `json:"card_type"`
+	Status      domain.CardStatus `json:"status"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ActivatedAt *time.Time        `json:"activated_at"`
+	RevokedAt   *time.Time        `json:"revoked_at"`
+}
+
+type adminUserView struct {
+	*domain.User
+	Online bool            `json:"online"`
+	Cards  []adminCardView `json:"cards"`
+}
+
+func newAdminCardView(card *domain.Card) adminCardView {
+	return adminCardView{
+		ID:          card.ID,
+		CardType:    card.CardType,
+		Status:      card.Status,
+		CreatedAt:   card.CreatedAt,
+		ActivatedAt: card.ActivatedAt,
+		RevokedAt:   card.RevokedAt,
+	}
+}
+
+func (h *AdminHandler) userView(o *service.UserOverview) adminUserView {
+	cards := make([]adminCardView, len(o.Cards))
+	for i, card := range o.Cards {
+		cards[i] = newAdminCardView(card)
+	}
+	return adminUserView{User: o.User, Online: h.disconnector.IsOnline(o.User.ID), Cards: cards}
+}
+
+// ListUsers supports ?q=<nickname or user ID>, ?status=active|suspended, ?limit= and ?offset=
+func (h *AdminHandler) ListUsers(c *fiber.Ctx) error {
+	users, total, err := h.userSvc.List(c.Context(), domain.UserFilter{
+		Query:  c.Query("q"),
+		Status: domain.UserStatus(c.Query("status")),
+		Limit:  c.QueryInt("limit", 50),
+		Offset: c.QueryInt("offset", 0),
+	})
+	if err != nil {
+		return Error(c, err)
+	}
+
+	views := make([]adminUserView, len(users))
+	for i, u := range users {
+		views[i] = h.userView(u)
+	}
+	return OK(c, fiber.Map{"users": views, "total": total})
+}
+
+// GetUser returns one user with their cards and active sessions
+func (h *AdminHandler) GetUser(c *fiber.Ctx) error {
+	overview, err := h.userSvc.GetOverview(c.Context(), c.Params("id"))
+	if err != nil {
+		return Error(c, err)
+	}
+	sessions, err := h.sessionSvc.ListByUser(c.Context(), overview.User.ID)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"user": h.userView(overview), "sessions": sessions})
+}
+
+func (h *AdminHandler) SuspendUser(c *fiber.Ctx) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+	setAuditDetail(c, map[string]interface{}{"reason": req.Reason})
+
+	userID := c.Params("id")
+	if err := h.userSvc.Suspend(c.Context(), userID, req.Reason); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "帳號已停用"})
+}
+
+func (h *AdminHandler) UnsuspendUser(c *fiber.Ctx) error {
+	if err := h.userSvc.Unsuspend(c.Context(), c.Params("id")); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "帳號已恢復"})
+}
+
+func (h *AdminHandler) RevokeUserCard(c *fiber.Ctx) error {
+	card, err := h.cardSvc.RevokeUserCard(c.Context(), c.Params("id"), c.Params("cardId"))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, newAdminCardView(card))
+}
+
+// RevokeUserSessions signs the user out everywhere and drops their realtime connection
+func (h *AdminHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	err := h.sessionSvc.RevokeUser(c.Context(), c.Params("id"), "", domain.RevokeReasonSignedOut)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "已登出所有裝置"})
+}
+
+// DisconnectUser drops the user's realtime connection without ending their sessions
+func (h *AdminHandler) DisconnectUser(c *fiber.Ctx) error {
+	return OK(c, fiber.Map{"disconnected": h.disconnector.CloseUser(c.Params("id"))})
+}
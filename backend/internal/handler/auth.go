@@ -8,18 +8,29 @@ import (
 )
 
 type AuthHandler struct {
-	authSvc *service.AuthService
-	cardSvc *service.CardService
-	baseURL string
+	authSvc    *service.AuthService
+	cardSvc    *service.CardService
+	passkeySvc *service.PasskeyService
+	baseURL    string
 }
 
-func NewAuthHandler(authSvc *service.AuthService, cardSvc *service.CardService, baseURL string) *AuthHandler {
-	return &AuthHandler{authSvc: authSvc, cardSvc: cardSvc, baseURL: baseURL}
+func NewAuthHandler(
+	authSvc *service.AuthService,
+	cardSvc *service.CardService,
+	passkeySvc *service.PasskeyService,
+	baseURL string,
+) *AuthHandler {
+	return &AuthHandler{
+		authSvc:    authSvc,
+		cardSvc:    cardSvc,
+		passkeySvc: passkeySvc,
+		baseURL:    baseURL,
+	}
 }
 
 func (h *AuthHandler) CheckCard(c *fiber.Ctx) error {
 	token := c.Params("token")
-	result, err := h.cardSvc.CheckCard(c.Context(), token)
+	result, err := h.cardSvc.CheckCard(c.Context(), token, c.Query("tap"))
 	if err != nil {
 		return Error(c, err)
 	}
@@ -44,6 +55,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Password:     req.Password,
 		Nickname:     req.Nickname,
 		PublicKey:    req.PublicKey,
+		Client:       clientInfo(c),
 	})
 	if err != nil {
 		return Error(c, err)
@@ -54,13 +66,14 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req struct {
 		CardToken string `json:"card_token"`
+		TapNonce  string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
 		Password  string `json:"password"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return Error(c, domain.ErrValidation("invalid request"))
 	}
 
-	res, err := h.authSvc.Login(c.Context(), req.CardToken, req.Password)
+	res, err := h.authSvc.Login(c.Context(), req.CardToken, req.TapNonce, req.Password, clientInfo(c))
 	if err != nil {
 		return Error(c, err)
 	}
@@ -70,6 +83,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 func (h *AuthHandler) LoginWithBackup(c *fiber.Ctx) error {
 	var req struct {
 		CardToken string `json:"card_token"`
+		TapNonce  string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
 		Password  string `json:"password"`
 		Confirm   bool   `json:"confirm"`
 	}
@@ -81,28 +95,109 @@ func (h *AuthHandler) LoginWithBackup(c *fiber.Ctx) error {
 		return Error(c, domain.ErrValidation("必須確認撤銷主卡"))
 	}
 
-	res, err := h.authSvc.LoginWithBackupCard(c.Context(), req.CardToken, req.Password)
+	res, err := h.authSvc.LoginWithBackupCard(c.Context(), req.CardToken, req.TapNonce, req.Password, clientInfo(c))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
+}
+
+// Freeze locks the account with the backup card, without touching the primary card
+func (h *AuthHandler) Freeze(c *fiber.Ctx) error {
+	var req struct {
+		CardToken string `json:"card_token"`
+		TapNonce  string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
+		Password  string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	res, err := h.authSvc.Freeze(c.Context(), req.CardToken, req.TapNonce, req.Password)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
+}
+
+func (h *AuthHandler) Unfreeze(c *fiber.Ctx) error {
+	var req struct {
+		CardToken string `json:"card_token"`
+		TapNonce  string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
+		Password  string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	res, err := h.authSvc.Unfreeze(c.Context(), req.CardToken, req.TapNonce, req.Password, clientInfo(c))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
+}
+
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	res, err := h.authSvc.Refresh(c.Context(), req.RefreshToken, clientInfo(c))
 	if err != nil {
 		return Error(c, err)
 	}
 	return OK(c, res)
 }
 
+// CardEntry is the entry point of cards without a chip, whose URL only carries the printed token
 func (h *AuthHandler) CardEntry(c *fiber.Ctx) error {
-	token := c.Params("token")
-	result, _ := h.cardSvc.CheckCard(c.Context(), token)
+	return h.redirectForCard(c, c.Params("token"), "")
+}
+
+// Tap is the NTAG 424 DNA entry point: the card writes a fresh picc_data/cmac pair into its URL on every tap
+func (h *AuthHandler) Tap(c *fiber.Ctx) error {
+	token, tapNonce, err := h.cardSvc.VerifyTap(c.Context(), c.Query("picc_data"), c.Query("cmac"))
+	switch {
+	case err == nil:
+		return h.redirectForCard(c, token, tapNonce)
+	case err == domain.ErrTapReplayed:
+		return c.Redirect(h.baseURL + "/error?reason=tap_replayed")
+	case err == domain.ErrTagNotFound:
+		return c.Redirect(h.baseURL + "/error?reason=unknown_card")
+	default:
+		return c.Redirect(h.baseURL + "/error?reason=invalid_tap")
+	}
+}
+
+func (h *AuthHandler) redirectForCard(c *fiber.Ctx, token, tapNonce string) error {
+	result, err := h.cardSvc.CheckCard(c.Context(), token, tapNonce)
+	if err != nil {
+		return c.Redirect(h.baseURL + "/error")
+	}
 
+	// The nonce rides along to the login page, which sends it back with the password
+	tap := ""
+	if tapNonce != "" {
+		tap = "&tap=" + tapNonce
+	}
 	switch result.Status {
 	case "can_register":
 		return c.Redirect(h.baseURL + "/register?token=" + token)
 	case "primary":
-		return c.Redirect(h.baseURL + "/login?token=" + token)
+		return c.Redirect(h.baseURL + "/login?token=" + token + tap)
 	case "backup":
-		return c.Redirect(h.baseURL + "/login/backup?token=" + token)
+		return c.Redirect(h.baseURL + "/login/backup?token=" + token + tap)
+	case "tap_required":
+		return c.Redirect(h.baseURL + "/error?reason=tap_required")
 	case "revoked":
 		return c.Redirect(h.baseURL + "/error?reason=card_revoked")
 	case "invalid_token":
 		return c.Redirect(h.baseURL + "/error?reason=invalid_token")
+	case "not_issued":
+		return c.Redirect(h.baseURL + "/error?reason=card_not_issued")
 	case "pair_already_registered":
 		return c.Redirect(h.baseURL + "/error?reason=pair_registered")
 	default:
@@ -111,5 +206,37 @@ func (h *AuthHandler) CardEntry(c *fiber.Ctx) error {
 }
 
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	sessionID := c.Locals("sessionID").(string)
+	if err := h.authSvc.Logout(c.Context(), sessionID); err != nil {
+		return Error(c, err)
+	}
 	return OK(c, fiber.Map{"message": "已登出"})
 }
+
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var req struct {
+		OldPassword  string `json:"old_password"`
+		NewPassword  string `json:"new_password"`
+		NewPublicKey string `json:"new_public_key"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	err := h.authSvc.ChangePassword(c.Context(), service.ChangePasswordInput{
+		UserID:       userID,
+		SessionID:    c.Locals("sessionID").(string),
+		OldPassword:  req.OldPassword,
+		NewPassword:  req.NewPassword,
+		NewPublicKey: req.NewPublicKey,
+	})
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "密碼已變更"})
+}
+
+func clientInfo(c *fiber.Ctx) domain.ClientInfo {
+	return domain.NewClientInfo(c.IP(), c.Get(fiber.HeaderUserAgent))
+}
@@ -1,8 +1,9 @@
 package handler
 
 import (
-	"time"
+	"context"
 
+	"link/internal/domain"
 	"link/internal/service"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,14 +14,25 @@ type Notifier interface {
 	SendTyped(userID string, msgType string, payload interface{}) bool
 }
 
+// MessageDeliverer pushes a stored message to its recipient and confirms it to the sender
+type MessageDeliverer interface {
+	Deliver(ctx context.Context, msg *domain.Message, recipientID string, created bool) *domain.Message
+}
+
 type ConversationHandler struct {
-	convSvc  *service.ConversationService
-	msgSvc   *service.MessageService
-	notifier Notifier
+	convSvc   *service.ConversationService
+	msgSvc    *service.MessageService
+	notifier  Notifier
+	deliverer MessageDeliverer
 }
 
-func NewConversationHandler(convSvc *service.ConversationService, msgSvc *service.MessageService, notifier Notifier) *ConversationHandler {
-	return &ConversationHandler{convSvc: convSvc, msgSvc: msgSvc, notifier: notifier}
+func NewConversationHandler(
+	convSvc *service.ConversationService,
+	msgSvc *service.MessageService,
+	notifier Notifier,
+	deliverer MessageDeliverer,
+) *ConversationHandler {
+	return &ConversationHandler{convSvc: convSvc, msgSvc: msgSvc, notifier: notifier, deliverer: deliverer}
 }
 
 func (h *ConversationHandler) List(c *fiber.Ctx) error {
@@ -37,21 +49,42 @@ func (h *ConversationHandler) Messages(c *fiber.Ctx) error {
 	convID := c.Params("id")
 
 	limit := c.QueryInt("limit", 50)
-	beforeStr := c.Query("before")
+	messages, err := h.msgSvc.GetMessages(c.Context(), userID, convID, limit, c.Query("before"), c.Query("after"))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, messages)
+}
 
-	var before *time.Time
-	if beforeStr != "" {
-		t, err := time.Parse(time.RFC3339, beforeStr)
-		if err == nil {
-			before = &t
-		}
+// SendMessage is the REST counterpart of the realtime msg frame, for clients flushing an offline
+// outbox. Sends are idempotent per temp_id, so a retry returns the original message.
+func (h *ConversationHandler) SendMessage(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var req struct {
+		To               string `json:"to"`
+		EncryptedContent string `json:"encrypted_content"`
+		TempID           string `json:"temp_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
 	}
 
-	messages, err := h.msgSvc.GetMessages(c.Context(), userID, convID, limit, before)
+	msg, created, err := h.msgSvc.Send(c.Context(), userID, req.To, req.EncryptedContent, req.TempID)
 	if err != nil {
 		return Error(c, err)
 	}
-	return OK(c, messages)
+	msg = h.deliverer.Deliver(c.Context(), msg, req.To, created)
+	return OK(c, fiber.Map{"temp_id": req.TempID, "message": msg})
+}
+
+// Sync returns conversation and message changes since the client's cursor
+func (h *ConversationHandler) Sync(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	res, err := h.msgSvc.Sync(c.Context(), userID, c.Query("cursor"), c.QueryInt("limit", 0))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
 }
 
 func (h *ConversationHandler) DeleteMessage(c *fiber.Ctx) error {
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"link/internal/pkg/token"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// KeySet exposes the public half of the JWT keyring
+type KeySet interface {
+	JWKS() *token.JWKSet
+}
+
+type KeysHandler struct {
+	keys KeySet
+}
+
+func NewKeysHandler(keys KeySet) *KeysHandler {
+	return &KeysHandler{keys: keys}
+}
+
+// JWKS serves the verification keys in plain RFC 7517 form so other services can check access tokens
+func (h *KeysHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keys.JWKS())
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"link/internal/domain"
+	"link/internal/pkg/webauthn"
+	"link/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// passkeyCredential is a PublicKeyCredential as serialized by its toJSON(), binary fields base64url encoded
+type passkeyCredential struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// decodeFields base64url-decodes each field in order, failing on the first invalid or empty one
+func decodeFields(fields ...string) ([][]byte, bool) {
+	out := make([][]byte, len(fields))
+	for i, f := range fields {
+		b, err := webauthn.Encoding.DecodeString(f)
+		if err != nil || len(b) == 0 {
+			return nil, false
+		}
+		out[i] = b
+	}
+	return out, true
+}
+
+func (cred *passkeyCredential) assertion() (*webauthn.Assertion, bool) {
+	if cred.Type != "public-key" {
+		return nil, false
+	}
+	b, ok := decodeFields(cred.ID, cred.Response.ClientDataJSON, cred.Response.AuthenticatorData, cred.Response.Signature)
+	if !ok {
+		return nil, false
+	}
+	a := &webauthn.Assertion{CredentialID: b[0], ClientDataJSON: b[1], AuthenticatorData: b[2], Signature: b[3]}
+	if cred.Response.UserHandle != "" {
+		handle, err := webauthn.Encoding.DecodeString(cred.Response.UserHandle)
+		if err != nil {
+			return nil, false
+		}
+		a.UserHandle = handle
+	}
+	return a, true
+}
+
+func (h *AuthHandler) PasskeyLoginOptions(c *fiber.Ctx) error {
+	opts, err := h.passkeySvc.LoginOptions(c.Context())
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, opts)
+}
+
+func (h *AuthHandler) LoginWithPasskey(c *fiber.Ctx) error {
+	var req struct {
+		ChallengeID string            `json:"challenge_id"`
+		Credential  passkeyCredential `json:"credential"`
+		Password    string            `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+	assertion, ok := req.Credential.assertion()
+	if !ok {
+		return Error(c, domain.ErrValidation("無效的通行金鑰回應"))
+	}
+
+	res, err := h.authSvc.LoginWithPasskey(c.Context(), req.ChallengeID, assertion, req.Password, clientInfo(c))
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, res)
+}
+
+func (h *UserHandler) GetMyPasskeys(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	passkeys, err := h.passkeySvc.GetUserPasskeys(c.Context(), userID)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, passkeys)
+}
+
+func (h *UserHandler) PasskeyOptions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	opts, err := h.passkeySvc.RegistrationOptions(c.Context(), userID)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, opts)
+}
+
+func (h *UserHandler) RegisterPasskey(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var req struct {
+		PrimaryToken string            `json:"primary_token"`
+		TapNonce     string            `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
+		Password     string            `json:"password"`
+		ChallengeID  string            `json:"challenge_id"`
+		Name         string            `json:"name"`
+		Credential   passkeyCredential `json:"credential"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+	b, ok := decodeFields(req.Credential.Response.ClientDataJSON, req.Credential.Response.AttestationObject)
+	if !ok || req.Credential.Type != "public-key" {
+		return Error(c, domain.ErrValidation("無效的通行金鑰回應"))
+	}
+
+	passkey, err := h.authSvc.RegisterPasskey(c.Context(), userID, req.PrimaryToken, req.TapNonce, req.Password, service.PasskeyRegistration{
+		ChallengeID:       req.ChallengeID,
+		Name:              req.Name,
+		ClientDataJSON:    b[0],
+		AttestationObject: b[1],
+	})
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, passkey)
+}
+
+func (h *UserHandler) RevokeMyPasskey(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	if err := h.passkeySvc.Revoke(c.Context(), userID, c.Params("id")); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "已撤銷通行金鑰"})
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"time"
 
+	"link/internal/domain"
 	"link/internal/middleware"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,32 +15,86 @@ type Handlers struct {
 	Friend *FriendHandler
 	Conv   *ConversationHandler
 	Admin  *AdminHandler
+	Keys   *KeysHandler
 }
 
 func Setup(app *fiber.App, h *Handlers, authMw fiber.Handler) {
 	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Get("/.well-known/jwks.json", h.Keys.JWKS)
 
 	api := app.Group("/api/v1")
 
 	loginLimiter := middleware.NewRateLimiter(10, time.Minute)
 	registerLimiter := middleware.NewRateLimiter(5, time.Hour)
+	refreshLimiter := middleware.NewRateLimiter(30, time.Minute)
+	exportLimiter := middleware.NewRateLimiter(5, time.Hour)
 
 	api.Get("/auth/check-card/:token", h.Auth.CheckCard)
 	api.Post("/auth/register", registerLimiter.Middleware(), h.Auth.Register)
 	api.Post("/auth/login", loginLimiter.Middleware(), h.Auth.Login)
 	api.Post("/auth/login/backup", loginLimiter.Middleware(), h.Auth.LoginWithBackup)
+	api.Post("/auth/freeze", loginLimiter.Middleware(), h.Auth.Freeze)
+	api.Post("/auth/unfreeze", loginLimiter.Middleware(), h.Auth.Unfreeze)
+	api.Post("/auth/passkey/options", loginLimiter.Middleware(), h.Auth.PasskeyLoginOptions)
+	api.Post("/auth/login/passkey", loginLimiter.Middleware(), h.Auth.LoginWithPasskey)
+	api.Post("/auth/refresh", refreshLimiter.Middleware(), h.Auth.Refresh)
 	app.Get("/w/:token", h.Auth.CardEntry)
+	app.Get("/tap", h.Auth.Tap)
+
+	// Admin routes (before auth middleware group). Admin login has its own, stricter limit.
+	adminLoginLimiter := middleware.NewRateLimiter(5, time.Minute)
+	api.Post("/admin/login", adminLoginLimiter.Middleware(), h.Admin.Login)
 
-	// Admin routes (before auth middleware group)
 	admin := api.Group("/admin", h.Admin.AuthMiddleware())
-	admin.Post("/cards/generate", h.Admin.GenerateCardPair)
-	admin.Get("/cards", h.Admin.ListCardPairs)
-	admin.Delete("/cards/:id", h.Admin.DeleteCardPair)
+	admin.Post("/logout", h.Admin.Logout)
+	admin.Get("/me", h.Admin.Me)
+	admin.Post("/me/totp", h.Admin.SetupTOTP)
+	admin.Post("/me/totp/confirm", h.Admin.ConfirmTOTP)
+
+	cardsRead := h.Admin.Require(domain.AdminPermCardsRead)
+	cardsWrite := h.Admin.Require(domain.AdminPermCardsWrite)
+	admin.Post("/cards/generate", cardsWrite, h.Admin.GenerateCardPair)
+	admin.Get("/cards", cardsRead, h.Admin.ListCardPairs)
+	admin.Delete("/cards/:id", cardsWrite, h.Admin.DeleteCardPair)
+	admin.Post("/cards/:id/revoke", cardsWrite, h.Admin.RevokeCardPair)
+	admin.Post("/cards/tags", cardsWrite, h.Admin.BindCardTag)
+	admin.Post("/inventory/batches", cardsWrite, h.Admin.ManufactureBatch)
+	admin.Post("/inventory/batches/import", cardsWrite, h.Admin.ImportBatch)
+	admin.Get("/inventory/batches/:batchId", cardsRead, h.Admin.GetBatch)
+	admin.Post("/inventory/pairs/:id/issue", cardsWrite, h.Admin.IssuePair)
+	admin.Post("/inventory/pairs/:id/ship", cardsWrite, h.Admin.ShipPair)
+	admin.Post("/inventory/pairs/:id/status", cardsWrite, h.Admin.UpdatePairStatus)
+
+	usersRead := h.Admin.Require(domain.AdminPermUsersRead)
+	usersWrite := h.Admin.Require(domain.AdminPermUsersWrite)
+	admin.Get("/users", usersRead, h.Admin.ListUsers)
+	admin.Get("/users/:id", usersRead, h.Admin.GetUser)
+	admin.Post("/users/:id/suspend", usersWrite, h.Admin.SuspendUser)
+	admin.Post("/users/:id/unsuspend", usersWrite, h.Admin.UnsuspendUser)
+	admin.Post("/users/:id/cards/:cardId/revoke", usersWrite, h.Admin.RevokeUserCard)
+	admin.Post("/users/:id/sessions/revoke", usersWrite, h.Admin.RevokeUserSessions)
+	admin.Post("/users/:id/disconnect", usersWrite, h.Admin.DisconnectUser)
+
+	manageAdmins := h.Admin.Require(domain.AdminPermAdminsManage)
+	admin.Get("/admins", manageAdmins, h.Admin.ListAdmins)
+	admin.Post("/admins", manageAdmins, h.Admin.CreateAdmin)
+	admin.Patch("/admins/:id", manageAdmins, h.Admin.UpdateAdmin)
+	admin.Get("/audit", h.Admin.Require(domain.AdminPermAuditRead), h.Admin.ListAudit)
 
 	auth := api.Group("", authMw)
 	auth.Get("/users/me", h.User.GetMe)
 	auth.Get("/users/me/cards", h.User.GetMyCards)
+	auth.Get("/users/me/cards/history", h.User.GetMyCardHistory)
+	auth.Post("/users/me/cards/backup", loginLimiter.Middleware(), h.User.BindBackupCard)
+	auth.Get("/users/me/passkeys", h.User.GetMyPasskeys)
+	auth.Post("/users/me/passkeys/options", h.User.PasskeyOptions)
+	auth.Post("/users/me/passkeys", loginLimiter.Middleware(), h.User.RegisterPasskey)
+	auth.Delete("/users/me/passkeys/:id", h.User.RevokeMyPasskey)
+	auth.Get("/users/me/sessions", h.User.GetMySessions)
+	auth.Delete("/users/me/sessions/:id", h.User.RevokeMySession)
 	auth.Patch("/users/me", h.User.UpdateMe)
+	auth.Delete("/users/me", loginLimiter.Middleware(), h.User.DeleteMe)
+	auth.Get("/users/me/export", exportLimiter.Middleware(), h.User.ExportMe)
 	auth.Get("/users/search", h.User.Search)
 	auth.Get("/users/:id/public-key", h.User.GetPublicKey)
 
@@ -51,8 +106,11 @@ func Setup(app *fiber.App, h *Handlers, authMw fiber.Handler) {
 	auth.Delete("/friends/:id", h.Friend.Remove)
 
 	auth.Get("/conversations", h.Conv.List)
+	auth.Get("/sync", h.Conv.Sync)
 	auth.Get("/conversations/:id/messages", h.Conv.Messages)
+	auth.Post("/messages", h.Conv.SendMessage)
 	auth.Delete("/messages/:messageId", h.Conv.DeleteMessage)
 
 	auth.Post("/auth/logout", h.Auth.Logout)
+	auth.Post("/auth/password", loginLimiter.Middleware(), h.Auth.ChangePassword)
 }
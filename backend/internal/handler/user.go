@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"bytes"
+	"time"
+
 	"link/internal/domain"
 	"link/internal/service"
 
@@ -8,12 +11,30 @@ import (
 )
 
 type UserHandler struct {
-	userSvc *service.UserService
-	cardSvc *service.CardService
+	userSvc    *service.UserService
+	authSvc    *service.AuthService
+	cardSvc    *service.CardService
+	passkeySvc *service.PasskeyService
+	sessionSvc *service.SessionService
+	exportSvc  *service.ExportService
 }
 
-func NewUserHandler(userSvc *service.UserService, cardSvc *service.CardService) *UserHandler {
-	return &UserHandler{userSvc: userSvc, cardSvc: cardSvc}
+func NewUserHandler(
+	userSvc *service.UserService,
+	authSvc *service.AuthService,
+	cardSvc *service.CardService,
+	passkeySvc *service.PasskeyService,
+	sessionSvc *service.SessionService,
+	exportSvc *service.ExportService,
+) *UserHandler {
+	return &UserHandler{
+		userSvc:    userSvc,
+		authSvc:    authSvc,
+		cardSvc:    cardSvc,
+		passkeySvc: passkeySvc,
+		sessionSvc: sessionSvc,
+		exportSvc:  exportSvc,
+	}
 }
 
 func (h *UserHandler) GetMe(c *fiber.Ctx) error {
@@ -34,6 +55,66 @@ func (h *UserHandler) GetMyCards(c *fiber.Ctx) error {
 	return OK(c, cards)
 }
 
+func (h *UserHandler) GetMyCardHistory(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	events, err := h.cardSvc.GetCardHistory(c.Context(), userID)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, events)
+}
+
+func (h *UserHandler) BindBackupCard(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var req struct {
+		PrimaryToken string `json:"primary_token"`
+		TapNonce     string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
+		Password     string `json:"password"`
+		BackupToken  string `json:"backup_token"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	card, err := h.authSvc.BindBackupCard(c.Context(), userID, req.PrimaryToken, req.TapNonce, req.Password, req.BackupToken)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, card)
+}
+
+// sessionView marks the session the request itself was made with
+type sessionView struct {
+	*domain.Session
+	Current bool `json:"current"`
+}
+
+func (h *UserHandler) GetMySessions(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	currentID := c.Locals("sessionID").(string)
+
+	sessions, err := h.sessionSvc.ListByUser(c.Context(), userID)
+	if err != nil {
+		return Error(c, err)
+	}
+
+	views := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = sessionView{Session: s, Current: s.ID == currentID}
+	}
+	return OK(c, views)
+}
+
+func (h *UserHandler) RevokeMySession(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID := c.Params("id")
+
+	if err := h.sessionSvc.RevokeForUser(c.Context(), userID, sessionID); err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"message": "已登出該裝置"})
+}
+
 func (h *UserHandler) UpdateMe(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	var req struct {
@@ -86,3 +167,39 @@ func (h *UserHandler) GetPublicKey(c *fiber.Ctx) error {
 	}
 	return OK(c, fiber.Map{"public_key": pk})
 }
+
+// DeleteMe schedules the account for deletion. Like binding a backup card it needs a tap of one of
+// the user's cards plus the password. Every session is signed out; logging in again before
+// delete_after cancels the deletion.
+func (h *UserHandler) DeleteMe(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var req struct {
+		CardToken string `json:"card_token"`
+		TapNonce  string `json:"tap_nonce"` // from the redirect of a SUN tap, for cards with a chip
+		Password  string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return Error(c, domain.ErrValidation("invalid request"))
+	}
+
+	deleteAfter, err := h.authSvc.RequestDeletion(c.Context(), userID, req.CardToken, req.TapNonce, req.Password)
+	if err != nil {
+		return Error(c, err)
+	}
+	return OK(c, fiber.Map{"delete_after": deleteAfter})
+}
+
+// ExportMe downloads a zip archive of the user's personal data
+func (h *UserHandler) ExportMe(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	var buf bytes.Buffer
+	if err := h.exportSvc.Export(c.Context(), userID, &buf); err != nil {
+		return Error(c, err)
+	}
+
+	c.Attachment("link-export-" + time.Now().Format("20060102") + ".zip")
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(buf.Bytes())
+}
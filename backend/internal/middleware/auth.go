@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"strings"
 
 	"link/internal/domain"
@@ -9,7 +12,13 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func Auth(tm *token.Manager) fiber.Handler {
+// SessionAuthenticator checks a bearer token and the server-side session behind it
+type SessionAuthenticator interface {
+	Authenticate(ctx context.Context, tokenStr string) (*token.Claims, *domain.Session, error)
+	Touch(ctx context.Context, session *domain.Session, client domain.ClientInfo) error
+}
+
+func Auth(sa SessionAuthenticator) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		auth := c.Get("Authorization")
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
@@ -19,14 +28,43 @@ func Auth(tm *token.Manager) fiber.Handler {
 		}
 
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
-		claims, err := tm.Verify(tokenStr)
+		claims, session, err := sa.Authenticate(c.Context(), tokenStr)
 		if err != nil {
+			appErr, ok := domain.IsAppError(err)
+			if !ok {
+				// Token errors are routine, anything else is the session lookup failing
+				if isTokenError(err) {
+					slog.Debug("rejected bearer token", "error", err)
+				} else {
+					slog.Error("failed to authenticate request", "error", err)
+				}
+				return c.Status(401).JSON(fiber.Map{
+					"error": fiber.Map{"code": domain.ErrCodeUnauthorized, "message": "invalid token"},
+				})
+			}
+			// A suspended account gets its own status so clients can tell it from an expired login
+			if appErr == domain.ErrAccountSuspended {
+				return c.Status(appErr.Status).JSON(fiber.Map{
+					"error": fiber.Map{"code": appErr.Code, "message": appErr.Message},
+				})
+			}
 			return c.Status(401).JSON(fiber.Map{
-				"error": fiber.Map{"code": domain.ErrCodeUnauthorized, "message": err.Error()},
+				"error": fiber.Map{"code": domain.ErrCodeUnauthorized, "message": appErr.Message},
 			})
 		}
 
+		client := domain.NewClientInfo(c.IP(), c.Get(fiber.HeaderUserAgent))
+		if err := sa.Touch(c.Context(), session, client); err != nil {
+			slog.Warn("failed to record session use", "session_id", session.ID, "error", err)
+		}
+
 		c.Locals("userID", claims.UserID)
+		c.Locals("sessionID", session.ID)
 		return c.Next()
 	}
 }
+
+func isTokenError(err error) bool {
+	return errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrExpiredToken) ||
+		errors.Is(err, token.ErrInvalidSignature) || errors.Is(err, token.ErrInvalidAlgorithm)
+}
@@ -0,0 +1,118 @@
+// Package cardbatch defines the signed batch file that cardgen writes for an encoding run
+// and the server imports into its card inventory.
+package cardbatch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Version is the batch file format version
+const Version = 1
+
+var (
+	ErrInvalidFile      = errors.New("invalid card batch file")
+	ErrInvalidSignature = errors.New("invalid card batch signature")
+	ErrUnsupported      = errors.New("unsupported card batch version")
+)
+
+// Batch IDs prefix the printed serial numbers, so they stay short enough to fit on a card
+var batchIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,24}$`)
+
+// macContext separates batch signatures from card token MACs made with the same secret
+const macContext = "link-card-batch-v1"
+
+type Pair struct {
+	SerialNumber string `json:"serial_number"`
+	PrimaryToken string `json:"primary_token"`
+	BackupToken  string `json:"backup_token"`
+}
+
+type Batch struct {
+	Version   int       `json:"version"`
+	BatchID   string    `json:"batch_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Pairs     []Pair    `json:"pairs"`
+}
+
+// file is the on-disk form. The signature covers Batch as compact JSON, so re-indenting the file keeps it valid.
+type file struct {
+	Batch     json.RawMessage `json:"batch"`
+	Signature string          `json:"signature"`
+}
+
+func ValidBatchID(id string) bool {
+	return batchIDPattern.MatchString(id)
+}
+
+// SerialNumber is the printed serial of the i-th pair (0-based) of a batch
+func SerialNumber(batchID string, i int) string {
+	return fmt.Sprintf("%s-%04d", batchID, i+1)
+}
+
+// CardURL is the URL written to a card, served by the backend's /w/:token route
+func CardURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/w/" + token
+}
+
+// Sign serializes b and signs it with an HMAC keyed by secret (the server's CARD_TOKEN_SECRET)
+func Sign(b *Batch, secret string) ([]byte, error) {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(file{
+		Batch:     payload,
+		Signature: base64.RawURLEncoding.EncodeToString(mac(secret, payload)),
+	}, "", "  ")
+}
+
+// Open verifies a signed batch file and returns its contents
+func Open(data []byte, secret string) (*Batch, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil || len(f.Batch) == 0 {
+		return nil, ErrInvalidFile
+	}
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, f.Batch); err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(f.Signature)
+	if err != nil || !hmac.Equal(sig, mac(secret, payload.Bytes())) {
+		return nil, ErrInvalidSignature
+	}
+
+	var b Batch
+	if err := json.Unmarshal(payload.Bytes(), &b); err != nil {
+		return nil, ErrInvalidFile
+	}
+	if b.Version != Version {
+		return nil, ErrUnsupported
+	}
+	if !ValidBatchID(b.BatchID) || len(b.Pairs) == 0 {
+		return nil, ErrInvalidFile
+	}
+	for _, p := range b.Pairs {
+		if p.SerialNumber == "" || p.PrimaryToken == "" || p.BackupToken == "" {
+			return nil, ErrInvalidFile
+		}
+	}
+	return &b, nil
+}
+
+func mac(secret string, payload []byte) []byte {
+	k := hmac.New(sha256.New, []byte(secret))
+	k.Write([]byte(macContext))
+	h := hmac.New(sha256.New, k.Sum(nil))
+	h.Write(payload)
+	return h.Sum(nil)
+}
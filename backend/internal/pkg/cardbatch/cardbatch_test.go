@@ -0,0 +1,86 @@
+package cardbatch
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+const testSecret = "card-batch-test-secret"
+
+func testBatch() *Batch {
+	return &Batch{
+		Version:   Version,
+		BatchID:   "B2026-10",
+		CreatedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Pairs: []Pair{
+			{SerialNumber: SerialNumber("B2026-10", 0), PrimaryToken: "p1", BackupToken: "b1"},
+			{SerialNumber: SerialNumber("B2026-10", 1), PrimaryToken: "p2", BackupToken: "b2"},
+		},
+	}
+}
+
+func TestSignOpen(t *testing.T) {
+	data, err := Sign(testBatch(), testSecret)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	b, err := Open(data, testSecret)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if b.BatchID != "B2026-10" || len(b.Pairs) != 2 || b.Pairs[1].SerialNumber != "B2026-10-0002" {
+		t.Errorf("Open() = %+v", b)
+	}
+}
+
+func TestOpen_Rejects(t *testing.T) {
+	data, _ := Sign(testBatch(), testSecret)
+
+	if _, err := Open(data, "other-secret"); err != ErrInvalidSignature {
+		t.Errorf("Open() with wrong secret error = %v, want %v", err, ErrInvalidSignature)
+	}
+
+	tampered := bytes.Replace(data, []byte(`p2`), []byte(`p3`), 1)
+	if _, err := Open(tampered, testSecret); err != ErrInvalidSignature {
+		t.Errorf("Open() tampered error = %v, want %v", err, ErrInvalidSignature)
+	}
+
+	if _, err := Open([]byte("not json"), testSecret); err != ErrInvalidFile {
+		t.Errorf("Open() garbage error = %v, want %v", err, ErrInvalidFile)
+	}
+
+	future := testBatch()
+	future.Version = Version + 1
+	data, _ = Sign(future, testSecret)
+	if _, err := Open(data, testSecret); err != ErrUnsupported {
+		t.Errorf("Open() future version error = %v, want %v", err, ErrUnsupported)
+	}
+
+	empty := testBatch()
+	empty.Pairs = nil
+	data, _ = Sign(empty, testSecret)
+	if _, err := Open(data, testSecret); err != ErrInvalidFile {
+		t.Errorf("Open() empty batch error = %v, want %v", err, ErrInvalidFile)
+	}
+}
+
+func TestCardURL(t *testing.T) {
+	if got := CardURL("https://link.example/", "abc"); got != "https://link.example/w/abc" {
+		t.Errorf("CardURL() = %q", got)
+	}
+}
+
+func TestValidBatchID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"B2026-10":                  true,
+		"":                          false,
+		"has space":                 false,
+		"abcdefghijklmnopqrstuvwxy": false, // 25 chars
+	} {
+		if got := ValidBatchID(id); got != want {
+			t.Errorf("ValidBatchID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
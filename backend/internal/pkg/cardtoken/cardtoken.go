@@ -4,8 +4,10 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"regexp"
 	"strings"
 )
 
@@ -17,19 +19,75 @@ const (
 	// Legacy types for backward compatibility
 	TypePrimary = "P"
 	TypeBackup  = "B"
+
+	// v2 tokens: v2.{kid}.{pairID}.{type}.{base64url(hmac)}
+	v2Prefix = "v2"
+	v2Sep    = "."
 )
 
 var (
 	ErrInvalidToken = errors.New("invalid card token format")
 	ErrInvalidHMAC  = errors.New("invalid card token signature")
+	ErrUnknownKeyID = errors.New("unknown card token key id")
+	ErrInvalidKey   = errors.New("invalid card token key")
+)
+
+var (
+	keyIDPattern  = regexp.MustCompile(`^[a-z0-9]{1,8}$`)
+	pairIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
 )
 
+// Token is a parsed card token
+type Token struct {
+	Version  int    // 1 = legacy {pairID}-{type}-{hmac[:8]}, 2 = keyed v2
+	KeyID    string // v2 only: selects the secret that signed the token
+	PairID   string
+	CardType string
+}
+
 type Generator struct {
-	secret []byte
+	secret []byte            // legacy (v1) secret
+	keys   map[string][]byte // v2 secrets by key ID
+	kid    string            // key ID that signs new tokens; empty issues v1 tokens
 }
 
 func NewGenerator(secret string) *Generator {
-	return &Generator{secret: []byte(secret)}
+	return &Generator{secret: []byte(secret), keys: make(map[string][]byte)}
+}
+
+// NewKeyedGenerator creates a generator that issues v2 tokens signed with keys[currentKID].
+// Every key in keys stays valid for verification, so a secret can be rotated without reprinting cards.
+// Legacy tokens are still verified with legacySecret.
+func NewKeyedGenerator(legacySecret string, keys map[string]string, currentKID string) (*Generator, error) {
+	g := NewGenerator(legacySecret)
+	for kid, secret := range keys {
+		if !keyIDPattern.MatchString(kid) || secret == "" {
+			return nil, ErrInvalidKey
+		}
+		g.keys[kid] = []byte(secret)
+	}
+	if _, ok := g.keys[currentKID]; !ok {
+		return nil, ErrUnknownKeyID
+	}
+	g.kid = currentKID
+	return g, nil
+}
+
+// ParseKeys parses a "kid:secret" list such as "k1:secret-one,k2:secret-two"
+func ParseKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || !keyIDPattern.MatchString(kid) || secret == "" {
+			return nil, ErrInvalidKey
+		}
+		keys[kid] = secret
+	}
+	return keys, nil
 }
 
 // GeneratePair creates a matched pair of card tokens with neutral types
@@ -40,6 +98,10 @@ func (g *Generator) GeneratePair() (firstToken, secondToken string, err error) {
 		return "", "", err
 	}
 
+	if g.kid != "" {
+		return g.createV2Token(g.kid, pairID, TypeFirst), g.createV2Token(g.kid, pairID, TypeSecond), nil
+	}
+
 	firstToken = g.createToken(pairID, TypeFirst)
 	secondToken = g.createToken(pairID, TypeSecond)
 	return firstToken, secondToken, nil
@@ -51,6 +113,12 @@ func (g *Generator) createToken(pairID, cardType string) string {
 	return pairID + "-" + cardType + "-" + sig[:8]
 }
 
+// createV2Token generates a token: v2.{kid}.{pairID}.{type}.{mac}
+func (g *Generator) createV2Token(kid, pairID, cardType string) string {
+	mac := g.computeV2MAC(g.keys[kid], kid, pairID, cardType)
+	return strings.Join([]string{v2Prefix, kid, pairID, cardType, base64.RawURLEncoding.EncodeToString(mac)}, v2Sep)
+}
+
 // computeHMAC calculates HMAC-SHA256 for pair validation
 func (g *Generator) computeHMAC(pairID, cardType string) string {
 	h := hmac.New(sha256.New, g.secret)
@@ -58,9 +126,69 @@ func (g *Generator) computeHMAC(pairID, cardType string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// computeV2MAC calculates the full-length HMAC-SHA256 of a v2 token.
+// The version and key ID are covered so a token cannot be re-labelled under another key.
+func (g *Generator) computeV2MAC(secret []byte, kid, pairID, cardType string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(strings.Join([]string{v2Prefix, kid, pairID, cardType}, v2Sep)))
+	return h.Sum(nil)
+}
+
 // ParseToken extracts pairID and cardType from a token, validates HMAC
-// Accepts both new format (1/2) and legacy format (P/B)
+// Accepts v2 tokens, the neutral format (1/2) and legacy format (P/B)
 func (g *Generator) ParseToken(token string) (pairID, cardType string, err error) {
+	t, err := g.Parse(token)
+	if err != nil {
+		return "", "", err
+	}
+	return t.PairID, t.CardType, nil
+}
+
+// Parse validates a token of any supported version and returns its fields
+func (g *Generator) Parse(token string) (*Token, error) {
+	if strings.HasPrefix(token, v2Prefix+v2Sep) {
+		return g.parseV2(token)
+	}
+	pairID, cardType, err := g.parseV1(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Version: 1, PairID: pairID, CardType: cardType}, nil
+}
+
+func (g *Generator) parseV2(token string) (*Token, error) {
+	parts := strings.Split(token, v2Sep)
+	if len(parts) != 5 {
+		return nil, ErrInvalidToken
+	}
+	kid, pairID, cardType, sig := parts[1], parts[2], parts[3], parts[4]
+
+	// v2 tokens only use the neutral types; roles are assigned during registration
+	if cardType != TypeFirst && cardType != TypeSecond {
+		return nil, ErrInvalidToken
+	}
+	if !pairIDPattern.MatchString(pairID) {
+		return nil, ErrInvalidToken
+	}
+
+	secret, ok := g.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+
+	// Strict so a MAC with different unused trailing bits is not a second spelling of the same card
+	mac, err := base64.RawURLEncoding.Strict().DecodeString(sig)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(mac, g.computeV2MAC(secret, kid, pairID, cardType)) {
+		return nil, ErrInvalidHMAC
+	}
+
+	return &Token{Version: 2, KeyID: kid, PairID: pairID, CardType: cardType}, nil
+}
+
+func (g *Generator) parseV1(token string) (pairID, cardType string, err error) {
 	parts := strings.Split(token, "-")
 	if len(parts) != 3 {
 		return "", "", ErrInvalidToken
@@ -84,7 +212,7 @@ func (g *Generator) ParseToken(token string) (pairID, cardType string, err error
 	}
 
 	expectedSig := g.computeHMAC(pairID, cardType)
-	if sig != expectedSig[:8] {
+	if !hmac.Equal([]byte(sig), []byte(expectedSig[:8])) {
 		return "", "", ErrInvalidHMAC
 	}
 
@@ -92,12 +220,20 @@ func (g *Generator) ParseToken(token string) (pairID, cardType string, err error
 }
 
 // GetPairedToken returns the paired token for a given token
-// Works with both new (1/2) and legacy (P/B) formats
+// Works with v2, new (1/2) and legacy (P/B) formats; a v2 sibling is signed with the same key ID
 func (g *Generator) GetPairedToken(token string) (string, error) {
-	pairID, cardType, err := g.ParseToken(token)
+	t, err := g.Parse(token)
 	if err != nil {
 		return "", err
 	}
+	pairID, cardType := t.PairID, t.CardType
+
+	if t.Version == 2 {
+		if cardType == TypeFirst {
+			return g.createV2Token(t.KeyID, pairID, TypeSecond), nil
+		}
+		return g.createV2Token(t.KeyID, pairID, TypeFirst), nil
+	}
 
 	switch cardType {
 	case TypeFirst:
@@ -126,7 +262,7 @@ func (g *Generator) IsBackup(token string) bool {
 	return err == nil && cardType == TypeBackup
 }
 
-// IsNeutralFormat checks if token uses the new neutral format (1/2)
+// IsNeutralFormat checks if token uses the new neutral format (1/2), which includes every v2 token
 func (g *Generator) IsNeutralFormat(token string) bool {
 	_, cardType, err := g.ParseToken(token)
 	return err == nil && (cardType == TypeFirst || cardType == TypeSecond)
@@ -134,13 +270,20 @@ func (g *Generator) IsNeutralFormat(token string) bool {
 
 // ArePaired checks if two tokens are a valid pair
 func (g *Generator) ArePaired(token1, token2 string) bool {
-	pairID1, type1, err1 := g.ParseToken(token1)
-	pairID2, type2, err2 := g.ParseToken(token2)
+	t1, err1 := g.Parse(token1)
+	t2, err2 := g.Parse(token2)
 
 	if err1 != nil || err2 != nil {
 		return false
 	}
 
+	// A v2 pair is printed together, so both cards carry the same version and key ID
+	if t1.Version != t2.Version || t1.KeyID != t2.KeyID {
+		return false
+	}
+	pairID1, type1 := t1.PairID, t1.CardType
+	pairID2, type2 := t2.PairID, t2.CardType
+
 	// Must have same pairID and different types
 	// For new format: 1 and 2 are paired
 	// For legacy format: P and B are paired
@@ -16,12 +16,12 @@ func TestGeneratePair(t *testing.T) {
 	t.Logf("Primary: %s", primary)
 	t.Logf("Backup:  %s", backup)
 
-	// Check format
-	if !strings.Contains(primary, "-P-") {
-		t.Errorf("Primary token should contain -P-, got: %s", primary)
+	// Check format (neutral types, roles are assigned at registration)
+	if !strings.Contains(primary, "-1-") {
+		t.Errorf("First token should contain -1-, got: %s", primary)
 	}
-	if !strings.Contains(backup, "-B-") {
-		t.Errorf("Backup token should contain -B-, got: %s", backup)
+	if !strings.Contains(backup, "-2-") {
+		t.Errorf("Second token should contain -2-, got: %s", backup)
 	}
 
 	// Check they share the same pairID
@@ -42,8 +42,8 @@ func TestParseToken(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseToken(primary) failed: %v", err)
 	}
-	if cardType != TypePrimary {
-		t.Errorf("Expected type P, got %s", cardType)
+	if cardType != TypeFirst {
+		t.Errorf("Expected type 1, got %s", cardType)
 	}
 	if pairID == "" {
 		t.Error("pairID should not be empty")
@@ -54,8 +54,8 @@ func TestParseToken(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseToken(backup) failed: %v", err)
 	}
-	if cardType != TypeBackup {
-		t.Errorf("Expected type B, got %s", cardType)
+	if cardType != TypeSecond {
+		t.Errorf("Expected type 2, got %s", cardType)
 	}
 }
 
@@ -133,7 +133,9 @@ func TestArePaired(t *testing.T) {
 func TestIsPrimaryIsBackup(t *testing.T) {
 	g := NewGenerator("test-secret-key")
 
-	primary, backup, _ := g.GeneratePair()
+	// Only legacy P/B tokens carry a role
+	primary := g.createToken("0123456789abcdef", TypePrimary)
+	backup := g.createToken("0123456789abcdef", TypeBackup)
 
 	if !g.IsPrimary(primary) {
 		t.Error("primary should be identified as primary")
@@ -148,3 +150,189 @@ func TestIsPrimaryIsBackup(t *testing.T) {
 		t.Error("primary should NOT be identified as backup")
 	}
 }
+
+func TestIsPrimaryIsBackup_Neutral(t *testing.T) {
+	g := NewGenerator("test-secret-key")
+
+	first, second, _ := g.GeneratePair()
+
+	if g.IsPrimary(first) || g.IsBackup(second) {
+		t.Error("neutral tokens should not carry a role")
+	}
+	if !g.IsNeutralFormat(first) || !g.IsNeutralFormat(second) {
+		t.Error("GeneratePair() tokens should be neutral format")
+	}
+}
+
+func newKeyedGenerator(t *testing.T, kid string) *Generator {
+	t.Helper()
+	g, err := NewKeyedGenerator("test-secret-key", map[string]string{
+		"k1": "first-v2-secret",
+		"k2": "second-v2-secret",
+	}, kid)
+	if err != nil {
+		t.Fatalf("NewKeyedGenerator() error = %v", err)
+	}
+	return g
+}
+
+func TestV2_GeneratePair(t *testing.T) {
+	g := newKeyedGenerator(t, "k2")
+
+	first, second, err := g.GeneratePair()
+	if err != nil {
+		t.Fatalf("GeneratePair() error = %v", err)
+	}
+
+	if !strings.HasPrefix(first, "v2.k2.") || !strings.HasPrefix(second, "v2.k2.") {
+		t.Errorf("v2 tokens should start with v2.k2., got %s / %s", first, second)
+	}
+	if len(first) > 96 {
+		t.Errorf("v2 token should fit the card_token column, got %d chars", len(first))
+	}
+
+	tok, err := g.Parse(first)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if tok.Version != 2 || tok.KeyID != "k2" || tok.CardType != TypeFirst {
+		t.Errorf("Parse() = %+v, want version 2, kid k2, type 1", tok)
+	}
+
+	if !g.ArePaired(first, second) {
+		t.Error("v2 pair should be paired")
+	}
+	paired, err := g.GetPairedToken(first)
+	if err != nil || paired != second {
+		t.Errorf("GetPairedToken() = %s, %v, want %s", paired, err, second)
+	}
+	if !g.IsNeutralFormat(first) {
+		t.Error("v2 tokens should be neutral format")
+	}
+}
+
+func TestV2_RotatedKeyStillVerifies(t *testing.T) {
+	old := newKeyedGenerator(t, "k1")
+	first, second, _ := old.GeneratePair()
+
+	// After rotating to k2, cards signed with k1 must keep working
+	rotated := newKeyedGenerator(t, "k2")
+	if _, _, err := rotated.ParseToken(first); err != nil {
+		t.Errorf("ParseToken() after rotation error = %v", err)
+	}
+	if !rotated.ArePaired(first, second) {
+		t.Error("k1 pair should still be paired after rotation")
+	}
+	paired, _ := rotated.GetPairedToken(second)
+	if paired != first {
+		t.Errorf("GetPairedToken() should keep the original key ID, got %s", paired)
+	}
+}
+
+func TestV2_LegacyTokensStillAccepted(t *testing.T) {
+	legacy := NewGenerator("test-secret-key")
+	first, second, _ := legacy.GeneratePair()
+
+	g := newKeyedGenerator(t, "k1")
+	if _, _, err := g.ParseToken(first); err != nil {
+		t.Errorf("ParseToken(legacy) error = %v", err)
+	}
+	if !g.ArePaired(first, second) {
+		t.Error("legacy pair should still be paired")
+	}
+	paired, err := g.GetPairedToken(first)
+	if err != nil || paired != second {
+		t.Errorf("GetPairedToken(legacy) = %s, %v, want %s", paired, err, second)
+	}
+
+	tok, _ := g.Parse(first)
+	if tok.Version != 1 {
+		t.Errorf("legacy token version = %d, want 1", tok.Version)
+	}
+}
+
+func TestV2_Invalid(t *testing.T) {
+	g := newKeyedGenerator(t, "k1")
+	first, _, _ := g.GeneratePair()
+	parts := strings.Split(first, ".")
+
+	tamperedMAC := []byte(parts[4])
+	if tamperedMAC[0] == 'A' {
+		tamperedMAC[0] = 'B'
+	} else {
+		tamperedMAC[0] = 'A'
+	}
+
+	// The last character of a 32-byte MAC carries two unused bits; flipping one decodes to the same
+	// MAC unless decoding is strict
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	last := len(parts[4]) - 1
+	aliasedMAC := parts[4][:last] + string(alphabet[strings.IndexByte(alphabet, parts[4][last])^1])
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"aliased mac", strings.Join([]string{"v2", "k1", parts[2], parts[3], aliasedMAC}, "."), ErrInvalidToken},
+		{"unknown kid", strings.Join([]string{"v2", "k9", parts[2], parts[3], parts[4]}, "."), ErrUnknownKeyID},
+		{"relabelled kid", strings.Join([]string{"v2", "k2", parts[2], parts[3], parts[4]}, "."), ErrInvalidHMAC},
+		{"tampered mac", strings.Join([]string{"v2", "k1", parts[2], parts[3], string(tamperedMAC)}, "."), ErrInvalidHMAC},
+		{"swapped type", strings.Join([]string{"v2", "k1", parts[2], TypeSecond, parts[4]}, "."), ErrInvalidHMAC},
+		{"legacy type", strings.Join([]string{"v2", "k1", parts[2], TypePrimary, parts[4]}, "."), ErrInvalidToken},
+		{"short mac", strings.Join([]string{"v2", "k1", parts[2], parts[3], parts[4][:12]}, "."), ErrInvalidHMAC},
+		{"missing part", strings.Join(parts[:4], "."), ErrInvalidToken},
+		{"bad pair id", strings.Join([]string{"v2", "k1", "xyz", parts[3], parts[4]}, "."), ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := g.Parse(tt.token); err != tt.wantErr {
+				t.Errorf("Parse(%s) error = %v, want %v", tt.token, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestV2_CrossFormatNotPaired(t *testing.T) {
+	g := newKeyedGenerator(t, "k1")
+	v2First, _, _ := g.GeneratePair()
+	tok, _ := g.Parse(v2First)
+
+	// Same pairID, but a legacy sibling is not part of the v2 pair
+	legacySecond := g.createToken(tok.PairID, TypeSecond)
+	if g.ArePaired(v2First, legacySecond) {
+		t.Error("v2 and legacy tokens should never be paired")
+	}
+
+	// Same pairID signed under another key ID
+	otherKid := g.createV2Token("k2", tok.PairID, TypeSecond)
+	if g.ArePaired(v2First, otherKid) {
+		t.Error("v2 tokens with different key IDs should not be paired")
+	}
+}
+
+func TestNewKeyedGenerator_Invalid(t *testing.T) {
+	if _, err := NewKeyedGenerator("legacy", map[string]string{"k1": "s"}, "k2"); err != ErrUnknownKeyID {
+		t.Errorf("NewKeyedGenerator() with missing current kid error = %v, want %v", err, ErrUnknownKeyID)
+	}
+	if _, err := NewKeyedGenerator("legacy", map[string]string{"K.1": "s"}, "K.1"); err != ErrInvalidKey {
+		t.Errorf("NewKeyedGenerator() with invalid kid error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("k1:secret-one, k2:secret:with:colons")
+	if err != nil {
+		t.Fatalf("ParseKeys() error = %v", err)
+	}
+	if keys["k1"] != "secret-one" || keys["k2"] != "secret:with:colons" {
+		t.Errorf("ParseKeys() = %v", keys)
+	}
+
+	for _, bad := range []string{"k1", "k1:", "K1:secret", "toolongkid:secret"} {
+		if _, err := ParseKeys(bad); err != ErrInvalidKey {
+			t.Errorf("ParseKeys(%q) error = %v, want %v", bad, err, ErrInvalidKey)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Package ndef builds NFC Data Exchange Format messages for writing card URLs onto tags.
+package ndef
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+const (
+	flagMB       = 0x80 // message begin
+	flagME       = 0x40 // message end
+	flagSR       = 0x10 // short record, 1-byte payload length
+	tnfWellKnown = 0x01
+
+	uriType = 'U'
+)
+
+// uriPrefixes are the NFC Forum URI identifier codes worth abbreviating, longest first
+var uriPrefixes = []struct {
+	code   byte
+	prefix string
+}{
+	{0x02, "https://www."},
+	{0x01, "http://www."},
+	{0x04, "https://"},
+	{0x03, "http://"},
+}
+
+// URIRecord returns a single-record NDEF message holding uri as a well-known URI record,
+// ready to be written to a tag as-is
+func URIRecord(uri string) []byte {
+	code := byte(0x00)
+	for _, p := range uriPrefixes {
+		if strings.HasPrefix(uri, p.prefix) {
+			code, uri = p.code, uri[len(p.prefix):]
+			break
+		}
+	}
+	payload := append([]byte{code}, uri...)
+
+	header := byte(flagMB | flagME | tnfWellKnown)
+	msg := make([]byte, 0, 7+len(payload))
+	if len(payload) <= 0xFF {
+		msg = append(msg, header|flagSR, 1, byte(len(payload)))
+	} else {
+		msg = append(msg, header, 1)
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(payload)))
+	}
+	msg = append(msg, uriType)
+	return append(msg, payload...)
+}
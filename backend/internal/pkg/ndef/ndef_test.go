@@ -0,0 +1,50 @@
+package ndef
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestURIRecord(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want []byte
+	}{
+		{
+			"https://link.example/w/abc",
+			append([]byte{0xD1, 0x01, 0x13, 'U', 0x04}, "link.example/w/abc"...),
+		},
+		{
+			"https://www.example.com",
+			append([]byte{0xD1, 0x01, 0x0C, 'U', 0x02}, "example.com"...),
+		},
+		{
+			"http://localhost/w/x",
+			append([]byte{0xD1, 0x01, 0x0E, 'U', 0x03}, "localhost/w/x"...),
+		},
+		{
+			"tel:123",
+			append([]byte{0xD1, 0x01, 0x08, 'U', 0x00}, "tel:123"...),
+		},
+	}
+	for _, tt := range tests {
+		if got := URIRecord(tt.uri); !bytes.Equal(got, tt.want) {
+			t.Errorf("URIRecord(%q) = % x, want % x", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestURIRecord_LongRecord(t *testing.T) {
+	uri := "https://" + strings.Repeat("a", 300)
+	got := URIRecord(uri)
+
+	// No SR flag, 4-byte payload length of 301 (identifier code + 300 bytes)
+	wantHeader := []byte{0xC1, 0x01, 0x00, 0x00, 0x01, 0x2D, 'U', 0x04}
+	if !bytes.Equal(got[:len(wantHeader)], wantHeader) {
+		t.Errorf("URIRecord() header = % x, want % x", got[:len(wantHeader)], wantHeader)
+	}
+	if len(got) != len(wantHeader)+300 {
+		t.Errorf("URIRecord() length = %d, want %d", len(got), len(wantHeader)+300)
+	}
+}
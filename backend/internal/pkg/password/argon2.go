@@ -6,27 +6,37 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"runtime"
+	"strconv"
 	"strings"
 
 	"golang.org/x/crypto/argon2"
 )
 
 type Params struct {
-	Memory      uint32
+	Memory      uint32 // KiB
 	Iterations  uint32
 	Parallelism uint8
 	SaltLength  uint32
 	KeyLength   uint32
 }
 
-var ErrInvalidHash = errors.New("invalid hash format")
+var (
+	ErrInvalidHash   = errors.New("invalid hash format")
+	ErrInvalidParams = errors.New("invalid argon2 parameters")
+)
+
+const (
+	minSaltLength = 8
+	minKeyLength  = 16
+)
 
+// DefaultParams follows the OWASP argon2id baseline. Parallelism is fixed rather than
+// tied to the CPU count so hashes do not depend on the machine that created them.
 func DefaultParams() *Params {
 	return &Params{
 		Memory:      64 * 1024, // 64 MB
 		Iterations:  3,
-		Parallelism: uint8(runtime.NumCPU()),
+		Parallelism: 2,
 		SaltLength:  16,
 		KeyLength:   32,
 	}
@@ -34,6 +44,25 @@ func DefaultParams() *Params {
 
 var params = DefaultParams()
 
+// SetParams changes the parameters used by Hash and NeedsRehash. Call it once at startup.
+func SetParams(p *Params) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	cp := *p
+	params = &cp
+	return nil
+}
+
+func (p *Params) validate() error {
+	if p.Iterations == 0 || p.Parallelism == 0 ||
+		p.Memory < 8*uint32(p.Parallelism) ||
+		p.SaltLength < minSaltLength || p.KeyLength < minKeyLength {
+		return ErrInvalidParams
+	}
+	return nil
+}
+
 func Hash(password string) (string, error) {
 	salt := make([]byte, params.SaltLength)
 	if _, err := rand.Read(salt); err != nil {
@@ -61,19 +90,73 @@ func Hash(password string) (string, error) {
 }
 
 func Verify(password, encoded string) (bool, error) {
+	p, salt, expectedHash, err := decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return subtle.ConstantTimeCompare(hash, expectedHash) == 1, nil
+}
+
+// NeedsRehash reports whether a hash was made with parameters other than the current ones.
+// Malformed hashes always need rehashing.
+func NeedsRehash(encoded string) bool {
+	p, _, _, err := decode(encoded)
+	if err != nil {
+		return true
+	}
+	return *p != *params
+}
+
+// decode parses "$argon2id$v=19$m=65536,t=3,p=2$salt$hash"
+func decode(encoded string) (*Params, []byte, []byte, error) {
 	parts := strings.Split(encoded, "$")
-	if len(parts) != 6 || parts[1] != "argon2id" {
-		return false, ErrInvalidHash
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrInvalidHash
 	}
 
-	var memory, iterations uint32
-	var parallelism uint8
-	_, _ = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism)
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, nil, nil, ErrInvalidHash
+	}
+
+	fields := strings.Split(parts[3], ",")
+	if len(fields) != 3 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	memory, err1 := parseField(fields[0], "m=", 32)
+	iterations, err2 := parseField(fields[1], "t=", 32)
+	parallelism, err3 := parseField(fields[2], "p=", 8)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
 
-	salt, _ := base64.RawStdEncoding.DecodeString(parts[4])
-	expectedHash, _ := base64.RawStdEncoding.DecodeString(parts[5])
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	hash, err := base64.RawStdEncoding.Strict().DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
 
-	hash := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(expectedHash)))
+	p := &Params{
+		Memory:      uint32(memory),
+		Iterations:  uint32(iterations),
+		Parallelism: uint8(parallelism),
+		SaltLength:  uint32(len(salt)),
+		KeyLength:   uint32(len(hash)),
+	}
+	if err := p.validate(); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	return p, salt, hash, nil
+}
 
-	return subtle.ConstantTimeCompare(hash, expectedHash) == 1, nil
+func parseField(s, prefix string, bits int) (uint64, error) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, ErrInvalidHash
+	}
+	return strconv.ParseUint(s[len(prefix):], 10, bits)
 }
@@ -145,6 +145,95 @@ func TestDefaultParams(t *testing.T) {
 	if p.KeyLength != 32 {
 		t.Errorf("DefaultParams().KeyLength = %d, want %d", p.KeyLength, 32)
 	}
+
+	if p.Parallelism != 2 {
+		t.Errorf("DefaultParams().Parallelism = %d, want %d", p.Parallelism, 2)
+	}
+}
+
+func TestVerify_MalformedHash(t *testing.T) {
+	valid, _ := Hash("password")
+	parts := strings.Split(valid, "$")
+	with := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"wrong algorithm", with(1, "argon2i")},
+		{"wrong version", with(2, "v=16")},
+		{"non-numeric params", with(3, "m=abc,t=3,p=2")},
+		{"missing param", with(3, "m=65536,t=3")},
+		{"trailing garbage", with(3, "m=65536,t=3,p=2x")},
+		{"zero iterations", with(3, "m=65536,t=0,p=2")},
+		{"parallelism overflow", with(3, "m=65536,t=3,p=256")},
+		{"bad salt encoding", with(4, "!!!")},
+		{"short salt", with(4, "YWJj")},
+		{"bad hash encoding", with(5, "!!!")},
+		{"empty hash", with(5, "")},
+		{"leading text", "x" + valid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify("password", tt.hash); err != ErrInvalidHash {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidHash)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	defer SetParams(DefaultParams())
+
+	hash, _ := Hash("password")
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for hash made with current params")
+	}
+	if !NeedsRehash("invalid-hash-format") {
+		t.Error("NeedsRehash() = false for malformed hash")
+	}
+
+	stronger := DefaultParams()
+	stronger.Iterations = 4
+	if err := SetParams(stronger); err != nil {
+		t.Fatalf("SetParams() error = %v", err)
+	}
+	if !NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false after params changed")
+	}
+
+	// Old hashes keep verifying after the upgrade
+	if ok, err := Verify("password", hash); err != nil || !ok {
+		t.Errorf("Verify() = %v, %v, want true after params changed", ok, err)
+	}
+}
+
+func TestSetParams_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *Params)
+	}{
+		{"zero iterations", func(p *Params) { p.Iterations = 0 }},
+		{"zero parallelism", func(p *Params) { p.Parallelism = 0 }},
+		{"memory below 8*p", func(p *Params) { p.Memory = 8 }},
+		{"short salt", func(p *Params) { p.SaltLength = 4 }},
+		{"short key", func(p *Params) { p.KeyLength = 8 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultParams()
+			tt.modify(p)
+			if err := SetParams(p); err != ErrInvalidParams {
+				t.Errorf("SetParams() error = %v, want %v", err, ErrInvalidParams)
+			}
+		})
+	}
 }
 
 func BenchmarkHash(b *testing.B) {
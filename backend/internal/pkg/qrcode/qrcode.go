@@ -0,0 +1,442 @@
+// Package qrcode encodes short byte strings (such as card URLs) as QR codes, model 2,
+// versions 1-10, byte mode. It follows ISO/IEC 18004 and renders to SVG for print.
+package qrcode
+
+import (
+	"errors"
+)
+
+var ErrTooLong = errors.New("data too long for a version 10 QR code")
+
+// Level is the error correction level
+type Level int
+
+const (
+	Low      Level = iota // ~7% recovery
+	Medium                // ~15% recovery
+	Quartile              // ~25% recovery
+	High                  // ~30% recovery
+)
+
+// formatBits are the two EC level bits of the format information
+var formatBits = [4]int{Low: 1, Medium: 0, Quartile: 3, High: 2}
+
+// blockLayout describes how the codewords of one version/level are split into blocks
+type blockLayout struct {
+	ecPerBlock    int
+	group1, data1 int // blocks in group 1 and data codewords per block
+	group2, data2 int // group 2 blocks carry one more data codeword
+}
+
+// blockLayouts[version-1][level]
+var blockLayouts = [10][4]blockLayout{
+	{{7, 1, 19, 0, 0}, {10, 1, 16, 0, 0}, {13, 1, 13, 0, 0}, {17, 1, 9, 0, 0}},
+	{{10, 1, 34, 0, 0}, {16, 1, 28, 0, 0}, {22, 1, 22, 0, 0}, {28, 1, 16, 0, 0}},
+	{{15, 1, 55, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 17, 0, 0}, {22, 2, 13, 0, 0}},
+	{{20, 1, 80, 0, 0}, {18, 2, 32, 0, 0}, {26, 2, 24, 0, 0}, {16, 4, 9, 0, 0}},
+	{{26, 1, 108, 0, 0}, {24, 2, 43, 0, 0}, {18, 2, 15, 2, 16}, {22, 2, 11, 2, 12}},
+	{{18, 2, 68, 0, 0}, {16, 4, 27, 0, 0}, {24, 4, 19, 0, 0}, {28, 4, 15, 0, 0}},
+	{{20, 2, 78, 0, 0}, {18, 4, 31, 0, 0}, {18, 2, 14, 4, 15}, {26, 4, 13, 1, 14}},
+	{{24, 2, 97, 0, 0}, {22, 2, 38, 2, 39}, {22, 4, 18, 2, 19}, {26, 4, 14, 2, 15}},
+	{{30, 2, 116, 0, 0}, {22, 3, 36, 2, 37}, {20, 4, 16, 4, 17}, {24, 4, 12, 4, 13}},
+	{{18, 2, 68, 2, 69}, {26, 4, 43, 1, 44}, {24, 6, 19, 2, 20}, {28, 6, 15, 2, 16}},
+}
+
+// alignmentCenters[version-1] lists the row/column centers of the alignment patterns
+var alignmentCenters = [10][]int{
+	nil,
+	{6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+func (b blockLayout) dataCodewords() int {
+	return b.group1*b.data1 + b.group2*b.data2
+}
+
+// Code is an encoded QR symbol. Modules are addressed by column x and row y.
+type Code struct {
+	Version int
+	Size    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode builds the smallest QR code that holds data at the given error correction level
+func Encode(data []byte, level Level) (*Code, error) {
+	version, layout := 0, blockLayout{}
+	for v := 1; v <= len(blockLayouts); v++ {
+		l := blockLayouts[v-1][level]
+		if 4+charCountBits(v)+8*len(data) <= 8*l.dataCodewords() {
+			version, layout = v, l
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(encodeData(data, version, layout.dataCodewords()), layout)
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(level, mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // XOR again to undo
+	}
+	c.applyMask(best)
+	c.drawFormatBits(level, best)
+	return c, nil
+}
+
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData builds the byte-mode segment, then terminates and pads it to capacity codewords
+func encodeData(data []byte, version, capacity int) []byte {
+	var bb bitBuffer
+	bb.append(0b0100, 4)
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacityBits := capacity * 8
+	bb.append(0, min(4, capacityBits-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacityBits; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords and interleaves the result
+func addErrorCorrection(data []byte, layout blockLayout) []byte {
+	divisor := rsDivisor(layout.ecPerBlock)
+
+	var blocks, ecc [][]byte
+	for i, off := 0, 0; i < layout.group1+layout.group2; i++ {
+		n := layout.data1
+		if i >= layout.group1 {
+			n = layout.data2
+		}
+		block := data[off : off+n]
+		off += n
+		blocks = append(blocks, block)
+		ecc = append(ecc, rsRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+len(blocks)*layout.ecPerBlock)
+	for i := 0; i < max(layout.data1, layout.data2); i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				result = append(result, b[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, e := range ecc {
+			result = append(result, e[i])
+		}
+	}
+	return result
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size}
+	c.modules = make([][]bool, size)
+	c.isFunction = make([][]bool, size)
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	return c
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	centers := alignmentCenters[c.Version-1]
+	last := len(centers) - 1
+	for i, y := range centers {
+		for j, x := range centers {
+			// Skip the three positions covered by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen
+	c.drawFormatBits(Medium, 0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator around center (x, y)
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func (c *Code) drawFormatBits(level Level, mask int) {
+	bits := formatInfo(level, mask)
+
+	// Around the top-left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// Split between the other two finders
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // the dark module
+}
+
+// formatInfo returns the 15-bit BCH-protected, masked format information
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawVersion draws the two 6x3 version blocks required from version 7 on
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// versionInfo returns the 18-bit BCH-protected version information
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// drawCodewords fills the data area in the two-column zigzag, bottom-right first
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = bit(int(data[i>>3]), 7-i&7)
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskBit(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores a masked symbol with the four rules of ISO/IEC 18004 section 7.8.3
+func (c *Code) penalty() int {
+	n := c.Size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	score := 0
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			// Rule 1: runs of five or more modules of the same color
+			run := 1
+			for x := 1; x < n; x++ {
+				if at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				score += run - 2
+			}
+
+			// Rule 3: 1:1:3:1:1 finder-like patterns with four light modules on one side
+			for x := 0; x+11 <= n; x++ {
+				if matchesFinderLike(func(i int) bool { return at(x+i, y, transpose) }) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// Rule 2: 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	// Rule 4: deviation of the dark proportion from 50%, in 5% steps
+	total := n * n
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	score += k * 10
+	return score
+}
+
+var (
+	finderLikeBefore = [11]bool{false, false, false, false, true, false, true, true, true, false, true}
+	finderLikeAfter  = [11]bool{true, false, true, true, true, false, true, false, false, false, false}
+)
+
+func matchesFinderLike(at func(int) bool) bool {
+	before, after := true, true
+	for i := 0; i < 11; i++ {
+		v := at(i)
+		before = before && v == finderLikeBefore[i]
+		after = after && v == finderLikeAfter[i]
+	}
+	return before || after
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, bit(val, i))
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, v := range b {
+		if v {
+			out[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return out
+}
+
+func bit(x, i int) bool {
+	return (x>>i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,213 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder_KnownVector(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example in ISO/IEC 18004 Annex I
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := rsRemainder(data, rsDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatInfo(t *testing.T) {
+	tests := []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{Medium, 0, 0b101010000010010},
+		{Low, 4, 0b110011000101111},
+		{Quartile, 0, 0b011010101011111},
+		{High, 0, 0b001011010001001},
+	}
+	for _, tt := range tests {
+		if got := formatInfo(tt.level, tt.mask); got != tt.want {
+			t.Errorf("formatInfo(%d, %d) = %015b, want %015b", tt.level, tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	if got := versionInfo(7); got != 0b000111110010010100 {
+		t.Errorf("versionInfo(7) = %018b", got)
+	}
+}
+
+func TestEncode_VersionSelection(t *testing.T) {
+	tests := []struct {
+		n       int
+		level   Level
+		version int
+	}{
+		{14, Medium, 1},
+		{15, Medium, 2},
+		{17, Low, 1},
+		{106, Medium, 6},
+		{107, Medium, 7},
+		{213, Medium, 10},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.n), tt.level)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) error = %v", tt.n, err)
+		}
+		if c.Version != tt.version || c.Size != tt.version*4+17 {
+			t.Errorf("Encode(%d bytes) version = %d size = %d, want version %d", tt.n, c.Version, c.Size, tt.version)
+		}
+	}
+
+	if _, err := Encode(bytes.Repeat([]byte("a"), 214), Medium); err != ErrTooLong {
+		t.Errorf("Encode(214 bytes) error = %v, want %v", err, ErrTooLong)
+	}
+}
+
+func TestEncode_FunctionPatterns(t *testing.T) {
+	c, err := Encode([]byte("https://localhost:5173/w/0123456789abcdef-1-deadbeef"), Medium)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	finder := []string{
+		"1111111",
+		"1000001",
+		"1011101",
+		"1011101",
+		"1011101",
+		"1000001",
+		"1111111",
+	}
+	for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		for dy, row := range finder {
+			for dx, ch := range row {
+				if c.Dark(corner[0]+dx, corner[1]+dy) != (ch == '1') {
+					t.Fatalf("finder at %v wrong at (%d, %d)", corner, dx, dy)
+				}
+			}
+		}
+	}
+
+	for i := 8; i < c.Size-8; i++ {
+		if c.Dark(i, 6) != (i%2 == 0) || c.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing pattern wrong at %d", i)
+		}
+	}
+	if !c.Dark(8, c.Size-8) {
+		t.Error("dark module missing")
+	}
+}
+
+// TestEncode_ReadBack decodes the symbol's own modules and checks they hold the expected codewords
+func TestEncode_ReadBack(t *testing.T) {
+	for _, input := range []string{
+		"HELLO",
+		"https://link.example.com/w/v2.k1.0123456789abcdef.1.c2lnbmF0dXJlLXNpZ25hdHVyZS1zaWduYXR1cmUtMDE",
+		strings.Repeat("x", 200),
+	} {
+		c, err := Encode([]byte(input), Medium)
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+
+		// Both copies of the format information must agree and decode to level M
+		var first, second int
+		for i := 0; i <= 5; i++ {
+			first |= b2i(c.Dark(8, i)) << i
+		}
+		first |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+		for i := 9; i < 15; i++ {
+			first |= b2i(c.Dark(14-i, 8)) << i
+		}
+		for i := 0; i < 8; i++ {
+			second |= b2i(c.Dark(c.Size-1-i, 8)) << i
+		}
+		for i := 8; i < 15; i++ {
+			second |= b2i(c.Dark(8, c.Size-15+i)) << i
+		}
+		if first != second {
+			t.Fatalf("format copies differ: %015b vs %015b", first, second)
+		}
+		mask := -1
+		for m := 0; m < 8; m++ {
+			if formatInfo(Medium, m) == first {
+				mask = m
+			}
+		}
+		if mask < 0 {
+			t.Fatalf("format info %015b is not a level M pattern", first)
+		}
+
+		if c.Version >= 7 {
+			var v int
+			for i := 0; i < 18; i++ {
+				v |= b2i(c.Dark(c.Size-11+i%3, i/3)) << i
+			}
+			if v != versionInfo(c.Version) {
+				t.Errorf("version info = %018b, want %018b", v, versionInfo(c.Version))
+			}
+		}
+
+		layout := blockLayouts[c.Version-1][Medium]
+		want := addErrorCorrection(encodeData([]byte(input), c.Version, layout.dataCodewords()), layout)
+
+		var got bitBuffer
+		for right := c.Size - 1; right >= 1; right -= 2 {
+			if right == 6 {
+				right = 5
+			}
+			for vert := 0; vert < c.Size; vert++ {
+				for j := 0; j < 2; j++ {
+					x, y := right-j, vert
+					if (right+1)&2 == 0 {
+						y = c.Size - 1 - vert
+					}
+					if !c.isFunction[y][x] {
+						got = append(got, c.Dark(x, y) != maskBit(mask, x, y))
+					}
+				}
+			}
+		}
+		if !bytes.Equal(got.bytes()[:len(want)], want) {
+			t.Errorf("Encode(%q) codewords do not read back", input)
+		}
+	}
+}
+
+func TestEncodeData_Padding(t *testing.T) {
+	got := encodeData([]byte("ab"), 1, 16)
+	// mode 0100, count 00000010, "a" "b", terminator 0000, then alternating pad bytes
+	want := []byte{0x40, 0x26, 0x16, 0x20, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeData() = % x, want % x", got, want)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	c, _ := Encode([]byte("hello"), Medium)
+	svg := string(c.SVG(4))
+
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("SVG() is not a standalone svg element")
+	}
+	if !strings.Contains(svg, `viewBox="0 0 29 29"`) || !strings.Contains(svg, `width="116"`) {
+		t.Errorf("SVG() size wrong: %s", svg[:120])
+	}
+	// Top-left finder corner sits just inside the quiet zone
+	if !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Error("SVG() missing the first finder module")
+	}
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
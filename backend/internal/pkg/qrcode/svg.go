@@ -0,0 +1,32 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// quietZone is the light border, in modules, that scanners need around the symbol
+const quietZone = 4
+
+// SVG renders the code as a standalone SVG image, moduleSize user units per module
+func (c *Code) SVG(moduleSize int) []byte {
+	if moduleSize < 1 {
+		moduleSize = 1
+	}
+	dim := c.Size + 2*quietZone
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`,
+		dim, dim, dim*moduleSize, dim*moduleSize)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, dim, dim)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,78 @@
+package sun
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+const blockSize = aes.BlockSize
+
+// rb is the constant used when deriving CMAC subkeys for 128-bit block ciphers (RFC 4493)
+const rb = 0x87
+
+// CMAC computes AES-CMAC (RFC 4493 / NIST SP 800-38B) of msg under key
+func CMAC(key, msg []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return cmac(block, msg), nil
+}
+
+func cmac(block cipher.Block, msg []byte) []byte {
+	k1, k2 := subkeys(block)
+
+	n := (len(msg) + blockSize - 1) / blockSize
+	complete := n > 0 && len(msg)%blockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, blockSize)
+	if complete {
+		copy(last, msg[(n-1)*blockSize:])
+		xor(last, k1)
+	} else {
+		rest := msg[(n-1)*blockSize:]
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xor(last, k2)
+	}
+
+	x := make([]byte, blockSize)
+	for i := 0; i < n-1; i++ {
+		xor(x, msg[i*blockSize:(i+1)*blockSize])
+		block.Encrypt(x, x)
+	}
+	xor(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+func subkeys(block cipher.Block) (k1, k2 []byte) {
+	l := make([]byte, blockSize)
+	block.Encrypt(l, l)
+	k1 = shiftLeft(l)
+	k2 = shiftLeft(k1)
+	return k1, k2
+}
+
+// shiftLeft returns b << 1, xored with rb when the most significant bit was set
+func shiftLeft(b []byte) []byte {
+	out := make([]byte, len(b))
+	var carry byte
+	for i := len(b) - 1; i >= 0; i-- {
+		out[i] = b[i]<<1 | carry
+		carry = b[i] >> 7
+	}
+	if carry == 1 {
+		out[len(out)-1] ^= rb
+	}
+	return out
+}
+
+func xor(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,75 @@
+package sun
+
+import (
+	"crypto/aes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const divConstAES128 = 0x01
+
+var ErrInvalidDivInput = errors.New("diversification input too long")
+
+// DiversifyKey derives a card key from a master key as described in NXP AN10922 (AES-128).
+// The diversification input is UID || systemID and must not exceed 31 bytes.
+func DiversifyKey(masterKey, uid, systemID []byte) ([]byte, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	m := make([]byte, 0, 2*blockSize)
+	m = append(m, divConstAES128)
+	m = append(m, uid...)
+	m = append(m, systemID...)
+	if len(m) > 2*blockSize {
+		return nil, ErrInvalidDivInput
+	}
+
+	// Unlike plain CMAC, AN10922 always pads the input to two full blocks
+	k1, k2 := subkeys(block)
+	d := make([]byte, 2*blockSize)
+	copy(d, m)
+	if len(m) < len(d) {
+		d[len(m)] = 0x80
+		xor(d[blockSize:], k2)
+	} else {
+		xor(d[blockSize:], k1)
+	}
+
+	x := make([]byte, blockSize)
+	for i := 0; i < len(d); i += blockSize {
+		xor(x, d[i:i+blockSize])
+		block.Encrypt(x, x)
+	}
+	return x, nil
+}
+
+// ParseMasterKeys parses a "version:hexkey" list such as "1:00112233...,2:44556677..."
+func ParseMasterKeys(s string) (map[int][]byte, error) {
+	keys := make(map[int][]byte)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ver, keyHex, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		v, err := strconv.Atoi(ver)
+		if err != nil || v <= 0 || v > 255 {
+			return nil, ErrInvalidKey
+		}
+		key, err := parseKey(keyHex)
+		if err != nil {
+			return nil, err
+		}
+		keys[v] = key
+	}
+	if len(keys) == 0 {
+		return nil, ErrInvalidKey
+	}
+	return keys, nil
+}
@@ -0,0 +1,59 @@
+package sun
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const maxCounter = 0xFFFFFF
+
+var ErrCounterExhausted = errors.New("SUN read counter exhausted")
+
+// Emulator is a software NTAG 424 DNA that produces SUN messages the way a real card does.
+// It is meant for provisioning tools and tests; FileKey is the card's (diversified) SDMFileReadKey.
+type Emulator struct {
+	UID     []byte
+	MetaKey []byte
+	FileKey []byte
+	Counter uint32
+}
+
+// Tap increments the read counter and returns the hex picc_data and cmac mirrored into the URL
+func (e *Emulator) Tap() (piccData, cmac string, err error) {
+	if len(e.UID) != UIDLength {
+		return "", "", ErrInvalidPICCData
+	}
+	if e.Counter >= maxCounter {
+		return "", "", ErrCounterExhausted
+	}
+	e.Counter++
+
+	plain := make([]byte, piccLength)
+	plain[0] = tagUIDMirror | tagCtrMirror | UIDLength
+	copy(plain[1:], e.UID)
+	plain[1+UIDLength] = byte(e.Counter)
+	plain[2+UIDLength] = byte(e.Counter >> 8)
+	plain[3+UIDLength] = byte(e.Counter >> 16)
+	// The card fills the rest of the block with random bytes
+	if _, err := rand.Read(plain[4+UIDLength:]); err != nil {
+		return "", "", err
+	}
+
+	block, err := aes.NewCipher(e.MetaKey)
+	if err != nil {
+		return "", "", ErrInvalidKey
+	}
+	enc := make([]byte, piccLength)
+	cipher.NewCBCEncrypter(block, make([]byte, blockSize)).CryptBlocks(enc, plain)
+
+	mac, err := ComputeMAC(e.FileKey, e.UID, e.Counter)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.ToUpper(hex.EncodeToString(enc)), strings.ToUpper(hex.EncodeToString(mac)), nil
+}
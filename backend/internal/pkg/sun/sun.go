@@ -0,0 +1,194 @@
+// Package sun verifies NTAG 424 DNA Secure Unique NFC (SUN) messages.
+//
+// On every tap the card mirrors two values into its NDEF URL:
+//   - picc_data: AES-128-CBC encrypted PICCDataTag || UID || SDMReadCtr (SDMMetaReadKey)
+//   - cmac:      truncated AES-CMAC under a session key derived from SDMFileReadKey
+//
+// See NXP AN12196 for the full derivation and AN10922 for per-card key diversification.
+package sun
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	UIDLength  = 7
+	KeyLength  = 16
+	MACLength  = 8
+	piccLength = 16
+
+	// PICCDataTag bits
+	tagUIDMirror = 0x80
+	tagCtrMirror = 0x40
+	tagUIDLength = 0x0F
+)
+
+var (
+	ErrInvalidKey        = errors.New("invalid SUN key")
+	ErrInvalidPICCData   = errors.New("invalid SUN picc data")
+	ErrInvalidCMAC       = errors.New("invalid SUN cmac")
+	ErrMissingMirroring  = errors.New("SUN message must mirror both UID and counter")
+	ErrUnknownKeyVersion = errors.New("unknown SUN key version")
+)
+
+// svMAC is the session vector prefix for KSesSDMFileReadMAC (AN12196 §3.3)
+var svMAC = []byte{0x3C, 0xC3, 0x00, 0x01, 0x00, 0x80}
+
+// Tap is the UID and read counter carried by a SUN message
+type Tap struct {
+	UID     []byte
+	Counter uint32
+}
+
+// UIDHex returns the card UID as upper-case hex, the form stored in card_tags
+func (t *Tap) UIDHex() string {
+	return strings.ToUpper(hex.EncodeToString(t.UID))
+}
+
+// Verifier checks SUN messages from cards personalized with diversified keys.
+// All cards share the SDMMetaReadKey so the UID can be recovered before the card key is known;
+// each card's SDMFileReadKey is DiversifyKey(masterKeys[version], UID, systemID).
+type Verifier struct {
+	metaKey    []byte
+	masterKeys map[int][]byte
+	current    int
+	systemID   []byte
+}
+
+func NewVerifier(metaKeyHex string, masterKeys map[int][]byte, systemID string) (*Verifier, error) {
+	metaKey, err := parseKey(metaKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(masterKeys) == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	v := &Verifier{metaKey: metaKey, masterKeys: make(map[int][]byte), systemID: []byte(systemID)}
+	for ver, key := range masterKeys {
+		if len(key) != KeyLength {
+			return nil, ErrInvalidKey
+		}
+		v.masterKeys[ver] = key
+		if ver > v.current {
+			v.current = ver
+		}
+	}
+	return v, nil
+}
+
+// KeyVersion returns the newest master key version, used when personalizing new cards
+func (v *Verifier) KeyVersion() int { return v.current }
+
+// CardKey returns the diversified SDMFileReadKey of a card
+func (v *Verifier) CardKey(uid []byte, version int) ([]byte, error) {
+	master, ok := v.masterKeys[version]
+	if !ok {
+		return nil, ErrUnknownKeyVersion
+	}
+	return DiversifyKey(master, uid, v.systemID)
+}
+
+// Decrypt recovers the UID and read counter from picc_data. The result is not authenticated
+// until CheckMAC succeeds.
+func (v *Verifier) Decrypt(piccDataHex string) (*Tap, error) {
+	return DecryptPICCData(v.metaKey, piccDataHex)
+}
+
+// CheckMAC verifies the SDM MAC of a decrypted tap against the card key of the given version.
+// Replay protection (counter must increase) is the caller's responsibility.
+func (v *Verifier) CheckMAC(tap *Tap, cmacHex string, version int) error {
+	mac, err := hex.DecodeString(cmacHex)
+	if err != nil || len(mac) != MACLength {
+		return ErrInvalidCMAC
+	}
+
+	cardKey, err := v.CardKey(tap.UID, version)
+	if err != nil {
+		return err
+	}
+
+	expected, err := ComputeMAC(cardKey, tap.UID, tap.Counter)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(mac, expected) != 1 {
+		return ErrInvalidCMAC
+	}
+	return nil
+}
+
+// DecryptPICCData decrypts the encrypted PICC data with the SDMMetaReadKey
+func DecryptPICCData(metaKey []byte, piccDataHex string) (*Tap, error) {
+	data, err := hex.DecodeString(piccDataHex)
+	if err != nil || len(data) != piccLength {
+		return nil, ErrInvalidPICCData
+	}
+
+	block, err := aes.NewCipher(metaKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	plain := make([]byte, piccLength)
+	cipher.NewCBCDecrypter(block, make([]byte, blockSize)).CryptBlocks(plain, data)
+
+	tag := plain[0]
+	if tag&tagUIDMirror == 0 || tag&tagCtrMirror == 0 {
+		return nil, ErrMissingMirroring
+	}
+	if int(tag&tagUIDLength) != UIDLength {
+		return nil, ErrInvalidPICCData
+	}
+
+	uid := make([]byte, UIDLength)
+	copy(uid, plain[1:1+UIDLength])
+	ctr := plain[1+UIDLength : 1+UIDLength+3]
+
+	return &Tap{
+		UID:     uid,
+		Counter: uint32(ctr[0]) | uint32(ctr[1])<<8 | uint32(ctr[2])<<16,
+	}, nil
+}
+
+// ComputeMAC returns the 8-byte SDMMAC for a tap with no encrypted file data
+func ComputeMAC(fileKey, uid []byte, counter uint32) ([]byte, error) {
+	if len(uid) != UIDLength {
+		return nil, ErrInvalidPICCData
+	}
+
+	sv := make([]byte, 0, blockSize)
+	sv = append(sv, svMAC...)
+	sv = append(sv, uid...)
+	sv = append(sv, byte(counter), byte(counter>>8), byte(counter>>16))
+
+	sessionKey, err := CMAC(fileKey, sv)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := CMAC(sessionKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The card transmits only the odd-indexed bytes of the full CMAC
+	mac := make([]byte, MACLength)
+	for i := range mac {
+		mac[i] = full[2*i+1]
+	}
+	return mac, nil
+}
+
+func parseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != KeyLength {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
@@ -0,0 +1,269 @@
+package sun
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Test vectors from NXP AN12196 (SDMMetaReadKey and SDMFileReadKey are all zeros)
+const (
+	zeroKey      = "00000000000000000000000000000000"
+	testPICCData = "EF963FF7828658A599F3041510671E88"
+	testCMAC     = "94EED9EE65337086"
+	testUID      = "04DE5F1EACC040"
+	testCounter  = 61
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex.DecodeString(%q) error = %v", s, err)
+	}
+	return b
+}
+
+func TestCMAC_RFC4493(t *testing.T) {
+	key := "2b7e151628aed2a6abf7158809cf4f3c"
+	msg := "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"
+
+	tests := []struct {
+		name   string
+		msgLen int
+		want   string
+	}{
+		{"empty", 0, "bb1d6929e95937287fa37d129b756746"},
+		{"one block", 16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{"partial block", 40, "dfa66747de9ae63030ca32611497c827"},
+		{"four blocks", 64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CMAC(mustHex(t, key), mustHex(t, msg)[:tt.msgLen])
+			if err != nil {
+				t.Fatalf("CMAC() error = %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("CMAC() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptPICCData(t *testing.T) {
+	tap, err := DecryptPICCData(mustHex(t, zeroKey), testPICCData)
+	if err != nil {
+		t.Fatalf("DecryptPICCData() error = %v", err)
+	}
+
+	if tap.UIDHex() != testUID {
+		t.Errorf("UID = %s, want %s", tap.UIDHex(), testUID)
+	}
+	if tap.Counter != testCounter {
+		t.Errorf("Counter = %d, want %d", tap.Counter, testCounter)
+	}
+}
+
+func TestDecryptPICCData_Invalid(t *testing.T) {
+	key := mustHex(t, zeroKey)
+
+	tests := []struct {
+		name     string
+		piccData string
+	}{
+		{"short", "EF963FF7828658A5"},
+		{"non-hex", "XX963FF7828658A599F3041510671E88"},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecryptPICCData(key, tt.piccData); err != ErrInvalidPICCData {
+				t.Errorf("DecryptPICCData() error = %v, want %v", err, ErrInvalidPICCData)
+			}
+		})
+	}
+}
+
+func TestDecryptPICCData_WrongKey(t *testing.T) {
+	if _, err := DecryptPICCData(mustHex(t, "000102030405060708090a0b0c0d0e0f"), testPICCData); err == nil {
+		t.Error("DecryptPICCData() with wrong meta key should fail")
+	}
+}
+
+// Test vector from NXP AN10922 §2.2.1 (AES-128 key diversification)
+func TestDiversifyKey_AN10922(t *testing.T) {
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+	uid := mustHex(t, "04782E21801D80")
+	// AID (3042F5) || SystemIdentifier ("NXP Abu")
+	sysID := mustHex(t, "3042F54E585020416275")
+
+	got, err := DiversifyKey(master, uid, sysID)
+	if err != nil {
+		t.Fatalf("DiversifyKey() error = %v", err)
+	}
+	if want := "A8DD63A3B89D54B37CA802473FDA9175"; strings.ToUpper(hex.EncodeToString(got)) != want {
+		t.Errorf("DiversifyKey() = %X, want %s", got, want)
+	}
+}
+
+func TestDiversifyKey_InputTooLong(t *testing.T) {
+	_, err := DiversifyKey(mustHex(t, zeroKey), make([]byte, UIDLength), make([]byte, 25))
+	if err != ErrInvalidDivInput {
+		t.Errorf("DiversifyKey() error = %v, want %v", err, ErrInvalidDivInput)
+	}
+}
+
+func TestDiversifyKey_DistinctPerCard(t *testing.T) {
+	master := mustHex(t, "00112233445566778899AABBCCDDEEFF")
+
+	k1, _ := DiversifyKey(master, mustHex(t, "04DE5F1EACC040"), []byte("LINK"))
+	k2, _ := DiversifyKey(master, mustHex(t, "04DE5F1EACC041"), []byte("LINK"))
+
+	if hex.EncodeToString(k1) == hex.EncodeToString(k2) {
+		t.Error("DiversifyKey() should derive different keys for different UIDs")
+	}
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	keys, err := ParseMasterKeys("1:" + zeroKey + ", 2:00112233445566778899AABBCCDDEEFF")
+	if err != nil {
+		t.Fatalf("ParseMasterKeys() error = %v", err)
+	}
+	if len(keys) != 2 || len(keys[1]) != KeyLength || len(keys[2]) != KeyLength {
+		t.Errorf("ParseMasterKeys() = %v, want versions 1 and 2", keys)
+	}
+
+	for _, bad := range []string{"", "1", "x:" + zeroKey, "0:" + zeroKey, "1:abcd"} {
+		if _, err := ParseMasterKeys(bad); err == nil {
+			t.Errorf("ParseMasterKeys(%q) should fail", bad)
+		}
+	}
+}
+
+func newTestVerifier(t *testing.T) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(zeroKey, map[int][]byte{
+		1: mustHex(t, "00112233445566778899AABBCCDDEEFF"),
+		2: mustHex(t, "FFEEDDCCBBAA99887766554433221100"),
+	}, "LINK")
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	return v
+}
+
+func newTestCard(t *testing.T, v *Verifier, version int) *Emulator {
+	t.Helper()
+	uid := mustHex(t, testUID)
+	key, err := v.CardKey(uid, version)
+	if err != nil {
+		t.Fatalf("CardKey() error = %v", err)
+	}
+	return &Emulator{UID: uid, MetaKey: mustHex(t, zeroKey), FileKey: key}
+}
+
+func TestVerifier_EmulatorRoundTrip(t *testing.T) {
+	v := newTestVerifier(t)
+	card := newTestCard(t, v, 2)
+
+	for i := 1; i <= 3; i++ {
+		piccData, cmac, err := card.Tap()
+		if err != nil {
+			t.Fatalf("Tap() error = %v", err)
+		}
+
+		tap, err := v.Decrypt(piccData)
+		if err != nil {
+			t.Fatalf("Decrypt() error = %v", err)
+		}
+		if tap.UIDHex() != testUID || tap.Counter != uint32(i) {
+			t.Errorf("Decrypt() = %s/%d, want %s/%d", tap.UIDHex(), tap.Counter, testUID, i)
+		}
+		if err := v.CheckMAC(tap, cmac, 2); err != nil {
+			t.Errorf("CheckMAC() error = %v", err)
+		}
+	}
+}
+
+func TestVerifier_KeyVersion(t *testing.T) {
+	v := newTestVerifier(t)
+
+	if v.KeyVersion() != 2 {
+		t.Errorf("KeyVersion() = %d, want 2", v.KeyVersion())
+	}
+
+	card := newTestCard(t, v, 1)
+	piccData, cmac, _ := card.Tap()
+	tap, _ := v.Decrypt(piccData)
+
+	if err := v.CheckMAC(tap, cmac, 2); err != ErrInvalidCMAC {
+		t.Errorf("CheckMAC() with wrong key version error = %v, want %v", err, ErrInvalidCMAC)
+	}
+	if err := v.CheckMAC(tap, cmac, 3); err != ErrUnknownKeyVersion {
+		t.Errorf("CheckMAC() with unknown key version error = %v, want %v", err, ErrUnknownKeyVersion)
+	}
+	if err := v.CheckMAC(tap, cmac, 1); err != nil {
+		t.Errorf("CheckMAC() error = %v", err)
+	}
+}
+
+func TestVerifier_CheckMAC_Invalid(t *testing.T) {
+	v := newTestVerifier(t)
+	card := newTestCard(t, v, 1)
+	piccData, _, _ := card.Tap()
+	tap, _ := v.Decrypt(piccData)
+
+	for _, cmac := range []string{"", "94EED9EE", "ZZEED9EE65337086", "94EED9EE65337086"} {
+		if err := v.CheckMAC(tap, cmac, 1); err != ErrInvalidCMAC {
+			t.Errorf("CheckMAC(%q) error = %v, want %v", cmac, err, ErrInvalidCMAC)
+		}
+	}
+}
+
+func TestVerifier_TamperedCounter(t *testing.T) {
+	v := newTestVerifier(t)
+	card := newTestCard(t, v, 1)
+	piccData, cmac, _ := card.Tap()
+	tap, _ := v.Decrypt(piccData)
+
+	tap.Counter++
+	if err := v.CheckMAC(tap, cmac, 1); err != ErrInvalidCMAC {
+		t.Errorf("CheckMAC() with tampered counter error = %v, want %v", err, ErrInvalidCMAC)
+	}
+}
+
+func TestNewVerifier_InvalidKey(t *testing.T) {
+	master := map[int][]byte{1: mustHex(t, zeroKey)}
+
+	if _, err := NewVerifier("short", master, "LINK"); err != ErrInvalidKey {
+		t.Errorf("NewVerifier() error = %v, want %v", err, ErrInvalidKey)
+	}
+	if _, err := NewVerifier(zeroKey, nil, "LINK"); err != ErrInvalidKey {
+		t.Errorf("NewVerifier() without master keys error = %v, want %v", err, ErrInvalidKey)
+	}
+	if _, err := NewVerifier(zeroKey, map[int][]byte{1: {0x01}}, "LINK"); err != ErrInvalidKey {
+		t.Errorf("NewVerifier() with short master key error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestEmulator_CounterExhausted(t *testing.T) {
+	card := &Emulator{UID: mustHex(t, testUID), MetaKey: mustHex(t, zeroKey), FileKey: mustHex(t, zeroKey), Counter: maxCounter}
+
+	if _, _, err := card.Tap(); err != ErrCounterExhausted {
+		t.Errorf("Tap() error = %v, want %v", err, ErrCounterExhausted)
+	}
+}
+
+func TestComputeMAC_RoundTrip(t *testing.T) {
+	mac, err := ComputeMAC(mustHex(t, zeroKey), mustHex(t, testUID), testCounter)
+	if err != nil {
+		t.Fatalf("ComputeMAC() error = %v", err)
+	}
+	if strings.ToUpper(hex.EncodeToString(mac)) != testCMAC {
+		t.Errorf("ComputeMAC() = %X, want %s", mac, testCMAC)
+	}
+}
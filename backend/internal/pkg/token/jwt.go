@@ -1,7 +1,12 @@
 package token
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,9 +19,13 @@ var (
 	ErrInvalidAlgorithm = errors.New("invalid algorithm")
 )
 
+// Manager signs with one key of its keyring and verifies with any of them.
+// Tokens without a kid header are checked against the legacy HS256 secret.
 type Manager struct {
-	secret []byte
-	expiry time.Duration
+	secret  []byte // legacy kid-less HS256 secret; nil disables kid-less tokens
+	keys    map[string]*Key
+	signing *Key // nil signs with the legacy secret
+	expiry  time.Duration
 }
 
 type Claims struct {
@@ -28,32 +37,131 @@ func NewManager(secret string, expiry time.Duration) *Manager {
 	if len(secret) < 32 {
 		panic("JWT secret must be at least 32 characters")
 	}
-	return &Manager{secret: []byte(secret), expiry: expiry}
+	return &Manager{secret: []byte(secret), keys: map[string]*Key{}, expiry: expiry}
+}
+
+// NewKeyedManager creates a manager that signs with signingKID and verifies with every key.
+// legacySecret may be empty once no kid-less tokens remain in circulation.
+func NewKeyedManager(legacySecret string, keys []*Key, signingKID string, expiry time.Duration) (*Manager, error) {
+	if legacySecret != "" && len(legacySecret) < 32 {
+		return nil, ErrInvalidKey
+	}
+
+	m := &Manager{keys: make(map[string]*Key), expiry: expiry}
+	if legacySecret != "" {
+		m.secret = []byte(legacySecret)
+	}
+	for _, k := range keys {
+		m.keys[k.ID] = k
+	}
+
+	if signingKID == "" {
+		if m.secret == nil {
+			return nil, ErrInvalidKey
+		}
+		return m, nil
+	}
+	k, ok := m.keys[signingKID]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if !k.CanSign() {
+		return nil, ErrInvalidKey
+	}
+	m.signing = k
+	return m, nil
+}
+
+// JWKS returns the public keys of the keyring for third-party verification
+func (m *Manager) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, k := range m.keys {
+		if jwk, ok := k.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// Issued is a signed token together with the jti that ties it to a server-side session
+type Issued struct {
+	Token     string
+	JTI       string
+	ExpiresAt time.Time
 }
 
 func (m *Manager) Generate(userID string) (string, error) {
+	issued, err := m.Issue(userID)
+	if err != nil {
+		return "", err
+	}
+	return issued.Token, nil
+}
+
+// Issue signs a token with a fresh random jti
+func (m *Manager) Issue(userID string) (*Issued, error) {
+	jti, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(m.expiry)
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.secret)
+	var signed string
+	if m.signing != nil {
+		token := jwt.NewWithClaims(m.signing.method, claims)
+		token.Header["kid"] = m.signing.ID
+		signed, err = token.SignedString(m.signing.sign)
+	} else {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Issued{Token: signed, JTI: jti, ExpiresAt: expiresAt}, nil
+}
+
+// HashID returns the SHA-256 hex digest of a jti, the form stored in sessions.token_hash
+func HashID(jti string) string {
+	sum := sha256.Sum256([]byte(jti))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRefreshToken returns an opaque 256-bit refresh token. Only its HashID is stored server-side.
+func NewRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 func (m *Manager) Verify(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-			return nil, ErrInvalidAlgorithm
-		}
-		return m.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, m.keyFunc)
 
 	if err != nil {
+		if errors.Is(err, ErrInvalidAlgorithm) {
+			return nil, ErrInvalidAlgorithm
+		}
 		if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
 			return nil, ErrInvalidSignature
 		}
@@ -74,3 +182,24 @@ func (m *Manager) Verify(tokenStr string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// keyFunc picks the verification key by kid. The algorithm must be the one bound to that key,
+// never the one the token claims, so an HMAC token cannot be verified with a public key.
+func (m *Manager) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if m.secret == nil || t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, ErrInvalidAlgorithm
+		}
+		return m.secret, nil
+	}
+
+	k, ok := m.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if t.Method.Alg() != k.Alg() {
+		return nil, ErrInvalidAlgorithm
+	}
+	return k.verify, nil
+}
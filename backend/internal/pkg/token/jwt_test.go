@@ -173,6 +173,63 @@ func TestGenerate_MultipleTimes(t *testing.T) {
 	}
 }
 
+func TestIssue_UniqueJTI(t *testing.T) {
+	m := NewManager(testSecret, time.Hour)
+
+	a, err := m.Issue("user-jti")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	b, _ := m.Issue("user-jti")
+
+	if a.JTI == "" || a.JTI == b.JTI {
+		t.Errorf("Issue() should return a unique jti, got %q and %q", a.JTI, b.JTI)
+	}
+	if a.Token == b.Token {
+		t.Error("Issue() tokens should differ when jti differs")
+	}
+
+	claims, err := m.Verify(a.Token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.ID != a.JTI {
+		t.Errorf("Claims.ID = %v, want %v", claims.ID, a.JTI)
+	}
+	if claims.ExpiresAt.Unix() != a.ExpiresAt.Unix() {
+		t.Errorf("Claims.ExpiresAt = %v, want %v", claims.ExpiresAt, a.ExpiresAt)
+	}
+}
+
+func TestHashID(t *testing.T) {
+	h := HashID("some-jti")
+
+	if len(h) != 64 {
+		t.Errorf("HashID() length = %d, want 64", len(h))
+	}
+	if h != HashID("some-jti") {
+		t.Error("HashID() should be deterministic")
+	}
+	if h == HashID("other-jti") {
+		t.Error("HashID() should differ for different jti")
+	}
+}
+
+func TestNewRefreshToken(t *testing.T) {
+	a, err := NewRefreshToken()
+	if err != nil {
+		t.Fatalf("NewRefreshToken() error = %v", err)
+	}
+	b, _ := NewRefreshToken()
+
+	if len(a) != 43 {
+		t.Errorf("NewRefreshToken() length = %d, want 43", len(a))
+	}
+	if a == b {
+		t.Error("NewRefreshToken() should return unique tokens")
+	}
+}
+
 func BenchmarkGenerate(b *testing.B) {
 	m := NewManager(testSecret, time.Hour)
 
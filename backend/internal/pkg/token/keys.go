@@ -0,0 +1,161 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidKey   = errors.New("invalid signing key")
+	ErrUnknownKeyID = errors.New("unknown key id")
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Key is one entry of the keyring. Asymmetric keys loaded from a public key PEM
+// can only verify; they keep tokens of a retired signing key valid until expiry.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	sign   interface{} // []byte, ed25519.PrivateKey or *ecdsa.PrivateKey; nil if verify-only
+	verify interface{} // []byte, ed25519.PublicKey or *ecdsa.PublicKey
+}
+
+// Alg returns the JWS algorithm of the key
+func (k *Key) Alg() string { return k.method.Alg() }
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool { return k.sign != nil }
+
+// NewHMACKey creates an HS256 key
+func NewHMACKey(kid, secret string) (*Key, error) {
+	if !keyIDPattern.MatchString(kid) || len(secret) < 32 {
+		return nil, ErrInvalidKey
+	}
+	return &Key{ID: kid, method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}, nil
+}
+
+// ParsePEMKey creates an EdDSA (Ed25519) or ES256 (P-256) key from a PKCS#8, SEC 1 or PKIX PEM block
+func ParsePEMKey(kid string, data []byte) (*Key, error) {
+	if !keyIDPattern.MatchString(kid) {
+		return nil, ErrInvalidKey
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, method: jwt.SigningMethodEdDSA, verify: k}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrInvalidKey
+		}
+		return &Key{ID: kid, method: jwt.SigningMethodES256, sign: k, verify: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrInvalidKey
+		}
+		return &Key{ID: kid, method: jwt.SigningMethodES256, verify: k}, nil
+	default:
+		return nil, ErrInvalidKey
+	}
+}
+
+// LoadKeys parses a keyring spec such as "k1:hs256:<secret>,k2:file:/etc/link/jwt-ed25519.pem"
+func LoadKeys(spec string) ([]*Key, error) {
+	var keys []*Key
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || seen[parts[0]] {
+			return nil, ErrInvalidKey
+		}
+
+		var key *Key
+		var err error
+		switch parts[1] {
+		case "hs256":
+			key, err = NewHMACKey(parts[0], parts[2])
+		case "file":
+			var data []byte
+			data, err = os.ReadFile(parts[2])
+			if err == nil {
+				key, err = ParsePEMKey(parts[0], data)
+			}
+		default:
+			err = ErrInvalidKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen[key.ID] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// JWK is the public part of a key (RFC 7517). HMAC keys are never published.
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() (JWK, bool) {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := k.verify.(type) {
+	case ed25519.PublicKey:
+		return JWK{KeyType: "OKP", KeyID: k.ID, Use: "sig", Alg: k.Alg(), Curve: "Ed25519", X: enc(pub)}, true
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			KeyType: "EC", KeyID: k.ID, Use: "sig", Alg: k.Alg(), Curve: "P-256",
+			X: enc(pub.X.FillBytes(make([]byte, size))),
+			Y: enc(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
@@ -0,0 +1,247 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func ed25519PEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	return marshalPEM(t, priv, pub)
+}
+
+func ecdsaPEM(t *testing.T, curve elliptic.Curve) (private, public []byte) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	return marshalPEM(t, priv, &priv.PublicKey)
+}
+
+func marshalPEM(t *testing.T, priv, pub interface{}) ([]byte, []byte) {
+	t.Helper()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func mustPEMKey(t *testing.T, kid string, data []byte) *Key {
+	t.Helper()
+	k, err := ParsePEMKey(kid, data)
+	if err != nil {
+		t.Fatalf("ParsePEMKey(%q) error = %v", kid, err)
+	}
+	return k
+}
+
+func TestKeyedManager_Algorithms(t *testing.T) {
+	edPriv, _ := ed25519PEM(t)
+	ecPriv, _ := ecdsaPEM(t, elliptic.P256())
+	hmacKey, _ := NewHMACKey("h1", testSecret)
+
+	tests := []struct {
+		name string
+		key  *Key
+		alg  string
+	}{
+		{"EdDSA", mustPEMKey(t, "ed1", edPriv), "EdDSA"},
+		{"ES256", mustPEMKey(t, "ec1", ecPriv), "ES256"},
+		{"HS256", hmacKey, "HS256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewKeyedManager("", []*Key{tt.key}, tt.key.ID, time.Hour)
+			if err != nil {
+				t.Fatalf("NewKeyedManager() error = %v", err)
+			}
+
+			tokenStr, err := m.Generate("user-1")
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			parsed, _, _ := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+			if parsed.Header["kid"] != tt.key.ID || parsed.Header["alg"] != tt.alg {
+				t.Errorf("header = %v, want kid %s alg %s", parsed.Header, tt.key.ID, tt.alg)
+			}
+
+			claims, err := m.Verify(tokenStr)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.UserID != "user-1" {
+				t.Errorf("Verify() UserID = %v, want user-1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestKeyedManager_Rotation(t *testing.T) {
+	oldPriv, oldPub := ed25519PEM(t)
+	newPriv, _ := ecdsaPEM(t, elliptic.P256())
+
+	legacy := NewManager(testSecret, time.Hour)
+	before, _ := NewKeyedManager(testSecret, []*Key{mustPEMKey(t, "k1", oldPriv)}, "k1", time.Hour)
+
+	// After rotation the old key is kept as verify-only
+	after, err := NewKeyedManager(testSecret, []*Key{
+		mustPEMKey(t, "k1", oldPub),
+		mustPEMKey(t, "k2", newPriv),
+	}, "k2", time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyedManager() error = %v", err)
+	}
+
+	legacyToken, _ := legacy.Generate("user-legacy")
+	oldToken, _ := before.Generate("user-old")
+	newToken, _ := after.Generate("user-new")
+
+	for _, tok := range []string{legacyToken, oldToken, newToken} {
+		if _, err := after.Verify(tok); err != nil {
+			t.Errorf("Verify() after rotation error = %v", err)
+		}
+	}
+
+	// Dropping the legacy secret stops kid-less tokens
+	noLegacy, _ := NewKeyedManager("", []*Key{mustPEMKey(t, "k2", newPriv)}, "k2", time.Hour)
+	if _, err := noLegacy.Verify(legacyToken); err == nil {
+		t.Error("Verify() should reject kid-less token without legacy secret")
+	}
+	if _, err := noLegacy.Verify(oldToken); err == nil {
+		t.Error("Verify() should reject token signed by a removed key")
+	}
+}
+
+func TestKeyedManager_AlgorithmConfusion(t *testing.T) {
+	_, edPub := ed25519PEM(t)
+	pubKey := mustPEMKey(t, "ed1", edPub)
+	m, err := NewKeyedManager(testSecret, []*Key{pubKey}, "", time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyedManager() error = %v", err)
+	}
+
+	// HS256 token keyed with the public key bytes, claiming the Ed25519 kid
+	claims := &Claims{UserID: "attacker", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "ed1"
+	tokenStr, _ := forged.SignedString([]byte(pubKey.verify.(ed25519.PublicKey)))
+
+	if _, err := m.Verify(tokenStr); err != ErrInvalidAlgorithm {
+		t.Errorf("Verify() error = %v, want %v", err, ErrInvalidAlgorithm)
+	}
+}
+
+func TestNewKeyedManager_Invalid(t *testing.T) {
+	_, edPub := ed25519PEM(t)
+	pubKey := mustPEMKey(t, "ed1", edPub)
+
+	if _, err := NewKeyedManager("", []*Key{pubKey}, "ed1", time.Hour); err != ErrInvalidKey {
+		t.Errorf("NewKeyedManager() with verify-only signing key error = %v, want %v", err, ErrInvalidKey)
+	}
+	if _, err := NewKeyedManager("", []*Key{pubKey}, "missing", time.Hour); err != ErrUnknownKeyID {
+		t.Errorf("NewKeyedManager() with unknown kid error = %v, want %v", err, ErrUnknownKeyID)
+	}
+	if _, err := NewKeyedManager("", nil, "", time.Hour); err != ErrInvalidKey {
+		t.Errorf("NewKeyedManager() without any signing key error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestParsePEMKey_Invalid(t *testing.T) {
+	p384, _ := ecdsaPEM(t, elliptic.P384())
+	edPriv, _ := ed25519PEM(t)
+
+	tests := []struct {
+		name string
+		kid  string
+		data []byte
+	}{
+		{"not PEM", "k1", []byte("not a key")},
+		{"unsupported curve", "k1", p384},
+		{"bad kid", "bad kid!", edPriv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePEMKey(tt.kid, tt.data); err != ErrInvalidKey {
+				t.Errorf("ParsePEMKey() error = %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	edPriv, _ := ed25519PEM(t)
+	ecPriv, _ := ecdsaPEM(t, elliptic.P256())
+	hmacKey, _ := NewHMACKey("h1", testSecret)
+
+	m, _ := NewKeyedManager("", []*Key{
+		mustPEMKey(t, "ed1", edPriv),
+		mustPEMKey(t, "ec1", ecPriv),
+		hmacKey,
+	}, "h1", time.Hour)
+
+	set := m.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2 (HMAC keys must not be published)", len(set.Keys))
+	}
+
+	ec, ed := set.Keys[0], set.Keys[1]
+	if ec.KeyID != "ec1" || ec.KeyType != "EC" || ec.Curve != "P-256" || len(ec.X) != 43 || len(ec.Y) != 43 {
+		t.Errorf("JWKS() EC key = %+v", ec)
+	}
+	if ed.KeyID != "ed1" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || len(ed.X) != 43 || ed.Y != "" {
+		t.Errorf("JWKS() Ed25519 key = %+v", ed)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	edPriv, _ := ed25519PEM(t)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, edPriv, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	keys, err := LoadKeys("h1:hs256:" + testSecret + ", ed1:file:" + path)
+	if err != nil {
+		t.Fatalf("LoadKeys() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].Alg() != "HS256" || keys[1].Alg() != "EdDSA" {
+		t.Errorf("LoadKeys() = %v, want HS256 and EdDSA keys", keys)
+	}
+
+	for _, bad := range []string{
+		"h1:hs256:short",
+		"h1:" + testSecret,
+		"h1:rsa:" + testSecret,
+		"h1:file:/nonexistent.pem",
+		"h1:hs256:" + testSecret + ",h1:hs256:" + testSecret,
+	} {
+		if _, err := LoadKeys(bad); err == nil {
+			t.Errorf("LoadKeys(%q) should fail", bad)
+		}
+	}
+}
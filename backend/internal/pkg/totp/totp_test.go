@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B SHA-1 secret, truncated to 6 digits
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode_RFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	step, ok := Validate(rfcSecret, code, now, 1)
+	if !ok || step != Step(now) {
+		t.Errorf("Validate() = %d, %v, want %d, true", step, ok, Step(now))
+	}
+
+	// One step of drift is tolerated, two are not
+	if _, ok := Validate(rfcSecret, code, now.Add(Period), 1); !ok {
+		t.Error("Validate() should accept the previous step")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(2*Period), 1); ok {
+		t.Error("Validate() should reject a code two steps old")
+	}
+
+	if _, ok := Validate(rfcSecret, "12345", now, 1); ok {
+		t.Error("Validate() should reject short codes")
+	}
+	if _, ok := Validate("not base32!", "123456", now, 1); ok {
+		t.Error("Validate() should reject an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	b, _ := GenerateSecret()
+
+	if len(a) != 32 || a == b {
+		t.Errorf("GenerateSecret() = %q, %q", a, b)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Errorf("Code() with generated secret error = %v", err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("LINK Admin", "alice", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/LINK%20Admin:alice?") ||
+		!strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=LINK+Admin") {
+		t.Errorf("ProvisioningURI() = %s", uri)
+	}
+}
@@ -0,0 +1,215 @@
+// Package webauthn verifies WebAuthn (passkey) registration and authentication ceremonies
+// for a single relying party. Credentials are created with "none" attestation conveyance,
+// so attestation statements are not verified and a credential is trusted on first use.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+const ChallengeSize = 32
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	maxCredentialIDLength = 1023
+)
+
+var (
+	ErrMalformed         = errors.New("malformed webauthn response")
+	ErrCeremony          = errors.New("wrong webauthn ceremony type")
+	ErrChallengeMismatch = errors.New("webauthn challenge mismatch")
+	ErrOriginMismatch    = errors.New("webauthn origin mismatch")
+	ErrRPIDMismatch      = errors.New("webauthn rp id mismatch")
+	ErrUserNotPresent    = errors.New("user presence not asserted")
+	ErrInvalidSignature  = errors.New("invalid webauthn signature")
+	// ErrSignCount means the authenticator's counter did not advance, a sign of a cloned credential
+	ErrSignCount = errors.New("webauthn signature counter did not advance")
+)
+
+// Encoding is how challenges, credential IDs and user handles travel in JSON
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is the site credentials are scoped to. ID is its registrable domain
+// (e.g. link.example.com) and Origin the exact origin the browser reports (e.g. https://link.example.com).
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+	idHash [32]byte
+}
+
+func NewRelyingParty(id, name, origin string) *RelyingParty {
+	return &RelyingParty{ID: id, Name: name, Origin: origin, idHash: sha256.Sum256([]byte(id))}
+}
+
+// NewChallenge returns a random challenge for one ceremony
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, ChallengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Credential is a newly registered public key credential
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key, passed back to VerifyAssertion
+	SignCount    uint32
+	AAGUID       []byte // authenticator model, all zero when not disclosed
+	UserVerified bool
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create() and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+	obj, ok := item.(map[any]any)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	authData, ok := obj["authData"].([]byte)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	if _, ok := obj["fmt"].(string); !ok {
+		return nil, ErrMalformed
+	}
+
+	flags, signCount, err := rp.verifyAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagAttested == 0 {
+		return nil, ErrMalformed
+	}
+
+	// Attested credential data: aaguid(16) || credentialIdLength(2) || credentialId || COSE_Key
+	data := authData[37:]
+	if len(data) < 18 {
+		return nil, ErrMalformed
+	}
+	aaguid := data[:16]
+	idLen := int(binary.BigEndian.Uint16(data[16:18]))
+	data = data[18:]
+	if idLen == 0 || idLen > maxCredentialIDLength || len(data) < idLen {
+		return nil, ErrMalformed
+	}
+	credentialID := data[:idLen]
+	data = data[idLen:]
+
+	_, rest, err = parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 && flags&flagExtensions == 0 {
+		return nil, ErrMalformed
+	}
+
+	return &Credential{
+		ID:           append([]byte(nil), credentialID...),
+		PublicKey:    append([]byte(nil), data[:len(data)-len(rest)]...),
+		SignCount:    signCount,
+		AAGUID:       append([]byte(nil), aaguid...),
+		UserVerified: flags&flagUserVerified != 0,
+	}, nil
+}
+
+// Assertion is the response to navigator.credentials.get()
+type Assertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// VerifyAssertion checks an assertion made with a stored credential and returns its new signature counter.
+// Authenticators that do not keep a counter always report zero, which is accepted.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, a *Assertion, credentialPublicKey []byte, storedSignCount uint32) (uint32, error) {
+	if err := rp.verifyClientData(a.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return 0, err
+	}
+	_, signCount, err := rp.verifyAuthData(a.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(credentialPublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	signed := append(append([]byte(nil), a.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, a.Signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	if (signCount != 0 || storedSignCount != 0) && signCount <= storedSignCount {
+		return 0, ErrSignCount
+	}
+	return signCount, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrMalformed
+	}
+	if cd.Type != ceremony {
+		return ErrCeremony
+	}
+	got, err := Encoding.DecodeString(cd.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.Origin != rp.Origin || cd.CrossOrigin {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+// verifyAuthData checks the fixed authenticator data header: rpIdHash(32) || flags(1) || signCount(4)
+func (rp *RelyingParty) verifyAuthData(authData []byte) (byte, uint32, error) {
+	if len(authData) < 37 {
+		return 0, 0, ErrMalformed
+	}
+	if !bytes.Equal(authData[:32], rp.idHash[:]) {
+		return 0, 0, ErrRPIDMismatch
+	}
+	flags := authData[32]
+	if flags&flagUserPresent == 0 {
+		return 0, 0, ErrUserNotPresent
+	}
+	return flags, binary.BigEndian.Uint32(authData[33:37]), nil
+}
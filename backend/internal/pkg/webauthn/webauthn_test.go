@@ -0,0 +1,279 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+const (
+	testRPID   = "link.example.com"
+	testOrigin = "https://link.example.com"
+)
+
+// encodeCBOR is the inverse of decodeCBOR for the types the tests need
+func encodeCBOR(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		default:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+	}
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[any]any:
+		keys := make([]any, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(encodeCBOR(keys[i])) < string(encodeCBOR(keys[j])) })
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(v[k])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
+
+// authenticator signs like a platform authenticator holding one credential
+type authenticator struct {
+	credentialID []byte
+	coseKey      []byte
+	sign         func(data []byte) []byte
+	counter      uint32
+}
+
+func newES256Authenticator(t *testing.T) *authenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return &authenticator{
+		credentialID: []byte("credential-es256"),
+		coseKey:      encodeCBOR(map[any]any{coseKty: ktyEC2, coseAlg: AlgES256, coseCrv: crvP256, coseX: x, coseY: y}),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+func newEd25519Authenticator(t *testing.T) *authenticator {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authenticator{
+		credentialID: []byte("credential-ed25519"),
+		coseKey:      encodeCBOR(map[any]any{coseKty: ktyOKP, coseAlg: AlgEdDSA, coseCrv: crvEd25519, coseX: []byte(pub)}),
+		sign:         func(data []byte) []byte { return ed25519.Sign(priv, data) },
+	}
+}
+
+func clientDataJSON(ceremony string, challenge []byte, origin string) []byte {
+	b, _ := json.Marshal(clientData{Type: ceremony, Challenge: Encoding.EncodeToString(challenge), Origin: origin})
+	return b
+}
+
+func (a *authenticator) authData(rpID string, flags byte, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	out := append(hash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, a.counter)
+	if attested {
+		out = append(out, make([]byte, 16)...)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.credentialID)))
+		out = append(out, a.credentialID...)
+		out = append(out, a.coseKey...)
+	}
+	return out
+}
+
+func (a *authenticator) create(challenge []byte) (clientData, attestation []byte) {
+	authData := a.authData(testRPID, flagUserPresent|flagUserVerified|flagAttested, true)
+	return clientDataJSON(ceremonyCreate, challenge, testOrigin),
+		encodeCBOR(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": authData})
+}
+
+func (a *authenticator) get(challenge []byte) *Assertion {
+	a.counter++
+	authData := a.authData(testRPID, flagUserPresent, false)
+	cd := clientDataJSON(ceremonyGet, challenge, testOrigin)
+	hash := sha256.Sum256(cd)
+	return &Assertion{
+		CredentialID:      a.credentialID,
+		ClientDataJSON:    cd,
+		AuthenticatorData: authData,
+		Signature:         a.sign(append(append([]byte(nil), authData...), hash[:]...)),
+	}
+}
+
+func mustChallenge(t *testing.T) []byte {
+	t.Helper()
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := NewRelyingParty(testRPID, "LINK", testOrigin)
+
+	for name, auth := range map[string]*authenticator{
+		"ES256":   newES256Authenticator(t),
+		"Ed25519": newEd25519Authenticator(t),
+	} {
+		t.Run(name, func(t *testing.T) {
+			challenge := mustChallenge(t)
+			cd, att := auth.create(challenge)
+			cred, err := rp.VerifyRegistration(challenge, cd, att)
+			if err != nil {
+				t.Fatalf("VerifyRegistration() error = %v", err)
+			}
+			if string(cred.ID) != string(auth.credentialID) || !cred.UserVerified {
+				t.Fatalf("unexpected credential %+v", cred)
+			}
+
+			challenge = mustChallenge(t)
+			count, err := rp.VerifyAssertion(challenge, auth.get(challenge), cred.PublicKey, cred.SignCount)
+			if err != nil {
+				t.Fatalf("VerifyAssertion() error = %v", err)
+			}
+			if count != 1 {
+				t.Errorf("sign count = %d, want 1", count)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistration_Rejects(t *testing.T) {
+	rp := NewRelyingParty(testRPID, "LINK", testOrigin)
+	auth := newES256Authenticator(t)
+	challenge := mustChallenge(t)
+	cd, att := auth.create(challenge)
+
+	if _, err := rp.VerifyRegistration(mustChallenge(t), cd, att); !errors.Is(err, ErrChallengeMismatch) {
+		t.Errorf("other challenge: error = %v, want ErrChallengeMismatch", err)
+	}
+
+	phishing := clientDataJSON(ceremonyCreate, challenge, "https://link.example.com.evil.test")
+	if _, err := rp.VerifyRegistration(challenge, phishing, att); !errors.Is(err, ErrOriginMismatch) {
+		t.Errorf("other origin: error = %v, want ErrOriginMismatch", err)
+	}
+
+	get := clientDataJSON(ceremonyGet, challenge, testOrigin)
+	if _, err := rp.VerifyRegistration(challenge, get, att); !errors.Is(err, ErrCeremony) {
+		t.Errorf("get ceremony: error = %v, want ErrCeremony", err)
+	}
+
+	otherRP := NewRelyingParty("example.org", "LINK", testOrigin)
+	if _, err := otherRP.VerifyRegistration(challenge, cd, att); !errors.Is(err, ErrRPIDMismatch) {
+		t.Errorf("other rp id: error = %v, want ErrRPIDMismatch", err)
+	}
+
+	absent := encodeCBOR(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": auth.authData(testRPID, flagAttested, true)})
+	if _, err := rp.VerifyRegistration(challenge, cd, absent); !errors.Is(err, ErrUserNotPresent) {
+		t.Errorf("no user presence: error = %v, want ErrUserNotPresent", err)
+	}
+
+	if _, err := rp.VerifyRegistration(challenge, cd, att[:len(att)-5]); err == nil {
+		t.Error("truncated attestation object accepted")
+	}
+}
+
+func TestVerifyAssertion_Rejects(t *testing.T) {
+	rp := NewRelyingParty(testRPID, "LINK", testOrigin)
+	auth := newES256Authenticator(t)
+	challenge := mustChallenge(t)
+	cd, att := auth.create(challenge)
+	cred, err := rp.VerifyRegistration(challenge, cd, att)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge = mustChallenge(t)
+	a := auth.get(challenge)
+	a.Signature[len(a.Signature)-1] ^= 0xff
+	if _, err := rp.VerifyAssertion(challenge, a, cred.PublicKey, 0); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered signature: error = %v, want ErrInvalidSignature", err)
+	}
+
+	a = auth.get(challenge)
+	if _, err := rp.VerifyAssertion(mustChallenge(t), a, cred.PublicKey, 0); !errors.Is(err, ErrChallengeMismatch) {
+		t.Errorf("other challenge: error = %v, want ErrChallengeMismatch", err)
+	}
+
+	// A clone replaying an older counter value
+	if _, err := rp.VerifyAssertion(challenge, a, cred.PublicKey, auth.counter); !errors.Is(err, ErrSignCount) {
+		t.Errorf("stale counter: error = %v, want ErrSignCount", err)
+	}
+
+	other := newEd25519Authenticator(t)
+	if _, err := rp.VerifyAssertion(challenge, other.get(challenge), cred.PublicKey, 0); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other key: error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyAssertion_ZeroCounter(t *testing.T) {
+	rp := NewRelyingParty(testRPID, "LINK", testOrigin)
+	auth := newES256Authenticator(t)
+	challenge := mustChallenge(t)
+	a := auth.get(challenge)
+
+	// Synced passkeys report a counter of zero on every use
+	binary.BigEndian.PutUint32(a.AuthenticatorData[33:37], 0)
+	hash := sha256.Sum256(a.ClientDataJSON)
+	a.Signature = auth.sign(append(append([]byte(nil), a.AuthenticatorData...), hash[:]...))
+	if _, err := rp.VerifyAssertion(challenge, a, auth.coseKey, 0); err != nil {
+		t.Errorf("VerifyAssertion() error = %v", err)
+	}
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":             {},
+		"truncated string":  {0x45, 1, 2},
+		"indefinite array":  {0x9f, 0x01, 0xff},
+		"float":             {0xfa, 0, 0, 0, 0},
+		"tag":               {0xc1, 0x01},
+		"duplicate map key": {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"huge array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, data := range tests {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
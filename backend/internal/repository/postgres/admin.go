@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const adminColumns = `id, username, password_hash, role, totp_secret, totp_enabled, totp_last_step,
+	disabled_at, last_login_at, created_at, updated_at`
+
+type AdminRepository struct {
+	db DBTX
+}
+
+func NewAdminRepository(db DBTX) *AdminRepository {
+	return &AdminRepository{db: db}
+}
+
+func (r *AdminRepository) Count(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&n)
+	return n, err
+}
+
+func (r *AdminRepository) Create(ctx context.Context, admin *domain.AdminUser) error {
+	query := `
+		INSERT INTO admin_users (username, password_hash, role)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+	return r.db.QueryRow(ctx, query, admin.Username, admin.PasswordHash, admin.Role).
+		Scan(&admin.ID, &admin.CreatedAt, &admin.UpdatedAt)
+}
+
+func (r *AdminRepository) FindByID(ctx context.Context, id string) (*domain.AdminUser, error) {
+	return r.findOne(ctx, `SELECT `+adminColumns+` FROM admin_users WHERE id = $1`, id)
+}
+
+func (r *AdminRepository) FindByUsername(ctx context.Context, username string) (*domain.AdminUser, error) {
+	return r.findOne(ctx, `SELECT `+adminColumns+` FROM admin_users WHERE username = $1`, username)
+}
+
+func (r *AdminRepository) List(ctx context.Context) ([]*domain.AdminUser, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+adminColumns+` FROM admin_users ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []*domain.AdminUser
+	for rows.Next() {
+		a, err := scanAdmin(rows)
+		if err != nil {
+			return nil, err
+		}
+		admins = append(admins, a)
+	}
+	return admins, rows.Err()
+}
+
+func (r *AdminRepository) UpdateRole(ctx context.Context, id string, role domain.AdminRole) error {
+	_, err := r.db.Exec(ctx, `UPDATE admin_users SET role = $2 WHERE id = $1`, id, role)
+	return err
+}
+
+func (r *AdminRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE admin_users SET password_hash = $2 WHERE id = $1`, id, passwordHash)
+	return err
+}
+
+func (r *AdminRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE admin_users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END WHERE id = $1`,
+		id, disabled,
+	)
+	return err
+}
+
+func (r *AdminRepository) RecordLogin(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `UPDATE admin_users SET last_login_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *AdminRepository) SetTOTPSecret(ctx context.Context, id, secret string) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE admin_users SET totp_secret = $2 WHERE id = $1 AND NOT totp_enabled`,
+		id, secret,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *AdminRepository) EnableTOTP(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE admin_users SET totp_enabled = TRUE WHERE id = $1 AND totp_secret IS NOT NULL`,
+		id,
+	)
+	return err
+}
+
+func (r *AdminRepository) ResetTOTP(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE admin_users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 WHERE id = $1`,
+		id,
+	)
+	return err
+}
+
+func (r *AdminRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE admin_users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`,
+		id, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *AdminRepository) findOne(ctx context.Context, query string, arg interface{}) (*domain.AdminUser, error) {
+	a, err := scanAdmin(r.db.QueryRow(ctx, query, arg))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+func scanAdmin(row pgx.Row) (*domain.AdminUser, error) {
+	a := &domain.AdminUser{}
+	err := row.Scan(
+		&a.ID, &a.Username, &a.PasswordHash, &a.Role, &a.TOTPSecret, &a.TOTPEnabled, &a.TOTPLastStep,
+		&a.DisabledAt, &a.LastLoginAt, &a.CreatedAt, &a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+var _ domain.AdminRepository = (*AdminRepository)(nil)
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type AdminSessionRepository struct {
+	db DBTX
+}
+
+func NewAdminSessionRepository(db DBTX) *AdminSessionRepository {
+	return &AdminSessionRepository{db: db}
+}
+
+func (r *AdminSessionRepository) Create(ctx context.Context, session *domain.AdminSession) error {
+	query := `
+		INSERT INTO admin_sessions (admin_id, token_hash, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_used_at
+	`
+	return r.db.QueryRow(ctx, query,
+		session.AdminID, session.TokenHash, session.IP, session.UserAgent, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+}
+
+func (r *AdminSessionRepository) FindByTokenHash(ctx context.Context, hash string) (*domain.AdminSession, error) {
+	query := `
+		SELECT id, admin_id, token_hash, ip, user_agent, created_at, last_used_at, expires_at, revoked_at
+		FROM admin_sessions WHERE token_hash = $1
+	`
+	s := &domain.AdminSession{}
+	err := r.db.QueryRow(ctx, query, hash).Scan(
+		&s.ID, &s.AdminID, &s.TokenHash, &s.IP, &s.UserAgent,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *AdminSessionRepository) Touch(ctx context.Context, id string, client domain.ClientInfo) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE admin_sessions SET last_used_at = NOW(), ip = $2, user_agent = $3 WHERE id = $1`,
+		id, client.IP, client.UserAgent,
+	)
+	return err
+}
+
+func (r *AdminSessionRepository) Revoke(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `UPDATE admin_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+func (r *AdminSessionRepository) RevokeAllByAdmin(ctx context.Context, adminID string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE admin_sessions SET revoked_at = NOW() WHERE admin_id = $1 AND revoked_at IS NULL`,
+		adminID,
+	)
+	return err
+}
+
+var _ domain.AdminSessionRepository = (*AdminSessionRepository)(nil)
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"link/internal/domain"
+)
+
+// AuditLogRepository only ever inserts; the table itself rejects updates and deletes
+type AuditLogRepository struct {
+	db DBTX
+}
+
+func NewAuditLogRepository(db DBTX) *AuditLogRepository {
+	return &AuditLogRepository{db: db}
+}
+
+func (r *AuditLogRepository) Append(ctx context.Context, e *domain.AuditEntry) error {
+	query := `
+		INSERT INTO admin_audit_log (admin_id, username, action, target, status, ip, detail)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(ctx, query,
+		e.AdminID, e.Username, e.Action, e.Target, e.Status, e.IP, e.Detail,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (r *AuditLogRepository) List(ctx context.Context, f domain.AuditFilter) ([]*domain.AuditEntry, int, error) {
+	var conds []string
+	var args []interface{}
+	if f.AdminID != "" {
+		args = append(args, f.AdminID)
+		conds = append(conds, fmt.Sprintf(`admin_id = $%d`, len(args)))
+	}
+	if f.Action != "" {
+		args = append(args, escapeLike(f.Action)+"%")
+		conds = append(conds, fmt.Sprintf(`action LIKE $%d`, len(args)))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM admin_audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	query := `SELECT id, admin_id, username, action, target, status, ip, detail, created_at FROM admin_audit_log` + where +
+		fmt.Sprintf(` ORDER BY id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []*domain.AuditEntry
+	for rows.Next() {
+		e := &domain.AuditEntry{}
+		if err := rows.Scan(&e.ID, &e.AdminID, &e.Username, &e.Action, &e.Target, &e.Status, &e.IP, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+var _ domain.AuditLogRepository = (*AuditLogRepository)(nil)
@@ -2,30 +2,32 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"link/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CardRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewCardRepository(pool *pgxpool.Pool) *CardRepository {
-	return &CardRepository{pool: pool}
+func NewCardRepository(db DBTX) *CardRepository {
+	return &CardRepository{db: db}
 }
 
 func (r *CardRepository) FindByToken(ctx context.Context, token string) (*domain.Card, error) {
 	query := `
-		SELECT id, user_id, card_token, card_type, status, created_at, activated_at, revoked_at
+		SELECT id, user_id, card_token, card_type, status, key_version, created_at, activated_at, revoked_at
 		FROM cards WHERE card_token = $1
 	`
 	card := &domain.Card{}
-	err := r.pool.QueryRow(ctx, query, token).Scan(
+	err := r.db.QueryRow(ctx, query, token).Scan(
 		&card.ID, &card.UserID, &card.CardToken, &card.CardType,
-		&card.Status, &card.CreatedAt, &card.ActivatedAt, &card.RevokedAt,
+		&card.Status, &card.KeyVersion, &card.CreatedAt, &card.ActivatedAt, &card.RevokedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -38,10 +40,22 @@ func (r *CardRepository) FindByToken(ctx context.Context, token string) (*domain
 
 func (r *CardRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Card, error) {
 	query := `
-		SELECT id, user_id, card_token, card_type, status, created_at, activated_at, revoked_at
+		SELECT id, user_id, card_token, card_type, status, key_version, created_at, activated_at, revoked_at
 		FROM cards WHERE user_id = $1
 	`
-	rows, err := r.pool.Query(ctx, query, userID)
+	return r.findMany(ctx, query, userID)
+}
+
+func (r *CardRepository) FindByUserIDs(ctx context.Context, userIDs []string) ([]*domain.Card, error) {
+	query := `
+		SELECT id, user_id, card_token, card_type, status, key_version, created_at, activated_at, revoked_at
+		FROM cards WHERE user_id = ANY($1)
+	`
+	return r.findMany(ctx, query, userIDs)
+}
+
+func (r *CardRepository) findMany(ctx context.Context, query string, arg interface{}) ([]*domain.Card, error) {
+	rows, err := r.db.Query(ctx, query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +65,7 @@ func (r *CardRepository) FindByUserID(ctx context.Context, userID string) ([]*do
 	for rows.Next() {
 		c := &domain.Card{}
 		if err := rows.Scan(&c.ID, &c.UserID, &c.CardToken, &c.CardType,
-			&c.Status, &c.CreatedAt, &c.ActivatedAt, &c.RevokedAt); err != nil {
+			&c.Status, &c.KeyVersion, &c.CreatedAt, &c.ActivatedAt, &c.RevokedAt); err != nil {
 			return nil, err
 		}
 		cards = append(cards, c)
@@ -61,13 +75,13 @@ func (r *CardRepository) FindByUserID(ctx context.Context, userID string) ([]*do
 
 func (r *CardRepository) FindActiveByUserAndType(ctx context.Context, userID string, cardType domain.CardType) (*domain.Card, error) {
 	query := `
-		SELECT id, user_id, card_token, card_type, status, created_at, activated_at, revoked_at
+		SELECT id, user_id, card_token, card_type, status, key_version, created_at, activated_at, revoked_at
 		FROM cards WHERE user_id = $1 AND card_type = $2 AND status = 'active'
 	`
 	card := &domain.Card{}
-	err := r.pool.QueryRow(ctx, query, userID, cardType).Scan(
+	err := r.db.QueryRow(ctx, query, userID, cardType).Scan(
 		&card.ID, &card.UserID, &card.CardToken, &card.CardType,
-		&card.Status, &card.CreatedAt, &card.ActivatedAt, &card.RevokedAt,
+		&card.Status, &card.KeyVersion, &card.CreatedAt, &card.ActivatedAt, &card.RevokedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -77,17 +91,22 @@ func (r *CardRepository) FindActiveByUserAndType(ctx context.Context, userID str
 
 func (r *CardRepository) Create(ctx context.Context, card *domain.Card) error {
 	query := `
-		INSERT INTO cards (user_id, card_token, card_type, status)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO cards (user_id, card_token, card_type, status, key_version)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
-	return r.pool.QueryRow(ctx, query,
-		card.UserID, card.CardToken, card.CardType, card.Status,
+	err := r.db.QueryRow(ctx, query,
+		card.UserID, card.CardToken, card.CardType, card.Status, card.KeyVersion,
 	).Scan(&card.ID, &card.CreatedAt)
+	// Two registrations racing for the same token
+	if isUniqueViolation(err) {
+		return domain.ErrConflict("此卡片已被註冊")
+	}
+	return err
 }
 
 func (r *CardRepository) Revoke(ctx context.Context, cardID string) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE cards SET status = 'revoked', revoked_at = NOW() WHERE id = $1`,
 		cardID,
 	)
@@ -95,72 +114,327 @@ func (r *CardRepository) Revoke(ctx context.Context, cardID string) error {
 }
 
 func (r *CardRepository) PromoteBackupToPrimary(ctx context.Context, cardID string) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE cards SET card_type = 'primary', activated_at = NOW() WHERE id = $1`,
 		cardID,
 	)
 	return err
 }
 
-func (r *CardRepository) CreatePair(ctx context.Context, primaryToken string) (*domain.CardPair, error) {
-	pair := &domain.CardPair{}
-	query := `
-		INSERT INTO card_pairs (primary_token)
-		VALUES ($1)
-		RETURNING id, primary_token, backup_token, created_at, expires_at
-	`
-	err := r.pool.QueryRow(ctx, query, primaryToken).Scan(
-		&pair.ID, &pair.PrimaryToken, &pair.BackupToken, &pair.CreatedAt, &pair.ExpiresAt,
+func (r *CardRepository) RecordEvent(ctx context.Context, userID, cardID string, event domain.CardEventType) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO card_events (user_id, card_id, event) VALUES ($1, $2, $3)`,
+		userID, cardID, event,
 	)
-	return pair, err
+	return err
 }
 
-func (r *CardRepository) FindPairByPrimaryToken(ctx context.Context, token string) (*domain.CardPair, error) {
+func (r *CardRepository) FindEventsByUser(ctx context.Context, userID string) ([]*domain.CardEvent, error) {
 	query := `
-		SELECT id, primary_token, backup_token, created_at, expires_at
-		FROM card_pairs WHERE primary_token = $1 AND expires_at > NOW()
+		SELECT id, user_id, COALESCE(card_id::text, ''), COALESCE(passkey_id::text, ''), event, created_at
+		FROM card_events WHERE user_id = $1
+		ORDER BY created_at
 	`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.CardEvent
+	for rows.Next() {
+		e := &domain.CardEvent{}
+		if err := rows.Scan(&e.ID, &e.UserID, &e.CardID, &e.PasskeyID, &e.Event, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+const pairColumns = `id, primary_token, backup_token, status, batch_id, serial_number, issued_to, issued_at,
+	shipped_at, created_at, expires_at, registered_at, registered_by, status_changed_at`
+
+func scanPair(row pgx.Row) (*domain.CardPair, error) {
 	pair := &domain.CardPair{}
-	err := r.pool.QueryRow(ctx, query, token).Scan(
-		&pair.ID, &pair.PrimaryToken, &pair.BackupToken, &pair.CreatedAt, &pair.ExpiresAt,
+	err := row.Scan(
+		&pair.ID, &pair.PrimaryToken, &pair.BackupToken, &pair.Status, &pair.BatchID, &pair.SerialNumber,
+		&pair.IssuedTo, &pair.IssuedAt, &pair.ShippedAt, &pair.CreatedAt, &pair.ExpiresAt,
+		&pair.RegisteredAt, &pair.RegisteredBy, &pair.StatusChangedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return pair, err
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
 }
 
-func (r *CardRepository) FindPairByBackupToken(ctx context.Context, token string) (*domain.CardPair, error) {
+func (r *CardRepository) CreatePair(ctx context.Context, primaryToken string) (*domain.CardPair, error) {
 	query := `
-		SELECT id, primary_token, backup_token, created_at, expires_at
-		FROM card_pairs WHERE backup_token = $1 AND expires_at > NOW()
-	`
-	pair := &domain.CardPair{}
-	err := r.pool.QueryRow(ctx, query, token).Scan(
-		&pair.ID, &pair.PrimaryToken, &pair.BackupToken, &pair.CreatedAt, &pair.ExpiresAt,
-	)
-	if err == pgx.ErrNoRows {
-		return nil, nil
+		INSERT INTO card_pairs (primary_token, issued_at)
+		VALUES ($1, NOW())
+		RETURNING ` + pairColumns
+	return scanPair(r.db.QueryRow(ctx, query, primaryToken))
+}
+
+func (r *CardRepository) CreatePairs(ctx context.Context, pairs []*domain.CardPair) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
 	}
-	return pair, err
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO card_pairs (primary_token, backup_token, status, batch_id, serial_number, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + pairColumns
+	for i, p := range pairs {
+		created, err := scanPair(tx.QueryRow(ctx, query,
+			p.PrimaryToken, p.BackupToken, p.Status, p.BatchID, p.SerialNumber, p.ExpiresAt,
+		))
+		if err != nil {
+			return err
+		}
+		pairs[i] = created
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *CardRepository) FindPairByID(ctx context.Context, id string) (*domain.CardPair, error) {
+	query := `SELECT ` + pairColumns + ` FROM card_pairs WHERE id = $1`
+	return scanPair(r.db.QueryRow(ctx, query, id))
+}
+
+func (r *CardRepository) FindPairByPrimaryToken(ctx context.Context, token string) (*domain.CardPair, error) {
+	query := `SELECT ` + pairColumns + ` FROM card_pairs WHERE primary_token = $1`
+	return scanPair(r.db.QueryRow(ctx, query, token))
+}
+
+func (r *CardRepository) FindPairByBackupToken(ctx context.Context, token string) (*domain.CardPair, error) {
+	query := `SELECT ` + pairColumns + ` FROM card_pairs WHERE backup_token = $1`
+	return scanPair(r.db.QueryRow(ctx, query, token))
+}
+
+func (r *CardRepository) FindPairsByBatch(ctx context.Context, batchID string) ([]*domain.CardPair, error) {
+	query := `SELECT ` + pairColumns + ` FROM card_pairs WHERE batch_id = $1 ORDER BY serial_number`
+	rows, err := r.db.Query(ctx, query, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []*domain.CardPair
+	for rows.Next() {
+		p, err := scanPair(rows)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
 }
 
 func (r *CardRepository) UpdatePairBackupToken(ctx context.Context, pairID, backupToken string) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE card_pairs SET backup_token = $2 WHERE id = $1`,
 		pairID, backupToken,
 	)
 	return err
 }
 
-func (r *CardRepository) DeletePair(ctx context.Context, pairID string) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM card_pairs WHERE id = $1`, pairID)
+func (r *CardRepository) ListPairs(ctx context.Context, filter domain.CardPairFilter) ([]*domain.CardPair, int, error) {
+	var conds []string
+	var args []interface{}
+
+	switch filter.State {
+	case domain.CardPairStateActivated:
+		conds = append(conds, `status = 'registered'`)
+	case domain.CardPairStateExpired:
+		conds = append(conds, `status = 'issued' AND expires_at <= NOW()`)
+	case domain.CardPairStateUnused:
+		conds = append(conds, `(status = 'manufactured' OR (status = 'issued' AND expires_at > NOW()))`)
+	}
+	if filter.Query != "" {
+		args = append(args, escapeLike(filter.Query)+"%")
+		conds = append(conds, `(primary_token LIKE $1 OR backup_token LIKE $1 OR serial_number LIKE $1)`)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM card_pairs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `SELECT ` + pairColumns + ` FROM card_pairs` + where +
+		fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var pairs []*domain.CardPair
+	for rows.Next() {
+		p, err := scanPair(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, total, rows.Err()
+}
+
+func (r *CardRepository) DeletePair(ctx context.Context, pairID string) (bool, error) {
+	result, err := r.db.Exec(ctx,
+		`DELETE FROM card_pairs WHERE id = $1 AND status IN ('manufactured', 'issued')`,
+		pairID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *CardRepository) ClaimPair(ctx context.Context, pairID string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE card_pairs SET status = 'registered', registered_at = NOW(), status_changed_at = NOW()
+		WHERE id = $1 AND status = 'issued' AND expires_at > NOW()
+	`, pairID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *CardRepository) SetPairRegisteredBy(ctx context.Context, pairID, userID string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE card_pairs SET registered_by = $2 WHERE id = $1`,
+		pairID, userID,
+	)
 	return err
 }
 
+func (r *CardRepository) IssuePair(ctx context.Context, pairID, issuedTo string, expiresAt time.Time) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE card_pairs
+		SET status = 'issued', issued_to = $2, issued_at = NOW(), expires_at = $3, status_changed_at = NOW()
+		WHERE id = $1 AND status = 'manufactured'
+	`, pairID, issuedTo, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *CardRepository) MarkPairShipped(ctx context.Context, pairID string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE card_pairs SET shipped_at = NOW()
+		WHERE id = $1 AND status IN ('issued', 'registered') AND shipped_at IS NULL
+	`, pairID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *CardRepository) UpdatePairStatus(ctx context.Context, pairID string, from, to domain.CardPairStatus) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE card_pairs SET status = $3, status_changed_at = NOW()
+		WHERE id = $1 AND status = $2
+	`, pairID, from, to)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
 func (r *CardRepository) CleanupExpiredPairs(ctx context.Context) error {
-	_, err := r.pool.Exec(ctx, `SELECT cleanup_expired_pairs()`)
+	_, err := r.db.Exec(ctx, `SELECT cleanup_expired_pairs()`)
+	return err
+}
+
+func (r *CardRepository) CreateTag(ctx context.Context, tag *domain.CardTag) error {
+	query := `
+		INSERT INTO card_tags (uid, card_token, key_version)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, updated_at
+	`
+	return r.db.QueryRow(ctx, query, tag.UID, tag.CardToken, tag.KeyVersion).Scan(&tag.CreatedAt, &tag.UpdatedAt)
+}
+
+func (r *CardRepository) FindTagByUID(ctx context.Context, uid string) (*domain.CardTag, error) {
+	return r.findTag(ctx, `uid = $1`, uid)
+}
+
+func (r *CardRepository) FindTagByToken(ctx context.Context, token string) (*domain.CardTag, error) {
+	return r.findTag(ctx, `card_token = $1`, token)
+}
+
+func (r *CardRepository) findTag(ctx context.Context, where string, arg string) (*domain.CardTag, error) {
+	query := `
+		SELECT uid, card_token, key_version, last_counter, created_at, updated_at
+		FROM card_tags WHERE ` + where
+	tag := &domain.CardTag{}
+	err := r.db.QueryRow(ctx, query, arg).Scan(
+		&tag.UID, &tag.CardToken, &tag.KeyVersion, &tag.LastCounter, &tag.CreatedAt, &tag.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return tag, err
+}
+
+func (r *CardRepository) AdvanceTagCounter(ctx context.Context, uid string, counter uint32) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE card_tags SET last_counter = $2
+		WHERE uid = $1 AND (last_counter IS NULL OR last_counter < $2)
+	`, uid, int64(counter))
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *CardRepository) CreateTapNonce(ctx context.Context, nonceHash, token string, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		DELETE FROM card_tap_nonces WHERE card_token = $1 OR expires_at <= NOW()
+	`, token)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO card_tap_nonces (nonce_hash, card_token, expires_at) VALUES ($1, $2, $3)
+	`, nonceHash, token, expiresAt)
 	return err
 }
 
+func (r *CardRepository) TapNonceValid(ctx context.Context, nonceHash, token string) (bool, error) {
+	var valid bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM card_tap_nonces
+			WHERE nonce_hash = $1 AND card_token = $2 AND expires_at > NOW()
+		)
+	`, nonceHash, token).Scan(&valid)
+	return valid, err
+}
+
+func (r *CardRepository) UseTapNonce(ctx context.Context, nonceHash, token string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		DELETE FROM card_tap_nonces
+		WHERE nonce_hash = $1 AND card_token = $2 AND expires_at > NOW()
+	`, nonceHash, token)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
 var _ domain.CardRepository = (*CardRepository)(nil)
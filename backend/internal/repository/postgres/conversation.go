@@ -6,15 +6,14 @@ import (
 	"link/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ConversationRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewConversationRepository(pool *pgxpool.Pool) *ConversationRepository {
-	return &ConversationRepository{pool: pool}
+func NewConversationRepository(db DBTX) *ConversationRepository {
+	return &ConversationRepository{db: db}
 }
 
 func (r *ConversationRepository) Create(ctx context.Context, c *domain.Conversation) error {
@@ -27,7 +26,7 @@ func (r *ConversationRepository) Create(ctx context.Context, c *domain.Conversat
 		VALUES ($1, $2)
 		RETURNING id, created_at
 	`
-	return r.pool.QueryRow(ctx, query, p1, p2).Scan(&c.ID, &c.CreatedAt)
+	return r.db.QueryRow(ctx, query, p1, p2).Scan(&c.ID, &c.CreatedAt)
 }
 
 func (r *ConversationRepository) FindByID(ctx context.Context, id string) (*domain.Conversation, error) {
@@ -36,7 +35,7 @@ func (r *ConversationRepository) FindByID(ctx context.Context, id string) (*doma
 		FROM conversations WHERE id = $1
 	`
 	c := &domain.Conversation{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&c.ID, &c.Participant1, &c.Participant2, &c.LastMessageAt, &c.CreatedAt,
 	)
 	if err == pgx.ErrNoRows {
@@ -55,7 +54,7 @@ func (r *ConversationRepository) FindByParticipants(ctx context.Context, userA,
 		FROM conversations WHERE participant_1 = $1 AND participant_2 = $2
 	`
 	c := &domain.Conversation{}
-	err := r.pool.QueryRow(ctx, query, p1, p2).Scan(
+	err := r.db.QueryRow(ctx, query, p1, p2).Scan(
 		&c.ID, &c.Participant1, &c.Participant2, &c.LastMessageAt, &c.CreatedAt,
 	)
 	if err == pgx.ErrNoRows {
@@ -64,25 +63,27 @@ func (r *ConversationRepository) FindByParticipants(ctx context.Context, userA,
 	return c, err
 }
 
-func (r *ConversationRepository) FindByUser(ctx context.Context, userID string) ([]*domain.ConversationWithPeer, error) {
-	query := `
-		SELECT c.id, c.participant_1, c.participant_2, c.last_message_at, c.created_at,
-		       u.id, u.nickname, u.public_key, u.avatar_url, u.last_seen_at,
-		       COALESCE((
-		           SELECT COUNT(*) FROM messages m
-		           WHERE m.conversation_id = c.id AND m.sender_id != $1 AND m.read_at IS NULL
-		       ), 0) as unread
-		FROM conversations c
-		JOIN users u ON (
-			CASE
-				WHEN c.participant_1 = $1 THEN c.participant_2 = u.id
-				ELSE c.participant_1 = u.id
-			END
-		)
-		WHERE c.participant_1 = $1 OR c.participant_2 = $1
-		ORDER BY c.last_message_at DESC NULLS LAST
-	`
-	rows, err := r.pool.Query(ctx, query, userID)
+// conversationWithPeerQuery selects the conversations of user $1 with the other participant and
+// the unread count; callers append conditions and ordering
+const conversationWithPeerQuery = `
+	SELECT c.id, c.participant_1, c.participant_2, c.last_message_at, c.created_at, c.sync_xid, c.seq,
+	       u.id, u.nickname, u.public_key, u.avatar_url, u.last_seen_at,
+	       COALESCE((
+	           SELECT COUNT(*) FROM messages m
+	           WHERE m.conversation_id = c.id AND m.sender_id != $1 AND m.read_at IS NULL
+	       ), 0) as unread
+	FROM conversations c
+	JOIN users u ON (
+		CASE
+			WHEN c.participant_1 = $1 THEN c.participant_2 = u.id
+			ELSE c.participant_1 = u.id
+		END
+	)
+	WHERE (c.participant_1 = $1 OR c.participant_2 = $1)
+`
+
+func (r *ConversationRepository) queryWithPeer(ctx context.Context, query string, args ...interface{}) ([]*domain.ConversationWithPeer, error) {
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +93,7 @@ func (r *ConversationRepository) FindByUser(ctx context.Context, userID string)
 	for rows.Next() {
 		cw := &domain.ConversationWithPeer{Peer: &domain.User{}}
 		err := rows.Scan(
-			&cw.ID, &cw.Participant1, &cw.Participant2, &cw.LastMessageAt, &cw.CreatedAt,
+			&cw.ID, &cw.Participant1, &cw.Participant2, &cw.LastMessageAt, &cw.CreatedAt, &cw.Sync.XID, &cw.Sync.Seq,
 			&cw.Peer.ID, &cw.Peer.Nickname, &cw.Peer.PublicKey, &cw.Peer.AvatarURL, &cw.Peer.LastSeenAt,
 			&cw.UnreadCount,
 		)
@@ -104,6 +105,44 @@ func (r *ConversationRepository) FindByUser(ctx context.Context, userID string)
 	return result, rows.Err()
 }
 
+func (r *ConversationRepository) FindByUser(ctx context.Context, userID string) ([]*domain.ConversationWithPeer, error) {
+	return r.queryWithPeer(ctx, conversationWithPeerQuery+` ORDER BY c.last_message_at DESC NULLS LAST`, userID)
+}
+
+func (r *ConversationRepository) FindChangedSince(ctx context.Context, userID string, since domain.SyncPosition, horizon int64, limit int) ([]*domain.ConversationWithPeer, error) {
+	return r.queryWithPeer(ctx, conversationWithPeerQuery+`
+		AND (c.sync_xid, c.seq) > ($2, $3) AND c.sync_xid < $4
+		ORDER BY c.sync_xid, c.seq LIMIT $5`,
+		userID, since.XID, since.Seq, horizon, limit,
+	)
+}
+
+func (r *ConversationRepository) FindDeletedSince(ctx context.Context, userID string, since domain.SyncPosition, horizon int64, limit int) ([]*domain.ConversationDeletion, error) {
+	query := `
+		SELECT conversation_id, deleted_at, sync_xid, seq
+		FROM conversation_deletions
+		WHERE (participant_1 = $1 OR participant_2 = $1)
+		  AND (sync_xid, seq) > ($2, $3) AND sync_xid < $4
+		ORDER BY sync_xid, seq
+		LIMIT $5
+	`
+	rows, err := r.db.Query(ctx, query, userID, since.XID, since.Seq, horizon, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*domain.ConversationDeletion
+	for rows.Next() {
+		d := &domain.ConversationDeletion{}
+		if err := rows.Scan(&d.ID, &d.DeletedAt, &d.Sync.XID, &d.Sync.Seq); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
 func (r *ConversationRepository) GetOrCreate(ctx context.Context, userA, userB string) (*domain.Conversation, error) {
 	conv, err := r.FindByParticipants(ctx, userA, userB)
 	if err != nil {
@@ -6,15 +6,14 @@ import (
 	"link/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type FriendshipRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewFriendshipRepository(pool *pgxpool.Pool) *FriendshipRepository {
-	return &FriendshipRepository{pool: pool}
+func NewFriendshipRepository(db DBTX) *FriendshipRepository {
+	return &FriendshipRepository{db: db}
 }
 
 func (r *FriendshipRepository) Create(ctx context.Context, f *domain.Friendship) error {
@@ -23,7 +22,7 @@ func (r *FriendshipRepository) Create(ctx context.Context, f *domain.Friendship)
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at, updated_at
 	`
-	return r.pool.QueryRow(ctx, query,
+	return r.db.QueryRow(ctx, query,
 		f.RequesterID, f.AddresseeID, f.Status,
 	).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt)
 }
@@ -36,7 +35,7 @@ func (r *FriendshipRepository) FindByUsers(ctx context.Context, userA, userB str
 		   OR (requester_id = $2 AND addressee_id = $1)
 	`
 	f := &domain.Friendship{}
-	err := r.pool.QueryRow(ctx, query, userA, userB).Scan(
+	err := r.db.QueryRow(ctx, query, userA, userB).Scan(
 		&f.ID, &f.RequesterID, &f.AddresseeID, &f.Status, &f.CreatedAt, &f.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
@@ -59,7 +58,7 @@ func (r *FriendshipRepository) FindFriends(ctx context.Context, userID string) (
 		WHERE (f.requester_id = $1 OR f.addressee_id = $1)
 		  AND f.status = 'accepted'
 	`
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +87,7 @@ func (r *FriendshipRepository) FindPendingRequests(ctx context.Context, userID s
 		JOIN users u ON f.requester_id = u.id
 		WHERE f.addressee_id = $1 AND f.status = 'pending'
 	`
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +109,7 @@ func (r *FriendshipRepository) FindPendingRequests(ctx context.Context, userID s
 }
 
 func (r *FriendshipRepository) UpdateStatus(ctx context.Context, id string, status domain.FriendshipStatus) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE friendships SET status = $2 WHERE id = $1`,
 		id, status,
 	)
@@ -118,7 +117,7 @@ func (r *FriendshipRepository) UpdateStatus(ctx context.Context, id string, stat
 }
 
 func (r *FriendshipRepository) Delete(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM friendships WHERE id = $1`, id)
+	_, err := r.db.Exec(ctx, `DELETE FROM friendships WHERE id = $1`, id)
 	return err
 }
 
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type LoginAttemptRepository struct {
+	db DBTX
+}
+
+func NewLoginAttemptRepository(db DBTX) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+const loginAttemptColumns = `card_id, failures, unreported, locked_until, last_failed_at`
+
+func scanLoginAttempts(row pgx.Row) (*domain.LoginAttempts, error) {
+	a := &domain.LoginAttempts{}
+	err := row.Scan(&a.CardID, &a.Failures, &a.Unreported, &a.LockedUntil, &a.LastFailedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *LoginAttemptRepository) Acquire(ctx context.Context, cardID string) (*domain.LoginAttempts, error) {
+	// The no-op update takes the row lock even when the row already exists
+	query := `
+		INSERT INTO card_login_attempts (card_id) VALUES ($1)
+		ON CONFLICT (card_id) DO UPDATE SET card_id = EXCLUDED.card_id
+		RETURNING ` + loginAttemptColumns
+	return scanLoginAttempts(r.db.QueryRow(ctx, query, cardID))
+}
+
+func (r *LoginAttemptRepository) Reserve(ctx context.Context, cardID string, lockedUntil *time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE card_login_attempts SET failures = failures + 1, locked_until = $2 WHERE card_id = $1`,
+		cardID, lockedUntil,
+	)
+	return err
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, cardID string) (*domain.LoginAttempts, error) {
+	query := `
+		UPDATE card_login_attempts SET unreported = unreported + 1, last_failed_at = NOW()
+		WHERE card_id = $1
+		RETURNING ` + loginAttemptColumns
+	return scanLoginAttempts(r.db.QueryRow(ctx, query, cardID))
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, cardID string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE card_login_attempts SET failures = 0, locked_until = NULL WHERE card_id = $1`,
+		cardID,
+	)
+	return err
+}
+
+func (r *LoginAttemptRepository) TakeUnreported(ctx context.Context, userID string) (*domain.LoginFailureNotice, error) {
+	query := `
+		WITH taken AS (
+			SELECT a.card_id, a.unreported, a.last_failed_at
+			FROM card_login_attempts a
+			JOIN cards c ON c.id = a.card_id
+			WHERE c.user_id = $1 AND a.unreported > 0
+			FOR UPDATE OF a
+		), cleared AS (
+			UPDATE card_login_attempts SET unreported = 0
+			WHERE card_id IN (SELECT card_id FROM taken)
+		)
+		SELECT COALESCE(SUM(unreported), 0), MAX(last_failed_at) FROM taken
+	`
+	var count int
+	var last *time.Time
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&count, &last); err != nil {
+		return nil, err
+	}
+	if count == 0 || last == nil {
+		return nil, nil
+	}
+	return &domain.LoginFailureNotice{FailedAttempts: count, LastFailedAt: *last}, nil
+}
+
+var _ domain.LoginAttemptRepository = (*LoginAttemptRepository)(nil)
@@ -2,112 +2,257 @@ package postgres
 
 import (
 	"context"
-	"time"
+	"fmt"
+	"strings"
 
 	"link/internal/domain"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
 type MessageRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewMessageRepository(pool *pgxpool.Pool) *MessageRepository {
-	return &MessageRepository{pool: pool}
+func NewMessageRepository(db DBTX) *MessageRepository {
+	return &MessageRepository{db: db}
 }
 
-func (r *MessageRepository) Create(ctx context.Context, msg *domain.Message) error {
-	query := `
-		INSERT INTO messages (conversation_id, sender_id, encrypted_content)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at
-	`
-	return r.pool.QueryRow(ctx, query,
-		msg.ConversationID, msg.SenderID, msg.EncryptedContent,
-	).Scan(&msg.ID, &msg.CreatedAt)
-}
-
-func (r *MessageRepository) FindByConversation(ctx context.Context, convID string, limit int, before *time.Time) ([]*domain.Message, error) {
-	var query string
-	var args []interface{}
-
-	if before != nil {
-		query = `
-			SELECT id, conversation_id, sender_id, encrypted_content, created_at, delivered_at, read_at
-			FROM messages
-			WHERE conversation_id = $1 AND created_at < $2
-			ORDER BY created_at DESC
-			LIMIT $3
-		`
-		args = []interface{}{convID, before, limit}
-	} else {
-		query = `
-			SELECT id, conversation_id, sender_id, encrypted_content, created_at, delivered_at, read_at
-			FROM messages
-			WHERE conversation_id = $1
-			ORDER BY created_at DESC
-			LIMIT $2
-		`
-		args = []interface{}{convID, limit}
-	}
-
-	rows, err := r.pool.Query(ctx, query, args...)
+const messageColumns = `m.id, m.conversation_id, m.sender_id, m.encrypted_content, m.created_at, m.delivered_at, m.read_at,
+	COALESCE(m.temp_id, ''), m.sync_xid, m.seq`
+
+func scanMessage(row pgx.Row) (*domain.Message, error) {
+	m := &domain.Message{}
+	err := row.Scan(
+		&m.ID, &m.ConversationID, &m.SenderID, &m.EncryptedContent,
+		&m.CreatedAt, &m.DeliveredAt, &m.ReadAt, &m.TempID, &m.Sync.XID, &m.Sync.Seq,
+	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return m, nil
+}
 
+func collectMessages(rows pgx.Rows) ([]*domain.Message, error) {
+	defer rows.Close()
 	var messages []*domain.Message
 	for rows.Next() {
-		m := &domain.Message{}
-		if err := rows.Scan(
-			&m.ID, &m.ConversationID, &m.SenderID, &m.EncryptedContent,
-			&m.CreatedAt, &m.DeliveredAt, &m.ReadAt,
-		); err != nil {
+		m, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, m)
 	}
+	return messages, rows.Err()
+}
+
+func (r *MessageRepository) Create(ctx context.Context, msg *domain.Message) (bool, error) {
+	query := `
+		INSERT INTO messages (conversation_id, sender_id, encrypted_content, temp_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (sender_id, temp_id) WHERE temp_id IS NOT NULL DO NOTHING
+		RETURNING id, created_at, sync_xid, seq
+	`
+	err := r.db.QueryRow(ctx, query,
+		msg.ConversationID, msg.SenderID, msg.EncryptedContent, msg.TempID,
+	).Scan(&msg.ID, &msg.CreatedAt, &msg.Sync.XID, &msg.Sync.Seq)
+	if err != pgx.ErrNoRows {
+		return err == nil, err
+	}
 
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	// A retry of an earlier send
+	existing, err := r.FindByTempID(ctx, msg.SenderID, msg.TempID)
+	if err != nil {
+		return false, err
 	}
+	if existing == nil {
+		return false, pgx.ErrNoRows
+	}
+	*msg = *existing
+	return false, nil
+}
 
-	return messages, rows.Err()
+func (r *MessageRepository) FindByTempID(ctx context.Context, senderID, tempID string) (*domain.Message, error) {
+	msg, err := scanMessage(r.db.QueryRow(ctx,
+		`SELECT `+messageColumns+` FROM messages m WHERE m.sender_id = $1 AND m.temp_id = $2`,
+		senderID, tempID,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return msg, err
 }
 
-func (r *MessageRepository) FindByID(ctx context.Context, id string) (*domain.Message, error) {
+// keysetCondition compares (created_at, id) with the cursor, falling back to created_at alone
+// for cursors that only carry a time
+func keysetCondition(op string, cursor *domain.MessageCursor, args *[]interface{}) string {
+	*args = append(*args, cursor.CreatedAt)
+	if cursor.ID == "" {
+		return fmt.Sprintf(`m.created_at %s $%d`, op, len(*args))
+	}
+	*args = append(*args, cursor.ID)
+	return fmt.Sprintf(`(m.created_at, m.id) %s ($%d, $%d)`, op, len(*args)-1, len(*args))
+}
+
+func (r *MessageRepository) FindByConversation(ctx context.Context, convID string, page domain.MessagePage) ([]*domain.Message, error) {
+	args := []interface{}{convID}
+	conds := []string{`m.conversation_id = $1`}
+	if page.After != nil {
+		conds = append(conds, keysetCondition(">", page.After, &args))
+	}
+	if page.Before != nil {
+		conds = append(conds, keysetCondition("<", page.Before, &args))
+	}
+
+	// Reading forward from After takes the oldest matches, otherwise the newest
+	order := `DESC`
+	if page.After != nil {
+		order = `ASC`
+	}
+	args = append(args, page.Limit)
+	query := `SELECT ` + messageColumns + ` FROM messages m WHERE ` + strings.Join(conds, " AND ") +
+		fmt.Sprintf(` ORDER BY m.created_at %s, m.id %s LIMIT $%d`, order, order, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := collectMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.After == nil {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, nil
+}
+
+func (r *MessageRepository) FindAllByUser(ctx context.Context, userID string) ([]*domain.Message, error) {
 	query := `
-		SELECT id, conversation_id, sender_id, encrypted_content, created_at, delivered_at, read_at
-		FROM messages WHERE id = $1
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.participant_1 = $1 OR c.participant_2 = $1
+		ORDER BY m.created_at, m.id
 	`
-	m := &domain.Message{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&m.ID, &m.ConversationID, &m.SenderID, &m.EncryptedContent,
-		&m.CreatedAt, &m.DeliveredAt, &m.ReadAt,
-	)
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return collectMessages(rows)
+}
+
+func (r *MessageRepository) SyncHorizon(ctx context.Context) (int64, error) {
+	var horizon int64
+	err := r.db.QueryRow(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&horizon)
+	return horizon, err
+}
+
+func (r *MessageRepository) FindChangedSince(ctx context.Context, userID string, since domain.SyncPosition, horizon int64, limit int) ([]*domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE (c.participant_1 = $1 OR c.participant_2 = $1)
+		  AND (m.sync_xid, m.seq) > ($2, $3) AND m.sync_xid < $4
+		ORDER BY m.sync_xid, m.seq
+		LIMIT $5
+	`
+	rows, err := r.db.Query(ctx, query, userID, since.XID, since.Seq, horizon, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectMessages(rows)
+}
+
+func (r *MessageRepository) FindDeletedSince(ctx context.Context, userID string, since domain.SyncPosition, horizon int64, limit int) ([]*domain.MessageDeletion, error) {
+	query := `
+		SELECT d.message_id, d.conversation_id, d.deleted_at, d.sync_xid, d.seq
+		FROM message_deletions d
+		JOIN conversations c ON c.id = d.conversation_id
+		WHERE (c.participant_1 = $1 OR c.participant_2 = $1)
+		  AND (d.sync_xid, d.seq) > ($2, $3) AND d.sync_xid < $4
+		ORDER BY d.sync_xid, d.seq
+		LIMIT $5
+	`
+	rows, err := r.db.Query(ctx, query, userID, since.XID, since.Seq, horizon, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*domain.MessageDeletion
+	for rows.Next() {
+		d := &domain.MessageDeletion{}
+		if err := rows.Scan(&d.ID, &d.ConversationID, &d.DeletedAt, &d.Sync.XID, &d.Sync.Seq); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *MessageRepository) FindByID(ctx context.Context, id string) (*domain.Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages m WHERE m.id = $1`
+	return scanMessage(r.db.QueryRow(ctx, query, id))
 }
 
 func (r *MessageRepository) Delete(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM messages WHERE id = $1`, id)
+	query := `
+		WITH deleted AS (
+			DELETE FROM messages WHERE id = $1 RETURNING id, conversation_id
+		)
+		INSERT INTO message_deletions (message_id, conversation_id)
+		SELECT id, conversation_id FROM deleted
+	`
+	_, err := r.db.Exec(ctx, query, id)
 	return err
 }
 
-func (r *MessageRepository) MarkDelivered(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx,
-		`UPDATE messages SET delivered_at = NOW() WHERE id = $1 AND delivered_at IS NULL`,
-		id,
-	)
-	return err
+func (r *MessageRepository) FindUndelivered(ctx context.Context, recipientID string, after *domain.MessageCursor, limit int) ([]*domain.Message, error) {
+	args := []interface{}{recipientID}
+	conds := []string{
+		`(c.participant_1 = $1 OR c.participant_2 = $1)`,
+		`m.sender_id <> $1`,
+		`m.delivered_at IS NULL`,
+	}
+	if after != nil {
+		conds = append(conds, keysetCondition(">", after, &args))
+	}
+	args = append(args, limit)
+	query := `SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE ` + strings.Join(conds, " AND ") +
+		fmt.Sprintf(` ORDER BY m.created_at, m.id LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectMessages(rows)
+}
+
+func (r *MessageRepository) MarkDelivered(ctx context.Context, id, recipientID string) (*domain.Message, error) {
+	query := `
+		UPDATE messages m SET delivered_at = NOW()
+		FROM conversations c
+		WHERE m.id = $1 AND c.id = m.conversation_id
+		  AND (c.participant_1 = $2 OR c.participant_2 = $2) AND m.sender_id <> $2
+		  AND m.delivered_at IS NULL
+		RETURNING ` + messageColumns
+	m, err := scanMessage(r.db.QueryRow(ctx, query, id, recipientID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return m, err
 }
 
 func (r *MessageRepository) MarkRead(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE messages SET read_at = NOW() WHERE id = $1 AND read_at IS NULL`,
 		id,
 	)
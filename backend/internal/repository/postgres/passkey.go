@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PasskeyRepository struct {
+	db DBTX
+}
+
+func NewPasskeyRepository(db DBTX) *PasskeyRepository {
+	return &PasskeyRepository{db: db}
+}
+
+var _ domain.PasskeyRepository = (*PasskeyRepository)(nil)
+
+const passkeyColumns = `id, user_id, credential_id, public_key, sign_count, aaguid, name, status,
+	created_at, last_used_at, revoked_at`
+
+func scanPasskey(row pgx.Row) (*domain.Passkey, error) {
+	p := &domain.Passkey{}
+	var signCount int64
+	err := row.Scan(
+		&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &signCount, &p.AAGUID, &p.Name, &p.Status,
+		&p.CreatedAt, &p.LastUsedAt, &p.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.SignCount = uint32(signCount)
+	return p, nil
+}
+
+func (r *PasskeyRepository) Create(ctx context.Context, p *domain.Passkey) error {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, aaguid, name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at
+	`
+	return r.db.QueryRow(ctx, query,
+		p.UserID, p.CredentialID, p.PublicKey, int64(p.SignCount), p.AAGUID, p.Name,
+	).Scan(&p.ID, &p.Status, &p.CreatedAt)
+}
+
+func (r *PasskeyRepository) FindByCredentialID(ctx context.Context, credentialID []byte) (*domain.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = $1`
+	p, err := scanPasskey(r.db.QueryRow(ctx, query, credentialID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (r *PasskeyRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []*domain.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+func (r *PasskeyRepository) UpdateUsage(ctx context.Context, passkeyID string, signCount uint32) (bool, error) {
+	// Authenticators without a counter always report 0, which cannot be ordered
+	query := `
+		UPDATE passkeys SET sign_count = $2, last_used_at = NOW()
+		WHERE id = $1 AND status = 'active' AND ($2 = 0 OR sign_count < $2)
+	`
+	tag, err := r.db.Exec(ctx, query, passkeyID, int64(signCount))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PasskeyRepository) Revoke(ctx context.Context, userID, passkeyID string) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE passkeys SET status = 'revoked', revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND status = 'active'`,
+		passkeyID, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PasskeyRepository) RevokeAllByUser(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Query(ctx,
+		`UPDATE passkeys SET status = 'revoked', revoked_at = NOW() WHERE user_id = $1 AND status = 'active' RETURNING id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (r *PasskeyRepository) RecordEvent(ctx context.Context, userID, passkeyID string, event domain.CardEventType) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO card_events (user_id, passkey_id, event) VALUES ($1, $2, $3)`,
+		userID, passkeyID, event,
+	)
+	return err
+}
+
+func (r *PasskeyRepository) CreateChallenge(ctx context.Context, c *domain.WebAuthnChallenge) error {
+	query := `
+		WITH expired AS (
+			DELETE FROM webauthn_challenges WHERE expires_at < NOW()
+		)
+		INSERT INTO webauthn_challenges (user_id, purpose, challenge, expires_at)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4)
+		RETURNING id
+	`
+	return r.db.QueryRow(ctx, query, c.UserID, c.Purpose, c.Challenge, c.ExpiresAt).Scan(&c.ID)
+}
+
+func (r *PasskeyRepository) TakeChallenge(ctx context.Context, id string, purpose domain.WebAuthnPurpose) (*domain.WebAuthnChallenge, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE id = $1 AND purpose = $2 AND expires_at > NOW()
+		RETURNING id, COALESCE(user_id::text, ''), purpose, challenge, expires_at
+	`
+	c := &domain.WebAuthnChallenge{}
+	err := r.db.QueryRow(ctx, query, id, purpose).Scan(&c.ID, &c.UserID, &c.Purpose, &c.Challenge, &c.ExpiresAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type RefreshTokenRepository struct {
+	db DBTX
+}
+
+func NewRefreshTokenRepository(db DBTX) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, rt *domain.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRow(ctx, query, rt.SessionID, rt.TokenHash, rt.ExpiresAt).Scan(&rt.ID, &rt.CreatedAt)
+}
+
+func (r *RefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	query := `
+		SELECT id, session_id, token_hash, created_at, expires_at, used_at
+		FROM refresh_tokens WHERE token_hash = $1
+	`
+	rt := &domain.RefreshToken{}
+	err := r.db.QueryRow(ctx, query, hash).Scan(
+		&rt.ID, &rt.SessionID, &rt.TokenHash, &rt.CreatedAt, &rt.ExpiresAt, &rt.UsedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return rt, err
+}
+
+func (r *RefreshTokenRepository) Consume(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	// Single statement so two concurrent refreshes cannot both succeed
+	query := `
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL
+		RETURNING id, session_id, token_hash, created_at, expires_at, used_at
+	`
+	rt := &domain.RefreshToken{}
+	err := r.db.QueryRow(ctx, query, hash).Scan(
+		&rt.ID, &rt.SessionID, &rt.TokenHash, &rt.CreatedAt, &rt.ExpiresAt, &rt.UsedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return rt, err
+}
+
+var _ domain.RefreshTokenRepository = (*RefreshTokenRepository)(nil)
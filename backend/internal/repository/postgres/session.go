@@ -2,63 +2,126 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"link/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const sessionColumns = `id, user_id, token_hash, ip, user_agent, created_at, last_used_at, expires_at, revoked_at`
+
 type SessionRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewSessionRepository(pool *pgxpool.Pool) *SessionRepository {
-	return &SessionRepository{pool: pool}
+func NewSessionRepository(db DBTX) *SessionRepository {
+	return &SessionRepository{db: db}
 }
 
 func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
 	query := `
-		INSERT INTO sessions (user_id, token_hash, expires_at)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at
+		INSERT INTO sessions (user_id, token_hash, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_used_at
 	`
-	return r.pool.QueryRow(ctx, query,
-		session.UserID, session.TokenHash, session.ExpiresAt,
-	).Scan(&session.ID, &session.CreatedAt)
+	return r.db.QueryRow(ctx, query,
+		session.UserID, session.TokenHash, session.IP, session.UserAgent, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+}
+
+func (r *SessionRepository) FindByID(ctx context.Context, id string) (*domain.Session, error) {
+	return r.findOne(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id)
 }
 
 func (r *SessionRepository) FindByTokenHash(ctx context.Context, hash string) (*domain.Session, error) {
+	return r.findOne(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE token_hash = $1`, hash)
+}
+
+func (r *SessionRepository) FindActiveByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
 	query := `
-		SELECT id, user_id, token_hash, created_at, expires_at, revoked_at
-		FROM sessions WHERE token_hash = $1
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
 	`
-	s := &domain.Session{}
-	err := r.pool.QueryRow(ctx, query, hash).Scan(
-		&s.ID, &s.UserID, &s.TokenHash, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt,
-	)
-	if err == pgx.ErrNoRows {
-		return nil, nil
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
 	}
-	return s, err
+	defer rows.Close()
+
+	var sessions []*domain.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) Touch(ctx context.Context, id string, client domain.ClientInfo) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE sessions SET last_used_at = NOW(), ip = $2, user_agent = $3 WHERE id = $1`,
+		id, client.IP, client.UserAgent,
+	)
+	return err
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, id, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE sessions SET token_hash = $2, expires_at = $3 WHERE id = $1 AND revoked_at IS NULL`,
+		id, tokenHash, expiresAt,
+	)
+	return err
 }
 
 func (r *SessionRepository) RevokeAllByUser(ctx context.Context, userID string) error {
-	_, err := r.pool.Exec(ctx,
+	_, err := r.db.Exec(ctx,
 		`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
 		userID,
 	)
 	return err
 }
 
+func (r *SessionRepository) RevokeOthers(ctx context.Context, userID, keepID string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`,
+		userID, keepID,
+	)
+	return err
+}
+
 func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, id)
+	_, err := r.db.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, id)
 	return err
 }
 
 func (r *SessionRepository) CleanupExpired(ctx context.Context) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`)
+	_, err := r.db.Exec(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`)
 	return err
 }
 
+func (r *SessionRepository) findOne(ctx context.Context, query string, arg interface{}) (*domain.Session, error) {
+	s, err := scanSession(r.db.QueryRow(ctx, query, arg))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+func scanSession(row pgx.Row) (*domain.Session, error) {
+	s := &domain.Session{}
+	err := row.Scan(
+		&s.ID, &s.UserID, &s.TokenHash, &s.IP, &s.UserAgent,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 var _ domain.SessionRepository = (*SessionRepository)(nil)
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+
+	"link/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UnitOfWork struct {
+	pool *pgxpool.Pool
+}
+
+func NewUnitOfWork(pool *pgxpool.Pool) *UnitOfWork {
+	return &UnitOfWork{pool: pool}
+}
+
+var _ domain.UnitOfWork = (*UnitOfWork)(nil)
+
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos *domain.Repositories) error) error {
+	tx, err := u.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Also rolls back if fn panics; a no-op once committed
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	repos := &domain.Repositories{
+		Users:         NewUserRepository(tx),
+		Cards:         NewCardRepository(tx),
+		Passkeys:      NewPasskeyRepository(tx),
+		Sessions:      NewSessionRepository(tx),
+		RefreshTokens: NewRefreshTokenRepository(tx),
+		Friendships:   NewFriendshipRepository(tx),
+		LoginAttempts: NewLoginAttemptRepository(tx),
+	}
+	if err := fn(repos); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
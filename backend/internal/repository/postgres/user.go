@@ -2,19 +2,21 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"link/internal/domain"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserRepository struct {
-	pool *pgxpool.Pool
+	db DBTX
 }
 
-func NewUserRepository(pool *pgxpool.Pool) *UserRepository {
-	return &UserRepository{pool: pool}
+func NewUserRepository(db DBTX) *UserRepository {
+	return &UserRepository{db: db}
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
@@ -23,7 +25,7 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at, updated_at
 	`
-	return r.pool.QueryRow(ctx, query,
+	return r.db.QueryRow(ctx, query,
 		user.PasswordHash,
 		user.Nickname,
 		user.PublicKey,
@@ -33,16 +35,23 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 
 func (r *UserRepository) FindByID(ctx context.Context, id string) (*domain.User, error) {
 	query := `
-		SELECT id, password_hash, nickname, public_key, avatar_url, created_at, updated_at, last_seen_at
+		SELECT id, password_hash, nickname, public_key, avatar_url, status, suspended_at, suspend_reason,
+		       delete_after, frozen_at, unfreeze_before, created_at, updated_at, last_seen_at
 		FROM users WHERE id = $1
 	`
 	user := &domain.User{}
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&user.ID,
 		&user.PasswordHash,
 		&user.Nickname,
 		&user.PublicKey,
 		&user.AvatarURL,
+		&user.Status,
+		&user.SuspendedAt,
+		&user.SuspendReason,
+		&user.DeleteAfter,
+		&user.FrozenAt,
+		&user.UnfreezeBefore,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.LastSeenAt,
@@ -58,7 +67,7 @@ func (r *UserRepository) FindByID(ctx context.Context, id string) (*domain.User,
 
 func (r *UserRepository) GetPublicKey(ctx context.Context, id string) (string, error) {
 	var pk string
-	err := r.pool.QueryRow(ctx, `SELECT public_key FROM users WHERE id = $1`, id).Scan(&pk)
+	err := r.db.QueryRow(ctx, `SELECT public_key FROM users WHERE id = $1`, id).Scan(&pk)
 	if err == pgx.ErrNoRows {
 		return "", domain.ErrUserNotFound
 	}
@@ -70,12 +79,31 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 		UPDATE users SET nickname = $2, avatar_url = $3, public_key = $4, updated_at = NOW()
 		WHERE id = $1
 	`
-	_, err := r.pool.Exec(ctx, query, user.ID, user.Nickname, user.AvatarURL, user.PublicKey)
+	_, err := r.db.Exec(ctx, query, user.ID, user.Nickname, user.AvatarURL, user.PublicKey)
+	return err
+}
+
+func (r *UserRepository) UpdateCredentials(ctx context.Context, id, passwordHash, publicKey string) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE users SET password_hash = $2, public_key = $3, updated_at = NOW() WHERE id = $1`,
+		id, passwordHash, publicKey,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, id, passwordHash string) error {
+	_, err := r.db.Exec(ctx, `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`, id, passwordHash)
 	return err
 }
 
 func (r *UserRepository) UpdateLastSeen(ctx context.Context, id string) error {
-	_, err := r.pool.Exec(ctx, `UPDATE users SET last_seen_at = NOW() WHERE id = $1`, id)
+	_, err := r.db.Exec(ctx, `UPDATE users SET last_seen_at = NOW() WHERE id = $1`, id)
 	return err
 }
 
@@ -83,10 +111,10 @@ func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([
 	sql := `
 		SELECT id, nickname, public_key, avatar_url, created_at, last_seen_at
 		FROM users
-		WHERE nickname ILIKE $1
+		WHERE nickname ILIKE $1 AND delete_after IS NULL
 		LIMIT $2
 	`
-	rows, err := r.pool.Query(ctx, sql, "%"+query+"%", limit)
+	rows, err := r.db.Query(ctx, sql, "%"+query+"%", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -102,3 +130,135 @@ func (r *UserRepository) Search(ctx context.Context, query string, limit int) ([
 	}
 	return users, rows.Err()
 }
+
+func (r *UserRepository) List(ctx context.Context, filter domain.UserFilter) ([]*domain.User, int, error) {
+	var conds []string
+	var args []interface{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conds = append(conds, fmt.Sprintf(`u.status = $%d`, len(args)))
+	}
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%", filter.Query)
+		conds = append(conds, fmt.Sprintf(`(u.nickname ILIKE $%d OR u.id::text = $%d)`, len(args)-1, len(args)))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM users u`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `
+		SELECT u.id, u.nickname, u.public_key, u.avatar_url, u.status, u.suspended_at, u.suspend_reason,
+		       u.delete_after, u.frozen_at, u.unfreeze_before, u.created_at, u.updated_at,
+		       GREATEST(u.last_seen_at, (SELECT MAX(s.last_used_at) FROM sessions s WHERE s.user_id = u.id))
+		FROM users u` + where +
+		fmt.Sprintf(` ORDER BY u.created_at DESC, u.id LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		u := &domain.User{}
+		if err := rows.Scan(&u.ID, &u.Nickname, &u.PublicKey, &u.AvatarURL, &u.Status, &u.SuspendedAt,
+			&u.SuspendReason, &u.DeleteAfter, &u.FrozenAt, &u.UnfreezeBefore, &u.CreatedAt, &u.UpdatedAt,
+			&u.LastSeenAt); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *UserRepository) GetStatus(ctx context.Context, id string) (domain.UserStatus, error) {
+	var status domain.UserStatus
+	err := r.db.QueryRow(ctx, `SELECT status FROM users WHERE id = $1`, id).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return "", domain.ErrUserNotFound
+	}
+	return status, err
+}
+
+func (r *UserRepository) Suspend(ctx context.Context, id, reason string) error {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users SET status = 'suspended', suspended_at = NOW(), suspend_reason = NULLIF($2, ''), updated_at = NOW()
+		WHERE id = $1
+	`, id, reason)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) Unsuspend(ctx context.Context, id string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users SET
+			status = CASE WHEN frozen_at IS NOT NULL THEN 'frozen' ELSE 'active' END,
+			suspended_at = NULL,
+			suspend_reason = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'suspended'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) Freeze(ctx context.Context, id string, unfreezeBefore time.Time) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users SET status = 'frozen', frozen_at = NOW(), unfreeze_before = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`, id, unfreezeBefore)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) Unfreeze(ctx context.Context, id string) (bool, error) {
+	result, err := r.db.Exec(ctx, `
+		UPDATE users SET status = 'active', frozen_at = NULL, unfreeze_before = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'frozen'
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+func (r *UserRepository) ScheduleDeletion(ctx context.Context, id string, deleteAfter time.Time) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE users SET deletion_requested_at = NOW(), delete_after = $2 WHERE id = $1`,
+		id, deleteAfter,
+	)
+	return err
+}
+
+func (r *UserRepository) CancelDeletion(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE users SET deletion_requested_at = NULL, delete_after = NULL WHERE id = $1`,
+		id,
+	)
+	return err
+}
+
+func (r *UserRepository) PurgeDeleted(ctx context.Context) (int64, error) {
+	result, err := r.db.Exec(ctx, `DELETE FROM users WHERE delete_after <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
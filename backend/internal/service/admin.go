@@ -0,0 +1,461 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"link/internal/domain"
+	"link/internal/pkg/password"
+	"link/internal/pkg/qrcode"
+	"link/internal/pkg/token"
+	"link/internal/pkg/totp"
+)
+
+const (
+	adminIdleTimeout      = 30 * time.Minute
+	adminMinPasswordLen   = 12
+	adminMaxUsernameLen   = 50
+	adminTOTPIssuer       = "LINK Admin"
+	adminTOTPSkew         = 1 // accept codes one step either side of now
+	adminAuditDefaultPage = 50
+)
+
+type AdminService struct {
+	adminRepo     domain.AdminRepository
+	sessionRepo   domain.AdminSessionRepository
+	auditRepo     domain.AuditLogRepository
+	sessionExpiry time.Duration
+	requireTOTP   bool
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// AdminLogin is a new admin session; Token goes in the X-Admin-Token header
+type AdminLogin struct {
+	Token     string            `json:"token"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Admin     *domain.AdminUser `json:"admin"`
+}
+
+// TOTPSetup is what an authenticator app needs to enroll an admin
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qr_svg"`
+}
+
+// AdminUpdate changes another admin's account; nil fields are left alone
+type AdminUpdate struct {
+	Role      *domain.AdminRole `json:"role"`
+	Password  *string           `json:"password"`
+	Disabled  *bool             `json:"disabled"`
+	ResetTOTP bool              `json:"reset_totp"`
+}
+
+func NewAdminService(
+	adminRepo domain.AdminRepository,
+	sessionRepo domain.AdminSessionRepository,
+	auditRepo domain.AuditLogRepository,
+	sessionExpiry time.Duration,
+	requireTOTP bool,
+) *AdminService {
+	return &AdminService{
+		adminRepo:     adminRepo,
+		sessionRepo:   sessionRepo,
+		auditRepo:     auditRepo,
+		sessionExpiry: sessionExpiry,
+		requireTOTP:   requireTOTP,
+	}
+}
+
+// Bootstrap creates the first superadmin when there are no admin accounts yet.
+// Returns false if admins already exist.
+func (s *AdminService) Bootstrap(ctx context.Context, username, pwd string) (bool, error) {
+	n, err := s.adminRepo.Count(ctx)
+	if err != nil || n > 0 {
+		return false, err
+	}
+	if _, err := s.CreateAdmin(ctx, username, pwd, domain.AdminRoleSuperadmin); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Login checks the password and, once enrolled, the TOTP code. Unknown usernames, disabled
+// accounts, wrong passwords and wrong codes all fail the same way, and every attempt is audited.
+func (s *AdminService) Login(ctx context.Context, username, pwd, code string, client domain.ClientInfo) (*AdminLogin, error) {
+	admin, err := s.adminRepo.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if admin == nil {
+		// Spend the same time as a real check so usernames cannot be probed
+		_, _ = password.Verify(pwd, s.dummyHash())
+		s.recordLoginFailure(ctx, nil, username, "unknown_user", client)
+		return nil, domain.ErrAdminLoginFailed
+	}
+
+	ok, err := password.Verify(pwd, admin.PasswordHash)
+	if err != nil || !ok {
+		s.recordLoginFailure(ctx, admin, username, "password", client)
+		return nil, domain.ErrAdminLoginFailed
+	}
+	if admin.DisabledAt != nil {
+		s.recordLoginFailure(ctx, admin, username, "disabled", client)
+		return nil, domain.ErrAdminLoginFailed
+	}
+	if admin.TOTPEnabled {
+		reason, err := s.useTOTPCode(ctx, admin, code)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			s.recordLoginFailure(ctx, admin, username, reason, client)
+			return nil, domain.ErrAdminLoginFailed
+		}
+	}
+
+	s.upgradePasswordHash(ctx, admin, pwd)
+
+	raw, err := token.NewRefreshToken()
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+	session := &domain.AdminSession{
+		AdminID:   admin.ID,
+		TokenHash: token.HashID(raw),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(s.sessionExpiry),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	if err := s.adminRepo.RecordLogin(ctx, admin.ID); err != nil {
+		slog.Warn("failed to record admin login", "admin_id", admin.ID, "error", err)
+	}
+	s.Record(ctx, &domain.AuditEntry{
+		AdminID:  &admin.ID,
+		Username: admin.Username,
+		Action:   "auth.login",
+		Target:   session.ID,
+		Status:   200,
+		IP:       client.IP,
+	})
+
+	return &AdminLogin{Token: raw, ExpiresAt: session.ExpiresAt, Admin: admin}, nil
+}
+
+// useTOTPCode checks code against the admin's secret and burns its time step.
+// Returns a failure reason for the audit log, or "" if the code was accepted.
+func (s *AdminService) useTOTPCode(ctx context.Context, admin *domain.AdminUser, code string) (string, error) {
+	if admin.TOTPSecret == nil {
+		return "totp", nil
+	}
+	step, ok := totp.Validate(*admin.TOTPSecret, strings.TrimSpace(code), time.Now(), adminTOTPSkew)
+	if !ok {
+		return "totp", nil
+	}
+	fresh, err := s.adminRepo.UseTOTPStep(ctx, admin.ID, step)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "totp_replayed", nil
+	}
+	return "", nil
+}
+
+// Authenticate resolves an admin session token. Sessions end at their expiry, after
+// adminIdleTimeout without use, or as soon as the admin is disabled.
+func (s *AdminService) Authenticate(ctx context.Context, raw string, client domain.ClientInfo) (*domain.AdminUser, *domain.AdminSession, error) {
+	if raw == "" {
+		return nil, nil, domain.ErrAdminSessionInvalid
+	}
+	session, err := s.sessionRepo.FindByTokenHash(ctx, token.HashID(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if session == nil || session.RevokedAt != nil || now.After(session.ExpiresAt) ||
+		now.Sub(session.LastUsedAt) > adminIdleTimeout {
+		return nil, nil, domain.ErrAdminSessionInvalid
+	}
+
+	admin, err := s.adminRepo.FindByID(ctx, session.AdminID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if admin == nil || admin.DisabledAt != nil {
+		return nil, nil, domain.ErrAdminSessionInvalid
+	}
+
+	if now.Sub(session.LastUsedAt) >= touchInterval || session.IP != client.IP || session.UserAgent != client.UserAgent {
+		if err := s.sessionRepo.Touch(ctx, session.ID, client); err != nil {
+			slog.Warn("failed to record admin session use", "session_id", session.ID, "error", err)
+		}
+	}
+	return admin, session, nil
+}
+
+// Authorize checks that admin may use permission. Until an admin has enrolled TOTP
+// (when required) they can only manage their own login.
+func (s *AdminService) Authorize(admin *domain.AdminUser, permission domain.AdminPermission) error {
+	if s.requireTOTP && !admin.TOTPEnabled {
+		return domain.ErrAdminTOTPRequired
+	}
+	if !admin.Role.Can(permission) {
+		return domain.ErrAdminForbidden
+	}
+	return nil
+}
+
+func (s *AdminService) Logout(ctx context.Context, sessionID string) error {
+	return s.sessionRepo.Revoke(ctx, sessionID)
+}
+
+// SetupTOTP generates a new secret for an admin who has not enabled TOTP yet.
+// It takes effect once confirmed with a code from the authenticator app.
+func (s *AdminService) SetupTOTP(ctx context.Context, admin *domain.AdminUser) (*TOTPSetup, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+	ok, err := s.adminRepo.SetTOTPSecret(ctx, admin.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrConflict("已啟用兩步驟驗證")
+	}
+
+	uri := totp.ProvisioningURI(adminTOTPIssuer, admin.Username, secret)
+	code, err := qrcode.Encode([]byte(uri), qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPSetup{Secret: secret, URI: uri, QRCode: string(code.SVG(4))}, nil
+}
+
+// ConfirmTOTP enables TOTP after the admin proves their app produces valid codes
+func (s *AdminService) ConfirmTOTP(ctx context.Context, adminID, code string) error {
+	admin, err := s.adminRepo.FindByID(ctx, adminID)
+	if err != nil {
+		return err
+	}
+	if admin == nil {
+		return domain.ErrAdminNotFound
+	}
+	if admin.TOTPEnabled {
+		return domain.ErrConflict("已啟用兩步驟驗證")
+	}
+	if admin.TOTPSecret == nil {
+		return domain.ErrValidation("請先產生兩步驟驗證金鑰")
+	}
+
+	reason, err := s.useTOTPCode(ctx, admin, code)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return domain.ErrValidation("驗證碼錯誤")
+	}
+	return s.adminRepo.EnableTOTP(ctx, admin.ID)
+}
+
+func (s *AdminService) ListAdmins(ctx context.Context) ([]*domain.AdminUser, error) {
+	admins, err := s.adminRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if admins == nil {
+		admins = []*domain.AdminUser{}
+	}
+	return admins, nil
+}
+
+func (s *AdminService) CreateAdmin(ctx context.Context, username, pwd string, role domain.AdminRole) (*domain.AdminUser, error) {
+	username = strings.TrimSpace(username)
+	if !validAdminUsername(username) {
+		return nil, domain.ErrValidation("帳號須為 3 到 50 個英數字、'.'、'_' 或 '-'")
+	}
+	if !role.Valid() {
+		return nil, domain.ErrValidation("無效的角色")
+	}
+	if err := validateAdminPassword(pwd); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.adminRepo.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, domain.ErrConflict("帳號已存在")
+	}
+
+	hash, err := password.Hash(pwd)
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+	admin := &domain.AdminUser{Username: username, PasswordHash: hash, Role: role}
+	if err := s.adminRepo.Create(ctx, admin); err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// UpdateAdmin applies a superadmin's change to an admin account. Admins cannot change their own
+// role or disable themselves, so the last superadmin cannot lock everyone out.
+func (s *AdminService) UpdateAdmin(ctx context.Context, actorID, id string, upd AdminUpdate) (*domain.AdminUser, error) {
+	admin, err := s.adminRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if admin == nil {
+		return nil, domain.ErrAdminNotFound
+	}
+	if id == actorID && (upd.Role != nil || upd.Disabled != nil) {
+		return nil, domain.ErrValidation("不能變更自己的角色或停用自己")
+	}
+	if upd.Role != nil && !upd.Role.Valid() {
+		return nil, domain.ErrValidation("無效的角色")
+	}
+
+	var hash string
+	if upd.Password != nil {
+		if err := validateAdminPassword(*upd.Password); err != nil {
+			return nil, err
+		}
+		if hash, err = password.Hash(*upd.Password); err != nil {
+			return nil, domain.ErrInternal()
+		}
+	}
+
+	if upd.Role != nil {
+		if err := s.adminRepo.UpdateRole(ctx, id, *upd.Role); err != nil {
+			return nil, err
+		}
+	}
+	if hash != "" {
+		if err := s.adminRepo.UpdatePassword(ctx, id, hash); err != nil {
+			return nil, err
+		}
+	}
+	if upd.ResetTOTP {
+		if err := s.adminRepo.ResetTOTP(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Disabled != nil {
+		if err := s.adminRepo.SetDisabled(ctx, id, *upd.Disabled); err != nil {
+			return nil, err
+		}
+	}
+
+	// Credentials changed or the account was locked: end its other sessions
+	if id != actorID && (hash != "" || upd.ResetTOTP || (upd.Disabled != nil && *upd.Disabled)) {
+		if err := s.sessionRepo.RevokeAllByAdmin(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.adminRepo.FindByID(ctx, id)
+}
+
+// Record appends to the audit log. A failed write is logged rather than failing the request,
+// since the action it describes has already happened.
+func (s *AdminService) Record(ctx context.Context, entry *domain.AuditEntry) {
+	if err := s.auditRepo.Append(ctx, entry); err != nil {
+		slog.Error("failed to write admin audit log", "action", entry.Action, "target", entry.Target, "error", err)
+	}
+}
+
+func (s *AdminService) ListAudit(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEntry, int, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = adminAuditDefaultPage
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	entries, total, err := s.auditRepo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if entries == nil {
+		entries = []*domain.AuditEntry{}
+	}
+	return entries, total, nil
+}
+
+func (s *AdminService) recordLoginFailure(ctx context.Context, admin *domain.AdminUser, username, reason string, client domain.ClientInfo) {
+	entry := &domain.AuditEntry{
+		Username: truncate(username, adminMaxUsernameLen),
+		Action:   "auth.login_failed",
+		Status:   401,
+		IP:       client.IP,
+		Detail:   map[string]interface{}{"reason": reason},
+	}
+	if admin != nil {
+		entry.AdminID = &admin.ID
+	}
+	s.Record(ctx, entry)
+}
+
+func (s *AdminService) upgradePasswordHash(ctx context.Context, admin *domain.AdminUser, pwd string) {
+	if !password.NeedsRehash(admin.PasswordHash) {
+		return
+	}
+	hash, err := password.Hash(pwd)
+	if err == nil {
+		err = s.adminRepo.UpdatePassword(ctx, admin.ID, hash)
+	}
+	if err != nil {
+		slog.Warn("failed to upgrade admin password hash", "admin_id", admin.ID, "error", err)
+	}
+}
+
+// dummyHash is verified against for unknown usernames. It is created on first use so it
+// carries the Argon2 parameters configured at startup.
+func (s *AdminService) dummyHash() string {
+	s.dummyOnce.Do(func() {
+		s.dummy, _ = password.Hash("link-admin-dummy-password")
+	})
+	return s.dummy
+}
+
+func validateAdminPassword(pwd string) error {
+	if utf8.RuneCountInString(pwd) < adminMinPasswordLen {
+		return domain.ErrValidation("管理員密碼至少需要 12 個字元")
+	}
+	return nil
+}
+
+func validAdminUsername(username string) bool {
+	if len(username) < 3 || len(username) > adminMaxUsernameLen {
+		return false
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -2,21 +2,35 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"log/slog"
+	"time"
 
 	"link/internal/domain"
 	"link/internal/pkg/cardtoken"
 	"link/internal/pkg/password"
-	"link/internal/pkg/token"
+	"link/internal/pkg/webauthn"
 )
 
+// Notifier pushes a realtime event to every connected device of a user
+type Notifier interface {
+	SendTyped(userID string, msgType string, payload interface{}) bool
+}
+
 type AuthService struct {
 	userRepo      domain.UserRepository
 	cardRepo      domain.CardRepository
-	sessionRepo   domain.SessionRepository
 	friendRepo    domain.FriendshipRepository
-	tokenMgr      *token.Manager
+	uow           domain.UnitOfWork
+	sessionSvc    *SessionService
+	cardSvc       *CardService
+	passkeySvc    *PasskeyService
+	notifier      Notifier
+	throttle      *loginThrottle
 	cardTokenGen  *cardtoken.Generator
-	serviceUserID string // 小安服務帳號 ID
+	serviceUserID string        // 小安服務帳號 ID
+	deletionGrace time.Duration // 申請刪除帳號後保留的期間
+	freezeWindow  time.Duration // 凍結後可用主卡解除的期間
 }
 
 type RegisterInput struct {
@@ -25,30 +39,58 @@ type RegisterInput struct {
 	Password     string
 	Nickname     string
 	PublicKey    string
+	Client       domain.ClientInfo
 }
 
 type AuthResponse struct {
-	User  *domain.User `json:"user"`
-	Token string       `json:"token"`
+	User         *domain.User `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresAt    time.Time    `json:"expires_at"`
+	// Failed password attempts on the user's cards since their last login
+	SecurityNotice *domain.LoginFailureNotice `json:"security_notice,omitempty"`
+	// Set when this login cancelled a pending account deletion
+	DeletionCancelled bool `json:"deletion_cancelled,omitempty"`
+	// The session this login created, kept server side
+	SessionID string `json:"-"`
+}
+
+// RefreshResponse carries a rotated token pair
+type RefreshResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 func NewAuthService(
 	userRepo domain.UserRepository,
 	cardRepo domain.CardRepository,
-	sessionRepo domain.SessionRepository,
 	friendRepo domain.FriendshipRepository,
-	tokenMgr *token.Manager,
+	attemptRepo domain.LoginAttemptRepository,
+	uow domain.UnitOfWork,
+	sessionSvc *SessionService,
+	cardSvc *CardService,
+	passkeySvc *PasskeyService,
+	notifier Notifier,
 	cardTokenGen *cardtoken.Generator,
 	serviceUserID string,
+	deletionGrace time.Duration,
+	freezeWindow time.Duration,
 ) *AuthService {
 	return &AuthService{
 		userRepo:      userRepo,
 		cardRepo:      cardRepo,
-		sessionRepo:   sessionRepo,
 		friendRepo:    friendRepo,
-		tokenMgr:      tokenMgr,
+		uow:           uow,
+		sessionSvc:    sessionSvc,
+		cardSvc:       cardSvc,
+		passkeySvc:    passkeySvc,
+		notifier:      notifier,
+		throttle:      &loginThrottle{repo: attemptRepo, uow: uow},
 		cardTokenGen:  cardTokenGen,
 		serviceUserID: serviceUserID,
+		deletionGrace: deletionGrace,
+		freezeWindow:  freezeWindow,
 	}
 }
 
@@ -85,41 +127,80 @@ func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*AuthR
 		return nil, domain.ErrConflict("主卡已被註冊")
 	}
 
+	pair, err := findPair(ctx, s.cardRepo, input.PrimaryToken)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case pair == nil:
+		return nil, domain.ErrValidation("此卡片尚未發行或已過期")
+	case pair.Status == domain.CardPairRegistered:
+		return nil, domain.ErrConflict("此卡片組已被註冊")
+	case pair.Status == domain.CardPairLost || pair.Status == domain.CardPairRevoked:
+		return nil, domain.ErrCardRevoked
+	case !pair.Registrable(time.Now()):
+		return nil, domain.ErrValidation("此卡片尚未發行或已過期")
+	}
+	if hasBackup && !pair.Contains(input.BackupToken) {
+		return nil, domain.ErrValidation("主卡和副卡不是配對的卡片")
+	}
+
 	hash, err := password.Hash(input.Password)
 	if err != nil {
 		return nil, domain.ErrInternal()
 	}
 
+	cards := []*domain.Card{{
+		CardToken:  input.PrimaryToken,
+		CardType:   domain.CardTypePrimary,
+		Status:     domain.CardStatusActive,
+		KeyVersion: s.tagKeyVersion(ctx, input.PrimaryToken),
+	}}
+	// Only create backup card if token provided
+	if hasBackup {
+		cards = append(cards, &domain.Card{
+			CardToken:  input.BackupToken,
+			CardType:   domain.CardTypeBackup,
+			Status:     domain.CardStatusActive,
+			KeyVersion: s.tagKeyVersion(ctx, input.BackupToken),
+		})
+	}
+
 	user := &domain.User{
 		PasswordHash: hash,
 		Nickname:     input.Nickname,
 		PublicKey:    input.PublicKey,
 	}
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		return nil, err
-	}
-
-	primaryCard := &domain.Card{
-		UserID:    user.ID,
-		CardToken: input.PrimaryToken,
-		CardType:  domain.CardTypePrimary,
-		Status:    domain.CardStatusActive,
-	}
-	if err := s.cardRepo.Create(ctx, primaryCard); err != nil {
-		return nil, err
-	}
+	// The claim, the account and its cards commit together, or the pair stays registrable
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		// A concurrent registration of the same pair waits on the claimed row and then finds it taken
+		claimed, err := repos.Cards.ClaimPair(ctx, pair.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return domain.ErrConflict("此卡片組已被註冊")
+		}
 
-	// Only create backup card if token provided
-	if hasBackup {
-		backupCard := &domain.Card{
-			UserID:    user.ID,
-			CardToken: input.BackupToken,
-			CardType:  domain.CardTypeBackup,
-			Status:    domain.CardStatusActive,
+		if err := repos.Users.Create(ctx, user); err != nil {
+			return err
+		}
+		if err := repos.Cards.SetPairRegisteredBy(ctx, pair.ID, user.ID); err != nil {
+			return err
 		}
-		if err := s.cardRepo.Create(ctx, backupCard); err != nil {
-			return nil, err
+		for _, card := range cards {
+			card.UserID = user.ID
+			if err := repos.Cards.Create(ctx, card); err != nil {
+				return err
+			}
+			if err := repos.Cards.RecordEvent(ctx, user.ID, card.ID, domain.CardEventRegistered); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Auto-friend with service user (小安) if configured
@@ -129,19 +210,23 @@ func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*AuthR
 			AddresseeID: user.ID,
 			Status:      domain.FriendshipAccepted,
 		}
-		// Ignore error - auto-friend is best-effort
+		// Ignore error - auto-friend is best-effort, so it runs after the commit
 		_ = s.friendRepo.Create(ctx, friendship)
 	}
 
-	tokenStr, err := s.tokenMgr.Generate(user.ID)
-	if err != nil {
-		return nil, domain.ErrInternal()
-	}
+	return s.newAuthResponse(ctx, user, input.Client)
+}
 
-	return &AuthResponse{User: user, Token: tokenStr}, nil
+// tagKeyVersion returns the SUN key version of the chip bound to a card token, if any
+func (s *AuthService) tagKeyVersion(ctx context.Context, token string) *int {
+	tag, err := s.cardRepo.FindTagByToken(ctx, token)
+	if err != nil || tag == nil {
+		return nil
+	}
+	return &tag.KeyVersion
 }
 
-func (s *AuthService) Login(ctx context.Context, cardToken, pwd string) (*AuthResponse, error) {
+func (s *AuthService) Login(ctx context.Context, cardToken, tapNonce, pwd string, client domain.ClientInfo) (*AuthResponse, error) {
 	card, err := s.cardRepo.FindByToken(ctx, cardToken)
 	if err != nil || card == nil {
 		return nil, domain.ErrUserNotFound
@@ -154,22 +239,33 @@ func (s *AuthService) Login(ctx context.Context, cardToken, pwd string) (*AuthRe
 	if card.CardType == domain.CardTypeBackup {
 		return nil, domain.ErrValidation("請使用主卡登入，或使用附卡撤銷流程")
 	}
+	// Checked before the password so a copied card URL cannot even spend the card's attempts
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, false); err != nil {
+		return nil, err
+	}
 
-	user, err := s.userRepo.FindByID(ctx, card.UserID)
+	user, err := s.verifyCardPassword(ctx, card, pwd)
 	if err != nil {
-		return nil, domain.ErrUserNotFound
+		return nil, err
 	}
-
-	ok, err := password.Verify(pwd, user.PasswordHash)
-	if err != nil || !ok {
-		return nil, domain.ErrInvalidPassword
+	if user.Status == domain.UserStatusFrozen {
+		return nil, domain.ErrAccountFrozen
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, true); err != nil {
+		return nil, err
 	}
+	notice := s.throttle.notice(ctx, user.ID)
 
-	tokenStr, _ := s.tokenMgr.Generate(user.ID)
-	return &AuthResponse{User: user, Token: tokenStr}, nil
+	res, err := s.newAuthResponse(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	res.SecurityNotice = notice
+	res.DeletionCancelled = s.cancelPendingDeletion(ctx, user)
+	return res, nil
 }
 
-func (s *AuthService) LoginWithBackupCard(ctx context.Context, cardToken, pwd string) (*AuthResponse, error) {
+func (s *AuthService) LoginWithBackupCard(ctx context.Context, cardToken, tapNonce, pwd string, client domain.ClientInfo) (*AuthResponse, error) {
 	card, err := s.cardRepo.FindByToken(ctx, cardToken)
 	if err != nil || card == nil {
 		return nil, domain.ErrUserNotFound
@@ -182,22 +278,326 @@ func (s *AuthService) LoginWithBackupCard(ctx context.Context, cardToken, pwd st
 	if card.CardType != domain.CardTypeBackup {
 		return nil, domain.ErrValidation("此為主卡，請使用一般登入")
 	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, false); err != nil {
+		return nil, err
+	}
 
-	user, err := s.userRepo.FindByID(ctx, card.UserID)
+	user, err := s.verifyCardPassword(ctx, card, pwd)
 	if err != nil {
+		return nil, err
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, true); err != nil {
+		return nil, err
+	}
+	notice := s.throttle.notice(ctx, user.ID)
+
+	if err := s.cardSvc.RevokeWithBackupCard(ctx, card.ID, user.ID); err != nil {
+		return nil, err
+	}
+	// Whoever holds the old primary card may still be connected; the new session comes after
+	if err := s.sessionSvc.RevokeUser(ctx, user.ID, "", domain.RevokeReasonCardsRevoked); err != nil {
+		return nil, err
+	}
+
+	res, err := s.newAuthResponse(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	res.SecurityNotice = notice
+	res.DeletionCancelled = s.cancelPendingDeletion(ctx, user)
+	return res, nil
+}
+
+// LoginWithPasskey logs in with a passkey and the password in place of the primary card.
+// Password failures count against the primary card's backoff, so switching factors gains no guesses.
+func (s *AuthService) LoginWithPasskey(ctx context.Context, challengeID string, assertion *webauthn.Assertion, pwd string, client domain.ClientInfo) (*AuthResponse, error) {
+	passkey, err := s.passkeySvc.verifyAssertion(ctx, challengeID, assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	primary, err := s.cardRepo.FindActiveByUserAndType(ctx, passkey.UserID, domain.CardTypePrimary)
+	if err != nil {
+		return nil, err
+	}
+	if primary == nil {
+		return nil, domain.ErrUnauthorized("此帳號沒有有效的主卡，請使用副卡登入")
+	}
+
+	user, err := s.verifyCardPassword(ctx, primary, pwd)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == domain.UserStatusFrozen {
+		return nil, domain.ErrAccountFrozen
+	}
+	notice := s.throttle.notice(ctx, user.ID)
+	s.passkeySvc.recordUse(ctx, passkey)
+
+	res, err := s.newAuthResponse(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	res.SecurityNotice = notice
+	res.DeletionCancelled = s.cancelPendingDeletion(ctx, user)
+	return res, nil
+}
+
+// verifyCardPassword checks the password of the card's owner, subject to the card's login backoff
+func (s *AuthService) verifyCardPassword(ctx context.Context, card *domain.Card, pwd string) (*domain.User, error) {
+	if err := s.throttle.reserve(ctx, card.ID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, card.UserID)
+	if err != nil || user == nil {
+		// No password was checked, so the reserved attempt is not a failure
+		s.throttle.release(ctx, card.ID)
 		return nil, domain.ErrUserNotFound
 	}
 
 	ok, err := password.Verify(pwd, user.PasswordHash)
 	if err != nil || !ok {
+		s.throttle.fail(ctx, card.ID)
 		return nil, domain.ErrInvalidPassword
 	}
+	s.throttle.release(ctx, card.ID)
+	// Checked after the password so the account state is only revealed to its owner
+	if user.Status == domain.UserStatusSuspended {
+		return nil, domain.ErrAccountSuspended
+	}
+	s.upgradePasswordHash(ctx, user, pwd)
+	return user, nil
+}
 
-	cardSvc := &CardService{cardRepo: s.cardRepo, sessionRepo: s.sessionRepo}
-	if err := cardSvc.RevokeWithBackupCard(ctx, card.ID, user.ID); err != nil {
+type ChangePasswordInput struct {
+	UserID       string
+	SessionID    string // the session making the change stays signed in
+	OldPassword  string
+	NewPassword  string
+	NewPublicKey string // E2EE public key derived from the new password
+}
+
+// ChangePassword replaces the password and the password-derived public key together, since
+// one without the other leaves the account unable to decrypt. Every other session is signed out.
+func (s *AuthService) ChangePassword(ctx context.Context, input ChangePasswordInput) error {
+	if input.NewPassword == "" || input.NewPublicKey == "" {
+		return domain.ErrValidation("缺少新密碼或公鑰")
+	}
+	if !validPublicKey(input.NewPublicKey) {
+		return domain.ErrValidation("公鑰格式錯誤")
+	}
+
+	// The old password is guessed against the same backoff as a login with the user's card
+	card, err := s.cardRepo.FindActiveByUserAndType(ctx, input.UserID, domain.CardTypePrimary)
+	if err != nil {
+		return err
+	}
+	if card == nil {
+		card, err = s.cardRepo.FindActiveByUserAndType(ctx, input.UserID, domain.CardTypeBackup)
+		if err != nil {
+			return err
+		}
+	}
+	if card == nil {
+		return domain.ErrUnauthorized("沒有可用的卡片")
+	}
+
+	user, err := s.verifyCardPassword(ctx, card, input.OldPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := password.Hash(input.NewPassword)
+	if err != nil {
+		return domain.ErrInternal()
+	}
+
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		if err := repos.Users.UpdateCredentials(ctx, user.ID, hash, input.NewPublicKey); err != nil {
+			return err
+		}
+		return repos.Sessions.RevokeOthers(ctx, user.ID, input.SessionID)
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.sessionSvc.RevokeUser(ctx, user.ID, input.SessionID, domain.RevokeReasonPasswordChanged); err != nil {
+		return err
+	}
+	s.notifyKeyChange(ctx, user.ID, input.NewPublicKey)
+	return nil
+}
+
+// notifyKeyChange tells online friends to drop the user's cached public key, or their next
+// messages cannot be decrypted. Offline friends fetch the key again when they reconnect.
+func (s *AuthService) notifyKeyChange(ctx context.Context, userID, publicKey string) {
+	friends, err := s.friendRepo.FindFriends(ctx, userID)
+	if err != nil {
+		slog.Warn("failed to notify friends of key change", "user_id", userID, "error", err)
+		return
+	}
+	for _, f := range friends {
+		s.notifier.SendTyped(f.Friend.ID, "key_changed", map[string]string{
+			"user_id":    userID,
+			"public_key": publicKey,
+		})
+	}
+}
+
+// validPublicKey reports whether key is a base64 NaCl box public key, as the client derives from the password
+func validPublicKey(key string) bool {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(raw) == 32
+}
+
+// BindBackupCard attaches a new backup card to the account, authorized by the current primary card and password
+func (s *AuthService) BindBackupCard(ctx context.Context, userID, primaryToken, tapNonce, pwd, backupToken string) (*domain.Card, error) {
+	primary, err := s.cardRepo.FindByToken(ctx, primaryToken)
+	if err != nil {
+		return nil, err
+	}
+	if primary == nil || primary.UserID != userID ||
+		primary.CardType != domain.CardTypePrimary || primary.Status != domain.CardStatusActive {
+		return nil, domain.ErrUnauthorized("請感應目前的主卡")
+	}
+	if err := s.cardSvc.requireTap(ctx, primaryToken, tapNonce, false); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.verifyCardPassword(ctx, primary, pwd); err != nil {
+		return nil, err
+	}
+	if err := s.cardSvc.requireTap(ctx, primaryToken, tapNonce, true); err != nil {
 		return nil, err
 	}
 
-	tokenStr, _ := s.tokenMgr.Generate(user.ID)
-	return &AuthResponse{User: user, Token: tokenStr}, nil
+	return s.cardSvc.AttachBackup(ctx, userID, backupToken)
+}
+
+// RegisterPasskey enrolls a passkey, authorized by the current primary card and password
+// like binding a backup card, since the passkey can replace that card at login
+func (s *AuthService) RegisterPasskey(ctx context.Context, userID, primaryToken, tapNonce, pwd string, input PasskeyRegistration) (*domain.Passkey, error) {
+	primary, err := s.cardRepo.FindByToken(ctx, primaryToken)
+	if err != nil {
+		return nil, err
+	}
+	if primary == nil || primary.UserID != userID ||
+		primary.CardType != domain.CardTypePrimary || primary.Status != domain.CardStatusActive {
+		return nil, domain.ErrUnauthorized("請感應目前的主卡")
+	}
+	if err := s.cardSvc.requireTap(ctx, primaryToken, tapNonce, false); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.verifyCardPassword(ctx, primary, pwd); err != nil {
+		return nil, err
+	}
+	if err := s.cardSvc.requireTap(ctx, primaryToken, tapNonce, true); err != nil {
+		return nil, err
+	}
+	return s.passkeySvc.register(ctx, userID, input)
+}
+
+// RequestDeletion schedules the account for deletion after the grace period, authorized by one of
+// the user's active cards and the password, and signs the account out everywhere.
+// Returns when the account will be deleted.
+func (s *AuthService) RequestDeletion(ctx context.Context, userID, cardToken, tapNonce, pwd string) (time.Time, error) {
+	card, err := s.cardRepo.FindByToken(ctx, cardToken)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if card == nil || card.UserID != userID || card.Status != domain.CardStatusActive {
+		return time.Time{}, domain.ErrUnauthorized("請感應您的卡片")
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, false); err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err := s.verifyCardPassword(ctx, card, pwd); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, true); err != nil {
+		return time.Time{}, err
+	}
+
+	deleteAfter := time.Now().Add(s.deletionGrace)
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		if err := repos.Users.ScheduleDeletion(ctx, userID, deleteAfter); err != nil {
+			return err
+		}
+		return repos.Sessions.RevokeAllByUser(ctx, userID)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.sessionSvc.RevokeUser(ctx, userID, "", domain.RevokeReasonAccountDeleted); err != nil {
+		return time.Time{}, err
+	}
+	return deleteAfter, nil
+}
+
+// cancelPendingDeletion restores an account scheduled for deletion when its owner logs in again
+func (s *AuthService) cancelPendingDeletion(ctx context.Context, user *domain.User) bool {
+	if user.DeleteAfter == nil {
+		return false
+	}
+	if err := s.userRepo.CancelDeletion(ctx, user.ID); err != nil {
+		slog.Warn("failed to cancel account deletion", "user_id", user.ID, "error", err)
+		return false
+	}
+	user.DeleteAfter = nil
+	return true
+}
+
+// upgradePasswordHash re-hashes a just-verified password when the stored hash uses outdated
+// Argon2 parameters. Failure only delays the upgrade to the next login.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *domain.User, pwd string) {
+	if !password.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := password.Hash(pwd)
+	if err == nil {
+		err = s.userRepo.UpdatePasswordHash(ctx, user.ID, hash)
+	}
+	if err != nil {
+		slog.Warn("failed to upgrade password hash", "user_id", user.ID, "error", err)
+		return
+	}
+	user.PasswordHash = hash
+}
+
+func (s *AuthService) newAuthResponse(ctx context.Context, user *domain.User, client domain.ClientInfo) (*AuthResponse, error) {
+	pair, err := s.sessionSvc.Create(ctx, user.ID, client)
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+	return &AuthResponse{
+		User:         user,
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresAt:    pair.ExpiresAt,
+		SessionID:    pair.SessionID,
+	}, nil
+}
+
+// Refresh rotates a refresh token into a new token pair
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (*RefreshResponse, error) {
+	if refreshToken == "" {
+		return nil, domain.ErrValidation("缺少 refresh token")
+	}
+	pair, err := s.sessionSvc.Refresh(ctx, refreshToken, client)
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresAt:    pair.ExpiresAt,
+	}, nil
+}
+
+// Logout revokes the session the request was authenticated with
+func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
+	return s.sessionSvc.Revoke(ctx, sessionID)
 }
@@ -2,22 +2,51 @@ package service
 
 import (
 	"context"
+	"encoding/hex"
+	"strings"
+	"time"
 
 	"link/internal/domain"
 	"link/internal/pkg/cardtoken"
+	"link/internal/pkg/sun"
+	"link/internal/pkg/token"
 )
 
 type CardService struct {
 	cardRepo    domain.CardRepository
-	sessionRepo domain.SessionRepository
+	sessionSvc  *SessionService
+	uow         domain.UnitOfWork
 	tokenGen    *cardtoken.Generator
+	sunVerifier *sun.Verifier // nil when SUN keys are not configured
+	batchSecret string        // verifies batch files written by cmd/cardgen
 }
 
-func NewCardService(cardRepo domain.CardRepository, sessionRepo domain.SessionRepository, tokenGen *cardtoken.Generator) *CardService {
-	return &CardService{cardRepo: cardRepo, sessionRepo: sessionRepo, tokenGen: tokenGen}
+func NewCardService(
+	cardRepo domain.CardRepository,
+	sessionSvc *SessionService,
+	uow domain.UnitOfWork,
+	tokenGen *cardtoken.Generator,
+	sunVerifier *sun.Verifier,
+	batchSecret string,
+) *CardService {
+	return &CardService{
+		cardRepo:    cardRepo,
+		sessionSvc:  sessionSvc,
+		uow:         uow,
+		tokenGen:    tokenGen,
+		sunVerifier: sunVerifier,
+		batchSecret: batchSecret,
+	}
 }
 
-func (s *CardService) CheckCard(ctx context.Context, token string) (*domain.CardCheckResult, error) {
+func (s *CardService) CheckCard(ctx context.Context, token, tapNonce string) (*domain.CardCheckResult, error) {
+	// A card with a chip says nothing about itself without a fresh tap
+	if err := s.requireTap(ctx, token, tapNonce, false); err == domain.ErrTapRequired {
+		return &domain.CardCheckResult{Status: "tap_required"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
 	// First check if already registered
 	card, err := s.cardRepo.FindByToken(ctx, token)
 	if err == nil && card != nil {
@@ -51,11 +80,152 @@ func (s *CardService) CheckCard(ctx context.Context, token string) (*domain.Card
 		return &domain.CardCheckResult{Status: "pair_already_registered"}, nil
 	}
 
+	// A valid signature is not enough, the pair must have been issued through the admin registry
+	pair, err := findPair(ctx, s.cardRepo, token)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case pair == nil:
+		return &domain.CardCheckResult{Status: "not_issued"}, nil
+	case pair.Status == domain.CardPairRegistered:
+		return &domain.CardCheckResult{Status: "pair_already_registered"}, nil
+	case pair.Status == domain.CardPairLost || pair.Status == domain.CardPairRevoked:
+		return &domain.CardCheckResult{Status: "revoked"}, nil
+	case !pair.Registrable(time.Now()):
+		return &domain.CardCheckResult{Status: "not_issued"}, nil
+	}
+
 	// For neutral format tokens, just return can_register
 	// The frontend will handle the primary/backup assignment based on scan order
 	return &domain.CardCheckResult{Status: "can_register", PairedToken: &pairedToken}, nil
 }
 
+// findPair returns the inventory pair a card token belongs to.
+// Neutral tokens can be registered in either order, so both positions are checked.
+func findPair(ctx context.Context, repo domain.CardRepository, token string) (*domain.CardPair, error) {
+	pair, err := repo.FindPairByPrimaryToken(ctx, token)
+	if err != nil || pair != nil {
+		return pair, err
+	}
+	return repo.FindPairByBackupToken(ctx, token)
+}
+
+// tapNonceTTL is how long the nonce of a verified tap can be used to log in
+const tapNonceTTL = 5 * time.Minute
+
+// VerifyTap verifies an NTAG 424 DNA SUN message and returns the card token bound to the chip,
+// with a nonce that stands in for the tap when logging in.
+// The read counter must be strictly greater than the last accepted one, so a copied URL works at most once.
+func (s *CardService) VerifyTap(ctx context.Context, piccData, cmac string) (cardToken, tapNonce string, err error) {
+	if s.sunVerifier == nil {
+		return "", "", domain.ErrValidation("未啟用 SUN 驗證")
+	}
+
+	tap, err := s.sunVerifier.Decrypt(piccData)
+	if err != nil {
+		return "", "", domain.ErrInvalidTap
+	}
+
+	tag, err := s.cardRepo.FindTagByUID(ctx, tap.UIDHex())
+	if err != nil {
+		return "", "", err
+	}
+	if tag == nil {
+		return "", "", domain.ErrTagNotFound
+	}
+
+	// Each chip carries its own diversified key, so the MAC can only be checked once the UID is known
+	if err := s.sunVerifier.CheckMAC(tap, cmac, tag.KeyVersion); err != nil {
+		return "", "", domain.ErrInvalidTap
+	}
+
+	ok, err := s.cardRepo.AdvanceTagCounter(ctx, tag.UID, tap.Counter)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", domain.ErrTapReplayed
+	}
+
+	tapNonce, err = token.NewRefreshToken()
+	if err != nil {
+		return "", "", domain.ErrInternal()
+	}
+	if err := s.cardRepo.CreateTapNonce(ctx, token.HashID(tapNonce), tag.CardToken, time.Now().Add(tapNonceTTL)); err != nil {
+		return "", "", err
+	}
+	return tag.CardToken, tapNonce, nil
+}
+
+// requireTap checks that a card with a chip comes with the nonce of a recent tap, since its printed
+// token never changes. Cards without a chip only have the token. With consume the nonce is used up.
+func (s *CardService) requireTap(ctx context.Context, cardToken, tapNonce string, consume bool) error {
+	tag, err := s.cardRepo.FindTagByToken(ctx, cardToken)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		return nil
+	}
+	if tapNonce == "" {
+		return domain.ErrTapRequired
+	}
+
+	var ok bool
+	if consume {
+		ok, err = s.cardRepo.UseTapNonce(ctx, token.HashID(tapNonce), cardToken)
+	} else {
+		ok, err = s.cardRepo.TapNonceValid(ctx, token.HashID(tapNonce), cardToken)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrTapRequired
+	}
+	return nil
+}
+
+// BindTag records which NTAG 424 DNA chip carries a card token. keyVersion 0 means the newest SUN key.
+func (s *CardService) BindTag(ctx context.Context, uid, token string, keyVersion int) (*domain.CardTag, error) {
+	if s.sunVerifier == nil {
+		return nil, domain.ErrValidation("未啟用 SUN 驗證")
+	}
+
+	uidBytes, err := hex.DecodeString(uid)
+	if err != nil || len(uidBytes) != sun.UIDLength {
+		return nil, domain.ErrValidation("無效的 UID")
+	}
+	if _, _, err := s.tokenGen.ParseToken(token); err != nil {
+		return nil, domain.ErrValidation("無效的卡片")
+	}
+
+	if keyVersion == 0 {
+		keyVersion = s.sunVerifier.KeyVersion()
+	}
+	if _, err := s.sunVerifier.CardKey(uidBytes, keyVersion); err != nil {
+		return nil, domain.ErrValidation("未知的金鑰版本")
+	}
+
+	if existing, _ := s.cardRepo.FindTagByUID(ctx, strings.ToUpper(uid)); existing != nil {
+		return nil, domain.ErrConflict("此晶片已綁定")
+	}
+	if existing, _ := s.cardRepo.FindTagByToken(ctx, token); existing != nil {
+		return nil, domain.ErrConflict("此卡片已綁定晶片")
+	}
+
+	tag := &domain.CardTag{
+		UID:        strings.ToUpper(uid),
+		CardToken:  token,
+		KeyVersion: keyVersion,
+	}
+	if err := s.cardRepo.CreateTag(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
 // ValidateTokenPair checks if the primary and backup tokens are a valid pair
 func (s *CardService) ValidateTokenPair(primaryToken, backupToken string) error {
 	// Check if they form a valid pair
@@ -84,21 +254,187 @@ func (s *CardService) IsPrimaryToken(token string) bool {
 	return s.tokenGen.IsPrimary(token)
 }
 
+// RevokeWithBackupCard revokes the primary card and every passkey, promotes the backup card
+// to primary, lifts any freeze and signs the account out everywhere
 func (s *CardService) RevokeWithBackupCard(ctx context.Context, backupCardID, userID string) error {
-	primaryCard, err := s.cardRepo.FindActiveByUserAndType(ctx, userID, domain.CardTypePrimary)
-	if err == nil && primaryCard != nil {
-		if err := s.cardRepo.Revoke(ctx, primaryCard.ID); err != nil {
+	// All or nothing: a half-done switch could leave the old primary card usable, or no primary card at all
+	return s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		primaryCard, err := repos.Cards.FindActiveByUserAndType(ctx, userID, domain.CardTypePrimary)
+		if err != nil {
+			return err
+		}
+		if primaryCard != nil {
+			if err := repos.Cards.Revoke(ctx, primaryCard.ID); err != nil {
+				return err
+			}
+			if err := repos.Cards.RecordEvent(ctx, userID, primaryCard.ID, domain.CardEventRevoked); err != nil {
+				return err
+			}
+		}
+
+		// Passkeys stand in for the primary card, so they go with it
+		if err := revokeUserAccess(ctx, repos, userID); err != nil {
 			return err
 		}
-	}
 
-	if err := s.cardRepo.PromoteBackupToPrimary(ctx, backupCardID); err != nil {
+		if err := repos.Cards.PromoteBackupToPrimary(ctx, backupCardID); err != nil {
+			return err
+		}
+		if err := repos.Cards.RecordEvent(ctx, userID, backupCardID, domain.CardEventPromoted); err != nil {
+			return err
+		}
+
+		// Revoking is the escalation of a freeze, so it also lifts one
+		_, err = repos.Users.Unfreeze(ctx, userID)
 		return err
+	})
+}
+
+// AttachBackup binds an unregistered card as the user's new backup card.
+// The card may come from a freshly issued pair or be a single replacement card.
+func (s *CardService) AttachBackup(ctx context.Context, userID, token string) (*domain.Card, error) {
+	if _, _, err := s.tokenGen.ParseToken(token); err != nil {
+		return nil, domain.ErrValidation("無效的卡片")
+	}
+	// Legacy tokens carry their role; neutral ones take it from how they are bound
+	if !s.tokenGen.IsNeutralFormat(token) && s.tokenGen.IsPrimary(token) {
+		return nil, domain.ErrValidation("請使用副卡")
+	}
+
+	if existing, err := s.cardRepo.FindByToken(ctx, token); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, domain.ErrConflict("此卡片已被註冊")
+	}
+
+	// Like registration, the card must come from an issued pair; the other half of a pair the
+	// user already registered can still be bound, but not one registered by someone else
+	pair, err := findPair(ctx, s.cardRepo, token)
+	if err != nil {
+		return nil, err
+	}
+	ownPair := false
+	switch {
+	case pair == nil:
+		return nil, domain.ErrValidation("此卡片尚未發行或已過期")
+	case pair.Status == domain.CardPairLost || pair.Status == domain.CardPairRevoked:
+		return nil, domain.ErrCardRevoked
+	case pair.Status == domain.CardPairRegistered:
+		if pair.RegisteredBy == nil || *pair.RegisteredBy != userID {
+			return nil, domain.ErrConflict("此卡片的配對卡已被其他帳號註冊")
+		}
+		ownPair = true
+	case !pair.Registrable(time.Now()):
+		return nil, domain.ErrValidation("此卡片尚未發行或已過期")
+	}
+
+	if backup, err := s.cardRepo.FindActiveByUserAndType(ctx, userID, domain.CardTypeBackup); err != nil {
+		return nil, err
+	} else if backup != nil {
+		return nil, domain.ErrConflict("已有有效的副卡")
 	}
 
-	return s.sessionRepo.RevokeAllByUser(ctx, userID)
+	card := &domain.Card{
+		UserID:    userID,
+		CardToken: token,
+		CardType:  domain.CardTypeBackup,
+		Status:    domain.CardStatusActive,
+	}
+	if tag, err := s.cardRepo.FindTagByToken(ctx, token); err == nil && tag != nil {
+		card.KeyVersion = &tag.KeyVersion
+	}
+	// The claim and the card commit together, or the pair stays registrable
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		if !ownPair {
+			claimed, err := repos.Cards.ClaimPair(ctx, pair.ID)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return domain.ErrConflict("此卡片已被註冊")
+			}
+			if err := repos.Cards.SetPairRegisteredBy(ctx, pair.ID, userID); err != nil {
+				return err
+			}
+		}
+		if err := repos.Cards.Create(ctx, card); err != nil {
+			return err
+		}
+		return repos.Cards.RecordEvent(ctx, userID, card.ID, domain.CardEventBackupBound)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// RevokeUserCard revokes one of a user's active cards on behalf of support staff. Whoever holds
+// the card may be logged in with it, or have enrolled a passkey with it, so every session and
+// passkey of the user goes too.
+func (s *CardService) RevokeUserCard(ctx context.Context, userID, cardID string) (*domain.Card, error) {
+	cards, err := s.cardRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var card *domain.Card
+	for _, c := range cards {
+		if c.ID == cardID {
+			card = c
+			break
+		}
+	}
+	if card == nil {
+		return nil, domain.ErrNotFound("卡片不存在")
+	}
+	if card.Status != domain.CardStatusActive {
+		return nil, domain.ErrConflict("卡片已失效")
+	}
+
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		if err := repos.Cards.Revoke(ctx, card.ID); err != nil {
+			return err
+		}
+		if err := repos.Cards.RecordEvent(ctx, userID, card.ID, domain.CardEventRevoked); err != nil {
+			return err
+		}
+		return revokeUserAccess(ctx, repos, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionSvc.RevokeUser(ctx, userID, "", domain.RevokeReasonCardsRevoked); err != nil {
+		return nil, err
+	}
+	card.Status = domain.CardStatusRevoked
+	return card, nil
+}
+
+// revokeUserAccess revokes every passkey and session of the user inside a unit of work, for when
+// one of their cards is revoked out from under them
+func revokeUserAccess(ctx context.Context, repos *domain.Repositories, userID string) error {
+	passkeyIDs, err := repos.Passkeys.RevokeAllByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range passkeyIDs {
+		if err := repos.Passkeys.RecordEvent(ctx, userID, id, domain.CardEventPasskeyRevoked); err != nil {
+			return err
+		}
+	}
+	return repos.Sessions.RevokeAllByUser(ctx, userID)
 }
 
 func (s *CardService) GetUserCards(ctx context.Context, userID string) ([]*domain.Card, error) {
 	return s.cardRepo.FindByUserID(ctx, userID)
 }
+
+func (s *CardService) GetCardHistory(ctx context.Context, userID string) ([]*domain.CardEvent, error) {
+	events, err := s.cardRepo.FindEventsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []*domain.CardEvent{}
+	}
+	return events, nil
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"link/internal/domain"
+	"link/internal/pkg/cardbatch"
+)
+
+const (
+	// cardPairIssueWindow is how long an issued pair stays open for registration
+	cardPairIssueWindow = 30 * 24 * time.Hour
+	maxBatchSize        = 500
+)
+
+// ManufactureBatch generates count new pairs under batchID. They cannot be registered until issued.
+func (s *CardService) ManufactureBatch(ctx context.Context, batchID string, count int) ([]*domain.CardPair, error) {
+	if !cardbatch.ValidBatchID(batchID) {
+		return nil, domain.ErrValidation("批號格式錯誤")
+	}
+	if count < 1 || count > maxBatchSize {
+		return nil, domain.ErrValidation(fmt.Sprintf("數量必須介於 1 到 %d", maxBatchSize))
+	}
+
+	existing, err := s.cardRepo.FindPairsByBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, domain.ErrConflict("批號已存在")
+	}
+
+	now := time.Now()
+	pairs := make([]*domain.CardPair, count)
+	for i := range pairs {
+		first, second, err := s.tokenGen.GeneratePair()
+		if err != nil {
+			return nil, domain.ErrInternal()
+		}
+		serial := cardbatch.SerialNumber(batchID, i)
+		pairs[i] = &domain.CardPair{
+			PrimaryToken: first,
+			BackupToken:  &second,
+			Status:       domain.CardPairManufactured,
+			BatchID:      &batchID,
+			SerialNumber: &serial,
+			ExpiresAt:    now, // the registration window opens when the pair is issued
+		}
+	}
+
+	if err := s.cardRepo.CreatePairs(ctx, pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// ImportBatch adds a batch file written by cmd/cardgen to the inventory as manufactured pairs
+func (s *CardService) ImportBatch(ctx context.Context, data []byte) ([]*domain.CardPair, error) {
+	batch, err := cardbatch.Open(data, s.batchSecret)
+	switch err {
+	case nil:
+	case cardbatch.ErrInvalidSignature:
+		return nil, domain.ErrValidation("批次檔簽章錯誤")
+	case cardbatch.ErrUnsupported:
+		return nil, domain.ErrValidation("不支援的批次檔版本")
+	default:
+		return nil, domain.ErrValidation("批次檔格式錯誤")
+	}
+	if len(batch.Pairs) > maxBatchSize {
+		return nil, domain.ErrValidation(fmt.Sprintf("數量必須介於 1 到 %d", maxBatchSize))
+	}
+
+	existing, err := s.cardRepo.FindPairsByBatch(ctx, batch.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, domain.ErrConflict("批號已存在")
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	pairs := make([]*domain.CardPair, len(batch.Pairs))
+	for i, p := range batch.Pairs {
+		// The file is signed, but the tokens must also verify against the current card keys
+		if !s.tokenGen.ArePaired(p.PrimaryToken, p.BackupToken) {
+			return nil, domain.ErrValidation(fmt.Sprintf("序號 %s 的卡片無效", p.SerialNumber))
+		}
+		for _, v := range []string{p.SerialNumber, p.PrimaryToken, p.BackupToken} {
+			if seen[v] {
+				return nil, domain.ErrValidation(fmt.Sprintf("序號 %s 重複", p.SerialNumber))
+			}
+			seen[v] = true
+		}
+		pairs[i] = &domain.CardPair{
+			PrimaryToken: p.PrimaryToken,
+			BackupToken:  &batch.Pairs[i].BackupToken,
+			Status:       domain.CardPairManufactured,
+			BatchID:      &batch.BatchID,
+			SerialNumber: &batch.Pairs[i].SerialNumber,
+			ExpiresAt:    now,
+		}
+	}
+
+	// Tokens or serials already in the inventory violate the unique constraints and roll back the whole batch
+	if err := s.cardRepo.CreatePairs(ctx, pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// GeneratePair creates a single pair that is issued straight away, for ad-hoc handouts outside a batch
+func (s *CardService) GeneratePair(ctx context.Context) (*domain.CardPair, error) {
+	first, second, err := s.tokenGen.GeneratePair()
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+
+	now := time.Now()
+	pairs := []*domain.CardPair{{
+		PrimaryToken: first,
+		BackupToken:  &second,
+		Status:       domain.CardPairIssued,
+		IssuedAt:     &now,
+		ExpiresAt:    now.Add(cardPairIssueWindow),
+	}}
+	if err := s.cardRepo.CreatePairs(ctx, pairs); err != nil {
+		return nil, err
+	}
+	return pairs[0], nil
+}
+
+func (s *CardService) ListPairs(ctx context.Context, filter domain.CardPairFilter) ([]*domain.CardPair, int, error) {
+	switch filter.State {
+	case "", domain.CardPairStateActivated, domain.CardPairStateExpired, domain.CardPairStateUnused:
+	default:
+		return nil, 0, domain.ErrValidation("無效的篩選條件")
+	}
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	filter.Query = strings.TrimSpace(filter.Query)
+
+	pairs, total, err := s.cardRepo.ListPairs(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pairs == nil {
+		pairs = []*domain.CardPair{}
+	}
+	return pairs, total, nil
+}
+
+// DeletePair removes a pair that was never registered, e.g. one generated by mistake
+func (s *CardService) DeletePair(ctx context.Context, pairID string) error {
+	ok, err := s.cardRepo.DeletePair(ctx, pairID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.unregisteredPairError(ctx, pairID)
+	}
+	return nil
+}
+
+// RevokeUnusedPair keeps the record of a pair that was never registered but makes it unusable
+func (s *CardService) RevokeUnusedPair(ctx context.Context, pairID string) (*domain.CardPair, error) {
+	pair, err := s.cardRepo.FindPairByID(ctx, pairID)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, domain.ErrNotFound("卡片組不存在")
+	}
+	if pair.Status != domain.CardPairManufactured && pair.Status != domain.CardPairIssued {
+		return nil, domain.ErrConflict(fmt.Sprintf("卡片組狀態為 %s，只能撤銷未註冊的卡片組", pair.Status))
+	}
+	return s.SetPairStatus(ctx, pairID, domain.CardPairRevoked)
+}
+
+// GetBatch returns every pair of a batch with a count per status
+func (s *CardService) GetBatch(ctx context.Context, batchID string) (*domain.CardBatch, error) {
+	pairs, err := s.cardRepo.FindPairsByBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, domain.ErrNotFound("批號不存在")
+	}
+
+	batch := &domain.CardBatch{
+		BatchID: batchID,
+		Counts:  make(map[domain.CardPairStatus]int),
+		Pairs:   pairs,
+	}
+	for _, p := range pairs {
+		batch.Counts[p.Status]++
+	}
+	return batch, nil
+}
+
+// IssuePair hands a manufactured pair to someone and opens its registration window
+func (s *CardService) IssuePair(ctx context.Context, pairID, issuedTo string) (*domain.CardPair, error) {
+	issuedTo = strings.TrimSpace(issuedTo)
+	if issuedTo == "" || len(issuedTo) > 255 {
+		return nil, domain.ErrValidation("請填寫領取人")
+	}
+
+	ok, err := s.cardRepo.IssuePair(ctx, pairID, issuedTo, time.Now().Add(cardPairIssueWindow))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.pairTransitionError(ctx, pairID, domain.CardPairIssued)
+	}
+	return s.cardRepo.FindPairByID(ctx, pairID)
+}
+
+// ShipPair records when an issued pair left the warehouse
+func (s *CardService) ShipPair(ctx context.Context, pairID string) (*domain.CardPair, error) {
+	ok, err := s.cardRepo.MarkPairShipped(ctx, pairID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		pair, err := s.cardRepo.FindPairByID(ctx, pairID)
+		if err != nil {
+			return nil, err
+		}
+		if pair == nil {
+			return nil, domain.ErrNotFound("卡片組不存在")
+		}
+		if pair.ShippedAt != nil {
+			return nil, domain.ErrConflict("卡片組已出貨")
+		}
+		return nil, domain.ErrConflict("卡片組尚未發行，無法出貨")
+	}
+	return s.cardRepo.FindPairByID(ctx, pairID)
+}
+
+// SetPairStatus marks a pair lost or revoked. Cards already registered from the pair stop working,
+// and like any card revocation that takes the owner's passkeys and sessions with it.
+func (s *CardService) SetPairStatus(ctx context.Context, pairID string, to domain.CardPairStatus) (*domain.CardPair, error) {
+	// Issuing and registering carry extra data and have their own entry points
+	if to != domain.CardPairLost && to != domain.CardPairRevoked {
+		return nil, domain.ErrValidation("無效的狀態")
+	}
+
+	pair, err := s.cardRepo.FindPairByID(ctx, pairID)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, domain.ErrNotFound("卡片組不存在")
+	}
+	if !pair.Status.CanTransitionTo(to) {
+		return nil, domain.ErrConflict(fmt.Sprintf("卡片組狀態為 %s，無法變更為 %s", pair.Status, to))
+	}
+
+	tokens := []string{pair.PrimaryToken}
+	if pair.BackupToken != nil {
+		tokens = append(tokens, *pair.BackupToken)
+	}
+
+	var owners []string
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		ok, err := repos.Cards.UpdatePairStatus(ctx, pairID, pair.Status, to)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return domain.ErrConflict("卡片組狀態已變更，請重新整理")
+		}
+
+		owners = nil
+		for _, token := range tokens {
+			card, err := repos.Cards.FindByToken(ctx, token)
+			if err != nil {
+				return err
+			}
+			if card == nil || card.Status != domain.CardStatusActive {
+				continue
+			}
+			if err := repos.Cards.Revoke(ctx, card.ID); err != nil {
+				return err
+			}
+			if err := repos.Cards.RecordEvent(ctx, card.UserID, card.ID, domain.CardEventRevoked); err != nil {
+				return err
+			}
+			// Both cards of a pair normally belong to the same user
+			if len(owners) == 0 || owners[0] != card.UserID {
+				owners = append(owners, card.UserID)
+			}
+		}
+		for _, userID := range owners {
+			if err := revokeUserAccess(ctx, repos, userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userID := range owners {
+		if err := s.sessionSvc.RevokeUser(ctx, userID, "", domain.RevokeReasonCardsRevoked); err != nil {
+			return nil, err
+		}
+	}
+	return s.cardRepo.FindPairByID(ctx, pairID)
+}
+
+func (s *CardService) unregisteredPairError(ctx context.Context, pairID string) error {
+	pair, err := s.cardRepo.FindPairByID(ctx, pairID)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return domain.ErrNotFound("卡片組不存在")
+	}
+	return domain.ErrConflict(fmt.Sprintf("卡片組狀態為 %s，只能刪除未註冊的卡片組", pair.Status))
+}
+
+func (s *CardService) pairTransitionError(ctx context.Context, pairID string, to domain.CardPairStatus) error {
+	pair, err := s.cardRepo.FindPairByID(ctx, pairID)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return domain.ErrNotFound("卡片組不存在")
+	}
+	return domain.ErrConflict(fmt.Sprintf("卡片組狀態為 %s，無法變更為 %s", pair.Status, to))
+}
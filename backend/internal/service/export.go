@@ -0,0 +1,137 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"link/internal/domain"
+)
+
+// ExportService assembles a user's personal data into a downloadable archive
+type ExportService struct {
+	userRepo    domain.UserRepository
+	cardRepo    domain.CardRepository
+	passkeyRepo domain.PasskeyRepository
+	friendRepo  domain.FriendshipRepository
+	convRepo    domain.ConversationRepository
+	msgRepo     domain.MessageRepository
+}
+
+// exportCard is a card as exported; the card token is a credential and stays out of the archive
+type exportCard struct {
+	ID          string            `json:"id"`
+	CardType    domain.CardType   `json:"card_type"`
+	Status      domain.CardStatus `json:"status"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ActivatedAt *time.Time        `json:"activated_at"`
+	RevokedAt   *time.Time        `json:"revoked_at"`
+}
+
+const exportReadme = `LINK 個人資料匯出
+
+profile.json        帳號資料
+cards.json          卡片、通行金鑰與卡片紀錄（不含卡片 token 與金鑰）
+friends.json        好友與待處理的好友邀請
+conversations.json  對話列表
+messages.json       所有對話中的訊息
+
+訊息為端對端加密，伺服器無法解密。encrypted_content 只能以您的密碼所衍生的金鑰解開。
+`
+
+func NewExportService(
+	userRepo domain.UserRepository,
+	cardRepo domain.CardRepository,
+	passkeyRepo domain.PasskeyRepository,
+	friendRepo domain.FriendshipRepository,
+	convRepo domain.ConversationRepository,
+	msgRepo domain.MessageRepository,
+) *ExportService {
+	return &ExportService{
+		userRepo:    userRepo,
+		cardRepo:    cardRepo,
+		passkeyRepo: passkeyRepo,
+		friendRepo:  friendRepo,
+		convRepo:    convRepo,
+		msgRepo:     msgRepo,
+	}
+}
+
+// Export writes a zip archive of the user's profile, cards, passkeys and card history, friends,
+// conversations and encrypted messages to w
+func (s *ExportService) Export(ctx context.Context, userID string, w io.Writer) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	cards, err := s.cardRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	exportCards := make([]exportCard, len(cards))
+	for i, c := range cards {
+		exportCards[i] = exportCard{c.ID, c.CardType, c.Status, c.CreatedAt, c.ActivatedAt, c.RevokedAt}
+	}
+	passkeys, err := s.passkeyRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	history, err := s.cardRepo.FindEventsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	friends, err := s.friendRepo.FindFriends(ctx, userID)
+	if err != nil {
+		return err
+	}
+	pending, err := s.friendRepo.FindPendingRequests(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	convs, err := s.convRepo.FindByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	messages, err := s.msgRepo.FindAllByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"cards.json", map[string]interface{}{"cards": exportCards, "passkeys": passkeys, "history": history}},
+		{"friends.json", map[string]interface{}{"friends": friends, "pending_requests": pending}},
+		{"conversations.json", convs},
+		{"messages.json", messages},
+	}
+
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	readme, err := zw.CreateHeader(&zip.FileHeader{Name: "README.txt", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(readme, exportReadme); err != nil {
+		return err
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
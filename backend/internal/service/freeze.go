@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"link/internal/domain"
+)
+
+// FreezeResponse tells the owner how long the primary card can still unfreeze the account
+type FreezeResponse struct {
+	UnfreezeBefore time.Time `json:"unfreeze_before"`
+}
+
+// Freeze locks the account with the backup card and password, for owners who only think their
+// primary card is lost. Unlike LoginWithBackupCard nothing is revoked or promoted: every session
+// is signed out and logins are refused until Unfreeze.
+func (s *AuthService) Freeze(ctx context.Context, cardToken, tapNonce, pwd string) (*FreezeResponse, error) {
+	card, err := s.cardRepo.FindByToken(ctx, cardToken)
+	if err != nil || card == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if card.Status == domain.CardStatusRevoked {
+		return nil, domain.ErrUnauthorized("此卡片已失效")
+	}
+	if card.CardType != domain.CardTypeBackup {
+		return nil, domain.ErrValidation("請使用副卡凍結帳號")
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, false); err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifyCardPassword(ctx, card, pwd)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, true); err != nil {
+		return nil, err
+	}
+
+	unfreezeBefore := time.Now().Add(s.freezeWindow)
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		ok, err := repos.Users.Freeze(ctx, user.ID, unfreezeBefore)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return freezeConflict(ctx, repos.Users, user.ID)
+		}
+		if err := repos.Cards.RecordEvent(ctx, user.ID, card.ID, domain.CardEventAccountFrozen); err != nil {
+			return err
+		}
+		return repos.Sessions.RevokeAllByUser(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionSvc.RevokeUser(ctx, user.ID, "", domain.RevokeReasonAccountFrozen); err != nil {
+		return nil, err
+	}
+	return &FreezeResponse{UnfreezeBefore: unfreezeBefore}, nil
+}
+
+// freezeConflict explains why an account could not be frozen, which is only possible while it is active
+func freezeConflict(ctx context.Context, users domain.UserRepository, userID string) error {
+	status, err := users.GetStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if status == domain.UserStatusSuspended {
+		return domain.ErrAccountSuspended
+	}
+	return domain.ErrConflict("帳號已凍結")
+}
+
+// Unfreeze lifts a freeze with the primary card and password and logs in. Once the window has
+// passed the primary card is presumed lost, and only revoking it with the backup card is left.
+func (s *AuthService) Unfreeze(ctx context.Context, cardToken, tapNonce, pwd string, client domain.ClientInfo) (*AuthResponse, error) {
+	card, err := s.cardRepo.FindByToken(ctx, cardToken)
+	if err != nil || card == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if card.Status == domain.CardStatusRevoked {
+		return nil, domain.ErrUnauthorized("此卡片已失效")
+	}
+	if card.CardType != domain.CardTypePrimary {
+		return nil, domain.ErrValidation("請使用主卡解除凍結")
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, false); err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifyCardPassword(ctx, card, pwd)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != domain.UserStatusFrozen {
+		return nil, domain.ErrValidation("帳號未凍結")
+	}
+	if user.UnfreezeBefore != nil && time.Now().After(*user.UnfreezeBefore) {
+		return nil, domain.ErrForbidden("已超過解除凍結的期限，請使用副卡撤銷主卡")
+	}
+	if err := s.cardSvc.requireTap(ctx, cardToken, tapNonce, true); err != nil {
+		return nil, err
+	}
+	notice := s.throttle.notice(ctx, user.ID)
+
+	err = s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		ok, err := repos.Users.Unfreeze(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return domain.ErrValidation("帳號未凍結")
+		}
+		return repos.Cards.RecordEvent(ctx, user.ID, card.ID, domain.CardEventAccountUnfrozen)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.Status = domain.UserStatusActive
+	user.FrozenAt = nil
+	user.UnfreezeBefore = nil
+
+	res, err := s.newAuthResponse(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	res.SecurityNotice = notice
+	res.DeletionCancelled = s.cancelPendingDeletion(ctx, user)
+	return res, nil
+}
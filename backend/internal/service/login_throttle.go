@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"link/internal/domain"
+)
+
+// Failed password attempts per card: the first few are free, then each failure
+// doubles the wait, and past maxBackoffFailures the card is locked for lockoutDuration.
+const (
+	freeLoginFailures  = 3
+	baseLoginBackoff   = 30 * time.Second
+	maxBackoffFailures = 10
+	lockoutDuration    = time.Hour
+)
+
+// loginBackoff returns how long a card stays locked after its n-th consecutive failure
+func loginBackoff(failures int) time.Duration {
+	switch {
+	case failures < freeLoginFailures:
+		return 0
+	case failures >= maxBackoffFailures:
+		return lockoutDuration
+	default:
+		return baseLoginBackoff << (failures - freeLoginFailures)
+	}
+}
+
+// loginThrottle tracks password failures per card in the database, so the limit holds
+// no matter how many IPs an attacker with a card URL spreads guesses across.
+// Every attempt is reserved as a failure before its password is checked and rolled back once the
+// password turns out right, so parallel guesses each see the ones before them.
+type loginThrottle struct {
+	repo domain.LoginAttemptRepository
+	uow  domain.UnitOfWork
+}
+
+// reserve rejects the attempt while the card is locked, and otherwise counts it as a failure up
+// front, locking the card for the backoff that failure earns
+func (t *loginThrottle) reserve(ctx context.Context, cardID string) error {
+	return t.uow.Do(ctx, func(repos *domain.Repositories) error {
+		attempts, err := repos.LoginAttempts.Acquire(ctx, cardID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if attempts.LockedUntil != nil && now.Before(*attempts.LockedUntil) {
+			return domain.ErrLoginLocked(*attempts.LockedUntil)
+		}
+
+		var lockedUntil *time.Time
+		if backoff := loginBackoff(attempts.Failures + 1); backoff > 0 {
+			until := now.Add(backoff)
+			lockedUntil = &until
+		}
+		return repos.LoginAttempts.Reserve(ctx, cardID, lockedUntil)
+	})
+}
+
+// fail keeps a reserved attempt whose password was wrong, and reports it to the owner later
+func (t *loginThrottle) fail(ctx context.Context, cardID string) {
+	attempts, err := t.repo.RecordFailure(ctx, cardID)
+	if err != nil {
+		slog.Error("failed to record login failure", "card_id", cardID, "error", err)
+		return
+	}
+	if attempts.LockedUntil != nil {
+		slog.Warn("card locked after failed logins", "card_id", cardID, "failures", attempts.Failures, "locked_until", *attempts.LockedUntil)
+	}
+}
+
+// release rolls back the reservation of an attempt that did not fail: one with the right password,
+// or one whose password could not be checked. It clears the backoff.
+func (t *loginThrottle) release(ctx context.Context, cardID string) {
+	if err := t.repo.Reset(ctx, cardID); err != nil {
+		slog.Error("failed to reset login failures", "card_id", cardID, "error", err)
+	}
+}
+
+// notice returns the failures on the user's cards that the owner has not seen yet
+func (t *loginThrottle) notice(ctx context.Context, userID string) *domain.LoginFailureNotice {
+	notice, err := t.repo.TakeUnreported(ctx, userID)
+	if err != nil {
+		slog.Error("failed to load login failures", "user_id", userID, "error", err)
+		return nil
+	}
+	return notice
+}
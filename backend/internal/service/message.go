@@ -8,36 +8,91 @@ import (
 )
 
 type MessageService struct {
-	msgRepo  domain.MessageRepository
-	convRepo domain.ConversationRepository
+	msgRepo    domain.MessageRepository
+	convRepo   domain.ConversationRepository
+	friendRepo domain.FriendshipRepository
 }
 
-func NewMessageService(msgRepo domain.MessageRepository, convRepo domain.ConversationRepository) *MessageService {
-	return &MessageService{msgRepo: msgRepo, convRepo: convRepo}
+func NewMessageService(msgRepo domain.MessageRepository, convRepo domain.ConversationRepository, friendRepo domain.FriendshipRepository) *MessageService {
+	return &MessageService{msgRepo: msgRepo, convRepo: convRepo, friendRepo: friendRepo}
 }
 
-func (s *MessageService) Send(ctx context.Context, senderID, conversationID, encryptedContent string) (*domain.Message, error) {
-	conv, err := s.convRepo.FindByID(ctx, conversationID)
+// maxTempIDLength matches messages.temp_id
+const maxTempIDLength = 64
+
+// Send stores a message from senderID to recipientID, who must be friends, creating their
+// conversation on first contact. tempID makes the send idempotent: retrying with the same one
+// returns the original message and false instead of storing it again.
+func (s *MessageService) Send(ctx context.Context, senderID, recipientID, encryptedContent, tempID string) (*domain.Message, bool, error) {
+	if !domain.IsUUID(recipientID) || recipientID == senderID {
+		return nil, false, domain.ErrValidation("無效的收件者")
+	}
+	if encryptedContent == "" {
+		return nil, false, domain.ErrValidation("訊息內容不可為空")
+	}
+	if len(tempID) > maxTempIDLength {
+		return nil, false, domain.ErrValidation("無效的 temp_id")
+	}
+
+	friendship, err := s.friendRepo.FindByUsers(ctx, senderID, recipientID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if friendship == nil || friendship.Status != domain.FriendshipAccepted {
+		return nil, false, domain.ErrNotFriends
 	}
 
-	if conv.Participant1 != senderID && conv.Participant2 != senderID {
-		return nil, domain.ErrUnauthorized("not a participant")
+	// A retry is answered before the conversation is looked up, so it never creates one
+	if tempID != "" {
+		existing, err := s.msgRepo.FindByTempID(ctx, senderID, tempID)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			if err := s.checkRetry(ctx, existing, senderID, recipientID); err != nil {
+				return nil, false, err
+			}
+			return existing, false, nil
+		}
+	}
+
+	conv, err := s.convRepo.GetOrCreate(ctx, senderID, recipientID)
+	if err != nil {
+		return nil, false, err
 	}
 
 	msg := &domain.Message{
-		ConversationID:   conversationID,
+		ConversationID:   conv.ID,
 		SenderID:         senderID,
 		EncryptedContent: encryptedContent,
+		TempID:           tempID,
 	}
-	if err := s.msgRepo.Create(ctx, msg); err != nil {
-		return nil, err
+	created, err := s.msgRepo.Create(ctx, msg)
+	if err != nil {
+		return nil, false, err
 	}
-	return msg, nil
+	if !created && msg.ConversationID != conv.ID {
+		return nil, false, domain.ErrConflict("此 temp_id 已用於其他對話")
+	}
+	return msg, created, nil
 }
 
-func (s *MessageService) GetMessages(ctx context.Context, userID, conversationID string, limit int, before *time.Time) ([]*domain.Message, error) {
+// checkRetry rejects a temp_id the sender already used for a message to someone else
+func (s *MessageService) checkRetry(ctx context.Context, existing *domain.Message, senderID, recipientID string) error {
+	conv, err := s.convRepo.FindByID(ctx, existing.ConversationID)
+	if err != nil {
+		return err
+	}
+	if !(conv.Participant1 == senderID && conv.Participant2 == recipientID) &&
+		!(conv.Participant1 == recipientID && conv.Participant2 == senderID) {
+		return domain.ErrConflict("此 temp_id 已用於其他對話")
+	}
+	return nil
+}
+
+// GetMessages returns a page of a conversation, oldest first. before and after are message IDs;
+// before also accepts an RFC 3339 time for older clients.
+func (s *MessageService) GetMessages(ctx context.Context, userID, conversationID string, limit int, before, after string) ([]*domain.Message, error) {
 	conv, err := s.convRepo.FindByID(ctx, conversationID)
 	if err != nil {
 		return nil, err
@@ -51,7 +106,29 @@ func (s *MessageService) GetMessages(ctx context.Context, userID, conversationID
 		limit = 50
 	}
 
-	return s.msgRepo.FindByConversation(ctx, conversationID, limit, before)
+	page := domain.MessagePage{Limit: limit}
+	if page.Before, err = s.messageCursor(ctx, conversationID, before); err != nil {
+		return nil, err
+	}
+	if page.After, err = s.messageCursor(ctx, conversationID, after); err != nil {
+		return nil, err
+	}
+	return s.msgRepo.FindByConversation(ctx, conversationID, page)
+}
+
+// messageCursor resolves a paging position given as a message ID, or as a bare time
+func (s *MessageService) messageCursor(ctx context.Context, conversationID, value string) (*domain.MessageCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &domain.MessageCursor{CreatedAt: t}, nil
+	}
+	msg, err := s.msgRepo.FindByID(ctx, value)
+	if err != nil || msg.ConversationID != conversationID {
+		return nil, domain.ErrValidation("無效的分頁位置")
+	}
+	return &domain.MessageCursor{CreatedAt: msg.CreatedAt, ID: msg.ID}, nil
 }
 
 func (s *MessageService) Delete(ctx context.Context, userID, messageID string) (*domain.Message, error) {
@@ -72,8 +149,15 @@ func (s *MessageService) Delete(ctx context.Context, userID, messageID string) (
 	return msg, nil
 }
 
-func (s *MessageService) MarkDelivered(ctx context.Context, messageID string) error {
-	return s.msgRepo.MarkDelivered(ctx, messageID)
+// MarkDelivered records that the recipient received the message. It returns nil when there
+// was nothing to record, so the sender is told about each delivery once.
+func (s *MessageService) MarkDelivered(ctx context.Context, messageID, recipientID string) (*domain.Message, error) {
+	return s.msgRepo.MarkDelivered(ctx, messageID, recipientID)
+}
+
+// FindUndelivered returns the next messages waiting for the user, oldest first
+func (s *MessageService) FindUndelivered(ctx context.Context, userID string, after *domain.MessageCursor, limit int) ([]*domain.Message, error) {
+	return s.msgRepo.FindUndelivered(ctx, userID, after, limit)
 }
 
 func (s *MessageService) MarkRead(ctx context.Context, messageID string) error {
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"link/internal/domain"
+	"link/internal/pkg/webauthn"
+)
+
+const (
+	webauthnTimeout      = 5 * time.Minute
+	maxPasskeysPerUser   = 10
+	maxPasskeyNameLength = 50
+	defaultPasskeyName   = "通行金鑰"
+)
+
+// PasskeyService manages WebAuthn credentials that can replace the primary card at login
+type PasskeyService struct {
+	passkeyRepo domain.PasskeyRepository
+	userRepo    domain.UserRepository
+	rp          *webauthn.RelyingParty // nil when passkey login is disabled
+}
+
+func NewPasskeyService(passkeyRepo domain.PasskeyRepository, userRepo domain.UserRepository, rp *webauthn.RelyingParty) *PasskeyService {
+	return &PasskeyService{passkeyRepo: passkeyRepo, userRepo: userRepo, rp: rp}
+}
+
+// PasskeyOptions starts a WebAuthn ceremony. PublicKey is passed to navigator.credentials.create()
+// or .get() after decoding its base64url fields, and the answer is sent back with ChallengeID.
+type PasskeyOptions struct {
+	ChallengeID string      `json:"challenge_id"`
+	PublicKey   interface{} `json:"public_key"`
+}
+
+// The option dictionaries mirror the WebAuthn spec names, so the client can hand them to the browser as is
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+type creationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   userEntity             `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+	Timeout                int64                  `json:"timeout"`
+}
+
+type requestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	UserVerification string `json:"userVerification"`
+	Timeout          int64  `json:"timeout"`
+}
+
+// PasskeyRegistration is the browser's answer to RegistrationOptions
+type PasskeyRegistration struct {
+	ChallengeID       string
+	Name              string
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+func (s *PasskeyService) enabled() error {
+	if s.rp == nil {
+		return domain.ErrValidation("未啟用通行金鑰登入")
+	}
+	return nil
+}
+
+// RegistrationOptions starts enrolling a passkey for the user. Passkeys are created as discoverable
+// credentials, so login needs neither the card nor a user name to find the account.
+func (s *PasskeyService) RegistrationOptions(ctx context.Context, userID string) (*PasskeyOptions, error) {
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.passkeyRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := []credentialDescriptor{}
+	for _, p := range passkeys {
+		if p.Status == domain.CardStatusActive {
+			exclude = append(exclude, credentialDescriptor{Type: "public-key", ID: webauthn.Encoding.EncodeToString(p.CredentialID)})
+		}
+	}
+	if len(exclude) >= maxPasskeysPerUser {
+		return nil, domain.ErrConflict("通行金鑰數量已達上限")
+	}
+
+	challenge, err := s.newChallenge(ctx, userID, domain.WebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]credentialParameter, len(webauthn.SupportedAlgorithms))
+	for i, alg := range webauthn.SupportedAlgorithms {
+		params[i] = credentialParameter{Type: "public-key", Alg: alg}
+	}
+	return &PasskeyOptions{
+		ChallengeID: challenge.ID,
+		PublicKey: creationOptions{
+			Challenge: webauthn.Encoding.EncodeToString(challenge.Challenge),
+			RP:        rpEntity{ID: s.rp.ID, Name: s.rp.Name},
+			User: userEntity{
+				ID:          webauthn.Encoding.EncodeToString([]byte(user.ID)),
+				Name:        user.Nickname,
+				DisplayName: user.Nickname,
+			},
+			PubKeyCredParams:   params,
+			ExcludeCredentials: exclude,
+			AuthenticatorSelection: authenticatorSelection{
+				ResidentKey:        "required",
+				RequireResidentKey: true,
+				UserVerification:   "preferred",
+			},
+			Attestation: "none",
+			Timeout:     webauthnTimeout.Milliseconds(),
+		},
+	}, nil
+}
+
+// register verifies the browser's answer to RegistrationOptions and stores the new passkey.
+// Callers must have re-authenticated the user first, see AuthService.RegisterPasskey.
+func (s *PasskeyService) register(ctx context.Context, userID string, input PasskeyRegistration) (*domain.Passkey, error) {
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+	challenge, err := s.passkeyRepo.TakeChallenge(ctx, input.ChallengeID, domain.WebAuthnRegister)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil || challenge.UserID != userID {
+		return nil, domain.ErrValidation("通行金鑰驗證已逾時，請重試")
+	}
+
+	cred, err := s.rp.VerifyRegistration(challenge.Challenge, input.ClientDataJSON, input.AttestationObject)
+	if err != nil {
+		slog.Warn("passkey registration rejected", "user_id", userID, "error", err)
+		return nil, domain.ErrValidation("通行金鑰驗證失敗")
+	}
+
+	if existing, err := s.passkeyRepo.FindByCredentialID(ctx, cred.ID); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, domain.ErrConflict("此通行金鑰已註冊")
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	if r := []rune(name); len(r) > maxPasskeyNameLength {
+		name = string(r[:maxPasskeyNameLength])
+	}
+
+	passkey := &domain.Passkey{
+		UserID:       userID,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		AAGUID:       cred.AAGUID,
+		Name:         name,
+	}
+	if err := s.passkeyRepo.Create(ctx, passkey); err != nil {
+		return nil, err
+	}
+	if err := s.passkeyRepo.RecordEvent(ctx, userID, passkey.ID, domain.CardEventPasskeyRegistered); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// LoginOptions starts a passkey login. No credentials are listed, the authenticator offers
+// the discoverable ones it holds for this site.
+func (s *PasskeyService) LoginOptions(ctx context.Context) (*PasskeyOptions, error) {
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(ctx, "", domain.WebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyOptions{
+		ChallengeID: challenge.ID,
+		PublicKey: requestOptions{
+			Challenge:        webauthn.Encoding.EncodeToString(challenge.Challenge),
+			RPID:             s.rp.ID,
+			UserVerification: "preferred",
+			Timeout:          webauthnTimeout.Milliseconds(),
+		},
+	}, nil
+}
+
+// verifyAssertion checks a passkey login assertion and returns the passkey it was made with.
+// It proves possession only; the password is checked by AuthService.LoginWithPasskey.
+func (s *PasskeyService) verifyAssertion(ctx context.Context, challengeID string, assertion *webauthn.Assertion) (*domain.Passkey, error) {
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+	challenge, err := s.passkeyRepo.TakeChallenge(ctx, challengeID, domain.WebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil {
+		return nil, domain.ErrValidation("通行金鑰驗證已逾時，請重試")
+	}
+
+	passkey, err := s.passkeyRepo.FindByCredentialID(ctx, assertion.CredentialID)
+	if err != nil {
+		return nil, err
+	}
+	if passkey == nil {
+		return nil, domain.ErrUnauthorized("此通行金鑰未註冊")
+	}
+	if passkey.Status == domain.CardStatusRevoked {
+		return nil, domain.ErrUnauthorized("此通行金鑰已失效")
+	}
+	if len(assertion.UserHandle) > 0 && string(assertion.UserHandle) != passkey.UserID {
+		return nil, domain.ErrUnauthorized("通行金鑰驗證失敗")
+	}
+
+	signCount, err := s.rp.VerifyAssertion(challenge.Challenge, assertion, passkey.PublicKey, passkey.SignCount)
+	if errors.Is(err, webauthn.ErrSignCount) {
+		slog.Warn("passkey counter did not advance, possible cloned authenticator", "passkey_id", passkey.ID, "user_id", passkey.UserID)
+	}
+	if err != nil {
+		return nil, domain.ErrUnauthorized("通行金鑰驗證失敗")
+	}
+
+	ok, err := s.passkeyRepo.UpdateUsage(ctx, passkey.ID, signCount)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrUnauthorized("通行金鑰驗證失敗")
+	}
+	return passkey, nil
+}
+
+// recordUse adds a successful passkey login to the card history. Failure only loses the entry.
+func (s *PasskeyService) recordUse(ctx context.Context, passkey *domain.Passkey) {
+	if err := s.passkeyRepo.RecordEvent(ctx, passkey.UserID, passkey.ID, domain.CardEventPasskeyUsed); err != nil {
+		slog.Warn("failed to record passkey use", "passkey_id", passkey.ID, "error", err)
+	}
+}
+
+func (s *PasskeyService) GetUserPasskeys(ctx context.Context, userID string) ([]*domain.Passkey, error) {
+	passkeys, err := s.passkeyRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if passkeys == nil {
+		passkeys = []*domain.Passkey{}
+	}
+	return passkeys, nil
+}
+
+// Revoke revokes one of the user's own passkeys
+func (s *PasskeyService) Revoke(ctx context.Context, userID, passkeyID string) error {
+	ok, err := s.passkeyRepo.Revoke(ctx, userID, passkeyID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrNotFound("通行金鑰不存在或已失效")
+	}
+	return s.passkeyRepo.RecordEvent(ctx, userID, passkeyID, domain.CardEventPasskeyRevoked)
+}
+
+func (s *PasskeyService) newChallenge(ctx context.Context, userID string, purpose domain.WebAuthnPurpose) (*domain.WebAuthnChallenge, error) {
+	b, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, domain.ErrInternal()
+	}
+	challenge := &domain.WebAuthnChallenge{
+		UserID:    userID,
+		Purpose:   purpose,
+		Challenge: b,
+		ExpiresAt: time.Now().Add(webauthnTimeout),
+	}
+	if err := s.passkeyRepo.CreateChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"link/internal/domain"
+	"link/internal/pkg/token"
+)
+
+// RealtimeRevoker drops the realtime connections of revoked sessions, telling each client why first
+type RealtimeRevoker interface {
+	RevokeSession(sessionID, reason string) bool
+	RevokeUser(userID, keepSessionID, reason string) int
+}
+
+type SessionService struct {
+	sessionRepo   domain.SessionRepository
+	refreshRepo   domain.RefreshTokenRepository
+	userRepo      domain.UserRepository
+	uow           domain.UnitOfWork
+	tokenMgr      *token.Manager
+	realtime      RealtimeRevoker
+	refreshExpiry time.Duration
+}
+
+// touchInterval limits how often a session's last use is written back on authenticated requests
+const touchInterval = time.Minute
+
+// TokenPair is a short-lived access token plus the refresh token that renews it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // access token expiry
+	SessionID    string
+}
+
+func NewSessionService(
+	sessionRepo domain.SessionRepository,
+	refreshRepo domain.RefreshTokenRepository,
+	userRepo domain.UserRepository,
+	uow domain.UnitOfWork,
+	tokenMgr *token.Manager,
+	realtime RealtimeRevoker,
+	refreshExpiry time.Duration,
+) *SessionService {
+	return &SessionService{
+		sessionRepo:   sessionRepo,
+		refreshRepo:   refreshRepo,
+		userRepo:      userRepo,
+		uow:           uow,
+		tokenMgr:      tokenMgr,
+		realtime:      realtime,
+		refreshExpiry: refreshExpiry,
+	}
+}
+
+// Create starts a new session: an access token whose jti hash is stored on the session,
+// and the first refresh token of the session's family
+func (s *SessionService) Create(ctx context.Context, userID string, client domain.ClientInfo) (*TokenPair, error) {
+	issued, err := s.tokenMgr.Issue(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &domain.Session{
+		UserID:    userID,
+		TokenHash: token.HashID(issued.JTI),
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(s.refreshExpiry),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	refresh, err := s.newRefreshToken(ctx, s.refreshRepo, session.ID, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: issued.Token, RefreshToken: refresh, ExpiresAt: issued.ExpiresAt, SessionID: session.ID}, nil
+}
+
+// errRefreshTokenSpent rolls back a refresh whose token was already used or never existed
+var errRefreshTokenSpent = errors.New("refresh token spent")
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token works once;
+// presenting a used one means it was copied, so the whole session is revoked and whichever
+// device is connected with it is dropped. The old token is only spent together with issuing
+// the new one, so a failed refresh can be retried.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, client domain.ClientInfo) (*TokenPair, error) {
+	hash := token.HashID(refreshToken)
+
+	var pair *TokenPair
+	err := s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		rt, err := repos.RefreshTokens.Consume(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if rt == nil {
+			return errRefreshTokenSpent
+		}
+		if time.Now().After(rt.ExpiresAt) {
+			return domain.ErrSessionRevoked
+		}
+
+		session, err := repos.Sessions.FindByID(ctx, rt.SessionID)
+		if err != nil {
+			return err
+		}
+		if session == nil || session.RevokedAt != nil {
+			return domain.ErrSessionRevoked
+		}
+		if err := s.checkUserActive(ctx, session.UserID); err != nil {
+			return err
+		}
+
+		issued, err := s.tokenMgr.Issue(session.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Rotating the jti hash also retires the previous access token
+		expiresAt := time.Now().Add(s.refreshExpiry)
+		if err := repos.Sessions.Rotate(ctx, session.ID, token.HashID(issued.JTI), expiresAt); err != nil {
+			return err
+		}
+
+		refresh, err := s.newRefreshToken(ctx, repos.RefreshTokens, session.ID, expiresAt)
+		if err != nil {
+			return err
+		}
+		pair = &TokenPair{AccessToken: issued.Token, RefreshToken: refresh, ExpiresAt: issued.ExpiresAt, SessionID: session.ID}
+		return nil
+	})
+	if errors.Is(err, errRefreshTokenSpent) {
+		used, err := s.refreshRepo.FindByHash(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if used == nil {
+			return nil, domain.ErrInvalidToken
+		}
+		if err := s.revokeSession(ctx, used.SessionID, domain.RevokeReasonTokenReused); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.Touch(ctx, pair.SessionID, client); err != nil {
+		slog.Warn("failed to record session use", "session_id", pair.SessionID, "error", err)
+	}
+	return pair, nil
+}
+
+func (s *SessionService) newRefreshToken(ctx context.Context, refreshRepo domain.RefreshTokenRepository, sessionID string, expiresAt time.Time) (string, error) {
+	raw, err := token.NewRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	rt := &domain.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: token.HashID(raw),
+		ExpiresAt: expiresAt,
+	}
+	if err := refreshRepo.Create(ctx, rt); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Authenticate verifies the token signature and that its session is neither revoked nor expired
+func (s *SessionService) Authenticate(ctx context.Context, tokenStr string) (*token.Claims, *domain.Session, error) {
+	claims, err := s.tokenMgr.Verify(tokenStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.ID == "" {
+		return nil, nil, domain.ErrSessionRevoked
+	}
+
+	session, err := s.sessionRepo.FindByTokenHash(ctx, token.HashID(claims.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil || session.UserID != claims.UserID {
+		return nil, nil, domain.ErrSessionRevoked
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, nil, domain.ErrSessionRevoked
+	}
+	if err := s.checkUserActive(ctx, session.UserID); err != nil {
+		return nil, nil, err
+	}
+
+	return claims, session, nil
+}
+
+// CheckSession reports why a session can no longer be used, or nil while it is still valid
+func (s *SessionService) CheckSession(ctx context.Context, sessionID string) error {
+	session, err := s.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return domain.ErrSessionRevoked
+	}
+	return s.checkUserActive(ctx, session.UserID)
+}
+
+// checkUserActive rejects sessions of suspended and frozen accounts. Both also revoke every session,
+// so this only matters for requests racing the suspension or freeze.
+func (s *SessionService) checkUserActive(ctx context.Context, userID string) error {
+	status, err := s.userRepo.GetStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case domain.UserStatusSuspended:
+		return domain.ErrAccountSuspended
+	case domain.UserStatusFrozen:
+		return domain.ErrAccountFrozen
+	}
+	return nil
+}
+
+// Touch records a use of the session, at most once per touchInterval unless the client changed
+func (s *SessionService) Touch(ctx context.Context, session *domain.Session, client domain.ClientInfo) error {
+	if time.Since(session.LastUsedAt) < touchInterval &&
+		session.IP == client.IP && session.UserAgent == client.UserAgent {
+		return nil
+	}
+	return s.sessionRepo.Touch(ctx, session.ID, client)
+}
+
+// ListByUser returns the user's active sessions
+func (s *SessionService) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []*domain.Session{}
+	}
+	return sessions, nil
+}
+
+// RevokeForUser revokes one of the user's own sessions and signs out the device using it
+func (s *SessionService) RevokeForUser(ctx context.Context, userID, sessionID string) error {
+	if !domain.IsUUID(sessionID) {
+		return domain.ErrSessionNotFound
+	}
+	session, err := s.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return domain.ErrSessionNotFound
+	}
+	return s.revokeSession(ctx, sessionID, domain.RevokeReasonSignedOut)
+}
+
+// Revoke signs out a session, including its realtime connection
+func (s *SessionService) Revoke(ctx context.Context, sessionID string) error {
+	return s.revokeSession(ctx, sessionID, domain.RevokeReasonSignedOut)
+}
+
+// RevokeUser is how every credential change signs a user out: it revokes all of the user's
+// sessions except keepSessionID, then drops their realtime connections with a security frame
+// carrying reason. Flows that revoke sessions inside their own transaction call it after the
+// commit, which leaves only the connections to drop.
+func (s *SessionService) RevokeUser(ctx context.Context, userID, keepSessionID, reason string) error {
+	var err error
+	if keepSessionID == "" {
+		err = s.sessionRepo.RevokeAllByUser(ctx, userID)
+	} else {
+		err = s.sessionRepo.RevokeOthers(ctx, userID, keepSessionID)
+	}
+	if err != nil {
+		return err
+	}
+	s.realtime.RevokeUser(userID, keepSessionID, reason)
+	return nil
+}
+
+// revokeSession is RevokeUser for a single session
+func (s *SessionService) revokeSession(ctx context.Context, sessionID, reason string) error {
+	if err := s.sessionRepo.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	s.realtime.RevokeSession(sessionID, reason)
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"link/internal/domain"
+)
+
+const (
+	defaultSyncLimit = 200
+	maxSyncLimit     = 500
+)
+
+// SyncResponse is one page of changes. Clients apply every page until HasMore is false and keep
+// Cursor for the next sync; a message may arrive a page before its new conversation does.
+type SyncResponse struct {
+	Conversations        []*domain.ConversationWithPeer `json:"conversations"`
+	Messages             []*domain.Message              `json:"messages"` // new, or newly delivered or read
+	Deleted              []*domain.MessageDeletion      `json:"deleted"`
+	DeletedConversations []*domain.ConversationDeletion `json:"deleted_conversations"` // with all their messages
+	Cursor               string                         `json:"cursor"`
+	HasMore              bool                           `json:"has_more"`
+}
+
+// The cursor is a sync position; it is encoded so clients treat it as opaque
+func encodeSyncCursor(pos domain.SyncPosition) string {
+	raw := strconv.FormatInt(pos.XID, 10) + "." + strconv.FormatInt(pos.Seq, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSyncCursor(cursor string) (domain.SyncPosition, error) {
+	if cursor == "" {
+		return domain.SyncPosition{}, nil
+	}
+	invalid := domain.ErrValidation("無效的同步游標")
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return domain.SyncPosition{}, invalid
+	}
+	xid, seq, ok := strings.Cut(string(b), ".")
+	if !ok {
+		return domain.SyncPosition{}, invalid
+	}
+	var pos domain.SyncPosition
+	if pos.XID, err = strconv.ParseInt(xid, 10, 64); err != nil || pos.XID < 0 {
+		return domain.SyncPosition{}, invalid
+	}
+	if pos.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil || pos.Seq < 0 {
+		return domain.SyncPosition{}, invalid
+	}
+	return pos, nil
+}
+
+// Sync returns what changed in the user's conversations after cursor; an empty cursor starts
+// from the beginning. Changes are taken in sync order across conversations, messages and
+// deletions, so a page never skips an older change to include a newer one. Changes of
+// transactions that may still be followed by an earlier one committing wait for a later sync.
+func (s *MessageService) Sync(ctx context.Context, userID, cursor string, limit int) (*SyncResponse, error) {
+	since, err := decodeSyncCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxSyncLimit {
+		limit = defaultSyncLimit
+	}
+
+	// Taken once so every kind of change is read up to the same point
+	horizon, err := s.msgRepo.SyncHorizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra of each kind tells whether anything is left past this page
+	convs, err := s.convRepo.FindChangedSince(ctx, userID, since, horizon, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.msgRepo.FindChangedSince(ctx, userID, since, horizon, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.msgRepo.FindDeletedSince(ctx, userID, since, horizon, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	deletedConvs, err := s.convRepo.FindDeletedSince(ctx, userID, since, horizon, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]domain.SyncPosition, 0, len(convs)+len(msgs)+len(deleted)+len(deletedConvs))
+	for _, c := range convs {
+		positions = append(positions, c.Sync)
+	}
+	for _, m := range msgs {
+		positions = append(positions, m.Sync)
+	}
+	for _, d := range deleted {
+		positions = append(positions, d.Sync)
+	}
+	for _, d := range deletedConvs {
+		positions = append(positions, d.Sync)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Before(positions[j]) })
+
+	res := &SyncResponse{
+		Conversations:        []*domain.ConversationWithPeer{},
+		Messages:             []*domain.Message{},
+		Deleted:              []*domain.MessageDeletion{},
+		DeletedConversations: []*domain.ConversationDeletion{},
+		Cursor:               encodeSyncCursor(since),
+	}
+	if len(positions) == 0 {
+		return res, nil
+	}
+
+	upTo := positions[len(positions)-1]
+	if len(positions) > limit {
+		upTo = positions[limit-1]
+		res.HasMore = true
+	}
+	for _, c := range convs {
+		if !upTo.Before(c.Sync) {
+			res.Conversations = append(res.Conversations, c)
+		}
+	}
+	for _, m := range msgs {
+		if !upTo.Before(m.Sync) {
+			res.Messages = append(res.Messages, m)
+		}
+	}
+	for _, d := range deleted {
+		if !upTo.Before(d.Sync) {
+			res.Deleted = append(res.Deleted, d)
+		}
+	}
+	for _, d := range deletedConvs {
+		if !upTo.Before(d.Sync) {
+			res.DeletedConversations = append(res.DeletedConversations, d)
+		}
+	}
+	res.Cursor = encodeSyncCursor(upTo)
+	return res, nil
+}
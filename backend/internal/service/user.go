@@ -2,16 +2,26 @@ package service
 
 import (
 	"context"
+	"strings"
 
 	"link/internal/domain"
 )
 
 type UserService struct {
-	userRepo domain.UserRepository
+	userRepo   domain.UserRepository
+	cardRepo   domain.CardRepository
+	sessionSvc *SessionService
+	uow        domain.UnitOfWork
 }
 
-func NewUserService(userRepo domain.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+// UserOverview is a user with their cards, as support staff see them
+type UserOverview struct {
+	User  *domain.User
+	Cards []*domain.Card
+}
+
+func NewUserService(userRepo domain.UserRepository, cardRepo domain.CardRepository, sessionSvc *SessionService, uow domain.UnitOfWork) *UserService {
+	return &UserService{userRepo: userRepo, cardRepo: cardRepo, sessionSvc: sessionSvc, uow: uow}
 }
 
 func (s *UserService) GetByID(ctx context.Context, id string) (*domain.User, error) {
@@ -36,3 +46,91 @@ func (s *UserService) Search(ctx context.Context, query string, limit int) ([]*d
 	}
 	return s.userRepo.Search(ctx, query, limit)
 }
+
+// List returns one page of users with their cards for the admin user list
+func (s *UserService) List(ctx context.Context, filter domain.UserFilter) ([]*UserOverview, int, error) {
+	switch filter.Status {
+	case "", domain.UserStatusActive, domain.UserStatusSuspended, domain.UserStatusFrozen:
+	default:
+		return nil, 0, domain.ErrValidation("無效的篩選條件")
+	}
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	filter.Query = strings.TrimSpace(filter.Query)
+
+	users, total, err := s.userRepo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	cards, err := s.cardRepo.FindByUserIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	byUser := make(map[string][]*domain.Card, len(users))
+	for _, c := range cards {
+		byUser[c.UserID] = append(byUser[c.UserID], c)
+	}
+
+	overviews := make([]*UserOverview, len(users))
+	for i, u := range users {
+		overviews[i] = &UserOverview{User: u, Cards: byUser[u.ID]}
+	}
+	return overviews, total, nil
+}
+
+func (s *UserService) GetOverview(ctx context.Context, id string) (*UserOverview, error) {
+	user, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := s.cardRepo.FindByUserID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &UserOverview{User: user, Cards: cards}, nil
+}
+
+// Suspend blocks the account from logging in, revokes all of its sessions and drops its
+// realtime connections
+func (s *UserService) Suspend(ctx context.Context, id, reason string) error {
+	err := s.uow.Do(ctx, func(repos *domain.Repositories) error {
+		if err := repos.Users.Suspend(ctx, id, strings.TrimSpace(reason)); err != nil {
+			return err
+		}
+		return repos.Sessions.RevokeAllByUser(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+	return s.sessionSvc.RevokeUser(ctx, id, "", domain.RevokeReasonAccountSuspended)
+}
+
+// Unsuspend lets a suspended account log in again. An account frozen before its suspension
+// stays frozen.
+func (s *UserService) Unsuspend(ctx context.Context, id string) error {
+	ok, err := s.userRepo.Unsuspend(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := s.userRepo.FindByID(ctx, id); err != nil {
+			return err
+		}
+		return domain.ErrConflict("帳號未停用")
+	}
+	return nil
+}
+
+// PurgeDeletedAccounts hard-deletes accounts whose deletion grace period is over
+func (s *UserService) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	return s.userRepo.PurgeDeleted(ctx)
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"link/internal/domain"
+)
+
+// flushBatch bounds how many queued messages are awaiting acknowledgement on one connection,
+// well under a client's send buffer
+const flushBatch = 50
+
+// flushState tracks the store-and-forward flush to one connection
+type flushState struct {
+	mu       sync.Mutex
+	after    *domain.MessageCursor // last message sent
+	inFlight map[string]struct{}   // sent but not yet acknowledged
+}
+
+type AckPayload struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// FlushUndelivered streams the messages that arrived while the user was offline to a newly
+// connected client, oldest first. Each batch goes out once the previous one is acknowledged.
+func (h *Handler) FlushUndelivered(ctx context.Context, c Client) {
+	h.flushMu.Lock()
+	state, ok := h.flushes[c]
+	if !ok {
+		// A connection that already left the hub has been forgotten, and must stay forgotten
+		if !h.hub.registered(c) {
+			h.flushMu.Unlock()
+			return
+		}
+		state = &flushState{inFlight: make(map[string]struct{})}
+		h.flushes[c] = state
+	}
+	h.flushMu.Unlock()
+
+	h.flushNext(ctx, c, state)
+}
+
+func (h *Handler) flushNext(ctx context.Context, c Client, state *flushState) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if len(state.inFlight) > 0 {
+		return
+	}
+
+	msgs, err := h.msgSvc.FindUndelivered(ctx, c.GetUserID(), state.after, flushBatch)
+	if err != nil {
+		slog.Error("failed to load undelivered messages", "user_id", c.GetUserID(), "err", err)
+		return
+	}
+	if len(msgs) == 0 {
+		h.Forget(c)
+		return
+	}
+
+	for _, m := range msgs {
+		// A full buffer means a dead or slow peer; whatever is left goes out on the next connect
+		if !c.SendStream(messageFrame(m)) {
+			slog.Warn("stopped flushing undelivered messages", "user_id", c.GetUserID(), "session_id", c.GetSessionID())
+			break
+		}
+		state.inFlight[m.ID] = struct{}{}
+		state.after = &domain.MessageCursor{CreatedAt: m.CreatedAt, ID: m.ID}
+	}
+	slog.Info("flushed undelivered messages", "user_id", c.GetUserID(), "count", len(state.inFlight))
+}
+
+// HandleAck records delivery of the acknowledged messages, tells their senders, and continues
+// the flush once the current batch is fully acknowledged
+func (h *Handler) HandleAck(ctx context.Context, c Client, payload json.RawMessage) {
+	var p AckPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return
+	}
+
+	for _, id := range p.MessageIDs {
+		msg, err := h.msgSvc.MarkDelivered(ctx, id, c.GetUserID())
+		if err != nil {
+			slog.Warn("failed to mark message delivered", "msg_id", id, "err", err)
+			continue
+		}
+		if msg != nil {
+			h.hub.Send(msg.SenderID, &Message{
+				Type:    TypeDelivered,
+				Payload: map[string]interface{}{"message": msg},
+			})
+		}
+	}
+
+	h.flushMu.Lock()
+	state, ok := h.flushes[c]
+	h.flushMu.Unlock()
+	if !ok {
+		return
+	}
+
+	state.mu.Lock()
+	for _, id := range p.MessageIDs {
+		delete(state.inFlight, id)
+	}
+	done := len(state.inFlight) == 0
+	state.mu.Unlock()
+	if done {
+		h.flushNext(ctx, c, state)
+	}
+}
+
+// Forget drops the flush state of a client that finished flushing or left the hub
+func (h *Handler) Forget(c Client) {
+	h.flushMu.Lock()
+	delete(h.flushes, c)
+	h.flushMu.Unlock()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"sync"
 
 	"link/internal/domain"
 	"link/internal/service"
@@ -13,10 +14,12 @@ type Handler struct {
 	hub     *Hub
 	msgSvc  *service.MessageService
 	convSvc *service.ConversationService
+	flushMu sync.Mutex
+	flushes map[Client]*flushState
 }
 
 func NewHandler(hub *Hub, msgSvc *service.MessageService, convSvc *service.ConversationService) *Handler {
-	return &Handler{hub: hub, msgSvc: msgSvc, convSvc: convSvc}
+	return &Handler{hub: hub, msgSvc: msgSvc, convSvc: convSvc, flushes: make(map[Client]*flushState)}
 }
 
 type SendMessagePayload struct {
@@ -36,56 +39,52 @@ func (h *Handler) HandleMessage(ctx context.Context, senderID string, payload js
 	}
 	slog.Info("Message parsed", "to", p.To, "temp_id", p.TempID)
 
-	slog.Info("Calling GetOrCreate conversation")
-	conv, err := h.convSvc.GetOrCreate(ctx, senderID, p.To)
-	if err != nil {
-		slog.Error("failed to get/create conversation", "err", err)
-		return
-	}
-	slog.Info("Conversation retrieved", "conv_id", conv.ID)
-
 	slog.Info("Calling msgSvc.Send")
-	msg, err := h.msgSvc.Send(ctx, senderID, conv.ID, p.EncryptedContent)
+	msg, created, err := h.msgSvc.Send(ctx, senderID, p.To, p.EncryptedContent, p.TempID)
 	if err != nil {
 		slog.Error("failed to send message", "err", err)
 		return
 	}
-	slog.Info("Message saved", "msg_id", msg.ID)
+	slog.Info("Message saved", "msg_id", msg.ID, "created", created)
 
-	outMsg := &Message{
-		Type: TypeMessage,
-		Payload: map[string]interface{}{
-			"id":                msg.ID,
-			"conversation_id":   conv.ID,
-			"sender_id":         senderID,
-			"encrypted_content": p.EncryptedContent,
-			"created_at":        msg.CreatedAt,
-		},
+	h.Deliver(ctx, msg, p.To, created)
+	slog.Info("HandleMessage completed")
+}
+
+// Deliver forwards a just-stored message to the recipient, if connected, and confirms it to the
+// sender with a delivered frame. Like a flushed message, it only counts as delivered once the
+// recipient acknowledges it, which sends the sender another delivered frame. A retried send is
+// only confirmed again: the recipient already got the original, or gets it from the flush on
+// their next connect. Returns the message with its delivery state.
+func (h *Handler) Deliver(ctx context.Context, msg *domain.Message, recipientID string, created bool) *domain.Message {
+	if created && h.hub.Send(recipientID, messageFrame(msg)) {
+		slog.Info("Message forwarded to recipient", "to", recipientID)
 	}
 
 	// Always send delivery confirmation back to sender with the saved message details
-	slog.Info("Sending delivery confirmation to sender", "sender_id", senderID, "temp_id", p.TempID)
-	delivered := h.hub.Send(senderID, &Message{
+	slog.Info("Sending delivery confirmation to sender", "sender_id", msg.SenderID, "temp_id", msg.TempID)
+	confirmed := h.hub.Send(msg.SenderID, &Message{
 		Type: TypeDelivered,
 		Payload: map[string]interface{}{
-			"temp_id": p.TempID,
-			"message": map[string]interface{}{
-				"id":                msg.ID,
-				"conversation_id":   conv.ID,
-				"sender_id":         senderID,
-				"encrypted_content": p.EncryptedContent,
-				"created_at":        msg.CreatedAt,
-			},
+			"temp_id": msg.TempID,
+			"message": msg,
 		},
 	})
-	slog.Info("Delivery confirmation sent", "success", delivered)
+	slog.Info("Delivery confirmation sent", "success", confirmed)
+	return msg
+}
 
-	// If recipient is online, send the message and mark as delivered
-	if h.hub.Send(p.To, outMsg) {
-		slog.Info("Message forwarded to recipient", "to", p.To)
-		_ = h.msgSvc.MarkDelivered(ctx, msg.ID)
+func messageFrame(msg *domain.Message) *Message {
+	return &Message{
+		Type: TypeMessage,
+		Payload: map[string]interface{}{
+			"id":                msg.ID,
+			"conversation_id":   msg.ConversationID,
+			"sender_id":         msg.SenderID,
+			"encrypted_content": msg.EncryptedContent,
+			"created_at":        msg.CreatedAt,
+		},
 	}
-	slog.Info("HandleMessage completed")
 }
 
 type ReadPayload struct {
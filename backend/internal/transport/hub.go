@@ -1,35 +1,49 @@
 package transport
 
 import (
+	"errors"
 	"log/slog"
 	"sync"
+
+	"link/internal/domain"
 )
 
 type Client interface {
 	GetUserID() string
+	GetSessionID() string
 	SendStream(msg *Message) bool
 	SendDatagram(msg *Message) bool
+	// CloseWith sends msg as the last frame before closing the connection
+	CloseWith(msg *Message)
 	Close()
 }
 
 type Hub struct {
-	clients      map[string]Client
+	// One client per session, so a user can be connected from several devices at once
+	clients map[string]map[string]Client
+	// Clients whose session is still being re-checked; they get no messages until admitted
+	pending      map[Client]struct{}
 	mu           sync.RWMutex
 	register     chan Client
 	unregister   chan Client
-	onConnect    func(userID string)
+	onConnect    func(c Client)
 	onDisconnect func(userID string)
+	onUnregister func(c Client)
+	checkSession func(sessionID string) error
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[string]Client),
+		clients:    make(map[string]map[string]Client),
+		pending:    make(map[Client]struct{}),
 		register:   make(chan Client, 256),
 		unregister: make(chan Client, 256),
 	}
 }
 
-func (h *Hub) SetOnConnect(fn func(userID string)) {
+// SetOnConnect registers fn to run for every new connection, including further devices of a user
+// who is already online
+func (h *Hub) SetOnConnect(fn func(c Client)) {
 	h.onConnect = fn
 }
 
@@ -37,43 +51,128 @@ func (h *Hub) SetOnDisconnect(fn func(userID string)) {
 	h.onDisconnect = fn
 }
 
+// SetOnUnregister registers fn to run for every connection that goes away, once it can no longer
+// be found in the hub. Unlike the other callbacks it runs on the hub's goroutine, so it must not block.
+func (h *Hub) SetOnUnregister(fn func(c Client)) {
+	h.onUnregister = fn
+}
+
+// SetSessionCheck registers fn to confirm that a new connection's session is still valid once the
+// connection is in the hub. A session revoked between the handshake and registration was missed by
+// RevokeUser and RevokeSession, so the check closes it with a security frame instead.
+func (h *Hub) SetSessionCheck(fn func(sessionID string) error) {
+	h.checkSession = fn
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
 		case c := <-h.register:
 			h.mu.Lock()
-			if old, ok := h.clients[c.GetUserID()]; ok {
+			sessions, ok := h.clients[c.GetUserID()]
+			if !ok {
+				sessions = make(map[string]Client)
+				h.clients[c.GetUserID()] = sessions
+			}
+			// A reconnect replaces the stale connection of the same session
+			if old, ok := sessions[c.GetSessionID()]; ok {
 				old.Close()
 			}
-			h.clients[c.GetUserID()] = c
-			h.mu.Unlock()
-			slog.Info("client connected", "user_id", c.GetUserID())
-			if h.onConnect != nil {
-				go h.onConnect(c.GetUserID())
+			sessions[c.GetSessionID()] = c
+			if h.checkSession != nil {
+				h.pending[c] = struct{}{}
 			}
+			h.mu.Unlock()
+			slog.Info("client connected", "user_id", c.GetUserID(), "session_id", c.GetSessionID())
+			go h.admit(c)
 
 		case c := <-h.unregister:
 			h.mu.Lock()
-			if curr, ok := h.clients[c.GetUserID()]; ok && curr == c {
-				delete(h.clients, c.GetUserID())
+			offline := false
+			delete(h.pending, c)
+			if sessions, ok := h.clients[c.GetUserID()]; ok {
+				if curr, ok := sessions[c.GetSessionID()]; ok && curr == c {
+					delete(sessions, c.GetSessionID())
+				}
+				if len(sessions) == 0 {
+					delete(h.clients, c.GetUserID())
+					offline = true
+				}
 			}
 			h.mu.Unlock()
-			slog.Info("client disconnected", "user_id", c.GetUserID())
-			if h.onDisconnect != nil {
+			slog.Info("client disconnected", "user_id", c.GetUserID(), "session_id", c.GetSessionID())
+			if h.onUnregister != nil {
+				h.onUnregister(c)
+			}
+			// Presence only changes when the user's last connection goes away
+			if offline && h.onDisconnect != nil {
 				go h.onDisconnect(c.GetUserID())
 			}
 		}
 	}
 }
 
-func (h *Hub) Send(userID string, msg *Message) bool {
+// admit re-checks the session of a just registered client. It is already in the hub, so a
+// revocation either committed before the check and fails it, or finds the client and closes it.
+func (h *Hub) admit(c Client) {
+	if h.checkSession != nil {
+		if err := h.checkSession(c.GetSessionID()); err != nil {
+			slog.Info("closing client of revoked session", "user_id", c.GetUserID(), "session_id", c.GetSessionID(), "error", err)
+			c.CloseWith(securityMessage(revokeReason(err)))
+			return
+		}
+		h.mu.Lock()
+		delete(h.pending, c)
+		h.mu.Unlock()
+	}
+	if h.onConnect != nil {
+		h.onConnect(c)
+	}
+}
+
+// revokeReason tells a client turned away by the session check why
+func revokeReason(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrAccountSuspended):
+		return domain.RevokeReasonAccountSuspended
+	case errors.Is(err, domain.ErrAccountFrozen):
+		return domain.RevokeReasonAccountFrozen
+	}
+	return domain.RevokeReasonSignedOut
+}
+
+// registered reports whether c is the current connection of its session
+func (h *Hub) registered(c Client) bool {
 	h.mu.RLock()
-	c, ok := h.clients[userID]
-	h.mu.RUnlock()
-	if !ok {
-		return false
+	defer h.mu.RUnlock()
+	return h.clients[c.GetUserID()][c.GetSessionID()] == c
+}
+
+// userClients returns a snapshot of the user's connected clients. Clients still pending admission
+// are left out unless withPending, which revocations set so they cannot miss one.
+func (h *Hub) userClients(userID string, withPending bool) []Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	sessions := h.clients[userID]
+	clients := make([]Client, 0, len(sessions))
+	for _, c := range sessions {
+		if _, ok := h.pending[c]; ok && !withPending {
+			continue
+		}
+		clients = append(clients, c)
 	}
-	return c.SendStream(msg)
+	return clients
+}
+
+// Send delivers msg to every connection of the user and reports whether any of them took it
+func (h *Hub) Send(userID string, msg *Message) bool {
+	sent := false
+	for _, c := range h.userClients(userID, false) {
+		if c.SendStream(msg) {
+			sent = true
+		}
+	}
+	return sent
 }
 
 // SendTyped implements the Notifier interface for HTTP handlers
@@ -82,20 +181,72 @@ func (h *Hub) SendTyped(userID string, msgType string, payload interface{}) bool
 }
 
 func (h *Hub) SendDatagram(userID string, msg *Message) bool {
-	h.mu.RLock()
-	c, ok := h.clients[userID]
-	h.mu.RUnlock()
-	if !ok {
-		return false
+	sent := false
+	for _, c := range h.userClients(userID, false) {
+		if c.SendDatagram(msg) {
+			sent = true
+		}
 	}
-	return c.SendDatagram(msg)
+	return sent
 }
 
 func (h *Hub) IsOnline(userID string) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	_, ok := h.clients[userID]
-	return ok
+	return len(h.clients[userID]) > 0
+}
+
+// findSession returns the client authenticated with the given session, if any
+func (h *Hub) findSession(sessionID string) Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sessions := range h.clients {
+		if c, ok := sessions[sessionID]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// CloseUser disconnects every client of the user
+func (h *Hub) CloseUser(userID string) bool {
+	clients := h.userClients(userID, true)
+	if len(clients) == 0 {
+		return false
+	}
+	slog.Info("closing clients by request", "user_id", userID, "count", len(clients))
+	for _, c := range clients {
+		c.Close()
+	}
+	return true
+}
+
+// RevokeSession sends a security frame to the client of the given session, then disconnects it
+func (h *Hub) RevokeSession(sessionID, reason string) bool {
+	target := h.findSession(sessionID)
+	if target == nil {
+		return false
+	}
+	slog.Info("revoking client", "user_id", target.GetUserID(), "session_id", sessionID, "reason", reason)
+	target.CloseWith(securityMessage(reason))
+	return true
+}
+
+// RevokeUser sends a security frame to every client of the user except the one of keepSessionID,
+// then disconnects them. It returns how many clients were closed.
+func (h *Hub) RevokeUser(userID, keepSessionID, reason string) int {
+	closed := 0
+	for _, c := range h.userClients(userID, true) {
+		if c.GetSessionID() == keepSessionID {
+			continue
+		}
+		c.CloseWith(securityMessage(reason))
+		closed++
+	}
+	if closed > 0 {
+		slog.Info("revoked clients", "user_id", userID, "count", closed, "reason", reason)
+	}
+	return closed
 }
 
 func (h *Hub) Register(c Client)   { h.register <- c }
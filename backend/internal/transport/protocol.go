@@ -8,10 +8,24 @@ const (
 	TypeRead      = "read"
 	TypeOnline    = "online"
 	TypeOffline   = "offline"
+	TypeKeyChange = "key_changed"
 	TypeError     = "error"
+	TypeSecurity  = "security"
+	TypeAck       = "ack" // client to server: these messages arrived
 )
 
 type Message struct {
 	Type    string      `json:"t"`
 	Payload interface{} `json:"p,omitempty"`
 }
+
+// SecurityEvent is the payload of a security frame, with one of the domain.RevokeReason values.
+// It is the last frame a connection gets before the server closes it; clients should wipe their
+// cached keys and messages and sign out.
+type SecurityEvent struct {
+	Reason string `json:"reason"`
+}
+
+func securityMessage(reason string) *Message {
+	return &Message{Type: TypeSecurity, Payload: SecurityEvent{Reason: reason}}
+}
@@ -5,20 +5,27 @@ import (
 	"log/slog"
 	"strings"
 
+	"link/internal/domain"
 	"link/internal/pkg/token"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
+// SessionAuthenticator checks a token and the server-side session behind it
+type SessionAuthenticator interface {
+	Authenticate(ctx context.Context, tokenStr string) (*token.Claims, *domain.Session, error)
+	Touch(ctx context.Context, session *domain.Session, client domain.ClientInfo) error
+}
+
 type Server struct {
-	hub      *Hub
-	handler  *Handler
-	tokenMgr *token.Manager
+	hub     *Hub
+	handler *Handler
+	auth    SessionAuthenticator
 }
 
-func NewServer(hub *Hub, handler *Handler, tokenMgr *token.Manager) *Server {
-	return &Server{hub: hub, handler: handler, tokenMgr: tokenMgr}
+func NewServer(hub *Hub, handler *Handler, auth SessionAuthenticator) *Server {
+	return &Server{hub: hub, handler: handler, auth: auth}
 }
 
 func (s *Server) SetupRoutes(app *fiber.App) {
@@ -39,16 +46,21 @@ func (s *Server) SetupRoutes(app *fiber.App) {
 			auth = strings.TrimPrefix(auth, "Bearer ")
 		}
 
-		claims, err := s.tokenMgr.Verify(auth)
+		claims, session, err := s.auth.Authenticate(context.Background(), auth)
 		if err != nil {
 			slog.Warn("WebSocket auth failed", "error", err)
 			c.Close()
 			return
 		}
 
+		client := domain.NewClientInfo(c.IP(), c.Headers(fiber.HeaderUserAgent))
+		if err := s.auth.Touch(context.Background(), session, client); err != nil {
+			slog.Warn("failed to record session use", "session_id", session.ID, "error", err)
+		}
+
 		slog.Info("WebSocket authenticated", "user_id", claims.UserID)
-		client := NewWSClient(claims.UserID, c, s.hub, s.handler)
-		s.hub.Register(client)
-		client.Run(context.Background())
+		wsClient := NewWSClient(claims.UserID, session.ID, c, s.hub, s.handler)
+		s.hub.Register(wsClient)
+		wsClient.Run(context.Background())
 	}))
 }
@@ -11,25 +11,34 @@ import (
 )
 
 type WSClient struct {
-	userID  string
-	conn    *websocket.Conn
-	hub     *Hub
-	handler *Handler
-	send    chan []byte
-	mu      sync.Mutex
+	userID    string
+	sessionID string
+	conn      *websocket.Conn
+	hub       *Hub
+	handler   *Handler
+	send      chan []byte
+	final     chan []byte // last frame before a server-initiated close
+	finalOnce sync.Once
+	mu        sync.Mutex
 }
 
-func NewWSClient(userID string, conn *websocket.Conn, hub *Hub, handler *Handler) *WSClient {
+// writeWait bounds a single write, and how long CloseWith waits for its frame to go out
+const writeWait = 10 * time.Second
+
+func NewWSClient(userID, sessionID string, conn *websocket.Conn, hub *Hub, handler *Handler) *WSClient {
 	return &WSClient{
-		userID:  userID,
-		conn:    conn,
-		hub:     hub,
-		handler: handler,
-		send:    make(chan []byte, 256),
+		userID:    userID,
+		sessionID: sessionID,
+		conn:      conn,
+		hub:       hub,
+		handler:   handler,
+		send:      make(chan []byte, 256),
+		final:     make(chan []byte, 1),
 	}
 }
 
-func (c *WSClient) GetUserID() string { return c.userID }
+func (c *WSClient) GetUserID() string    { return c.userID }
+func (c *WSClient) GetSessionID() string { return c.sessionID }
 
 func (c *WSClient) SendStream(msg *Message) bool {
 	data, err := json.Marshal(msg)
@@ -52,6 +61,21 @@ func (c *WSClient) SendDatagram(msg *Message) bool {
 	return c.SendStream(msg)
 }
 
+// CloseWith hands msg to the write pump, which sends it ahead of anything still queued and then closes
+func (c *WSClient) CloseWith(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("failed to marshal message", "err", err)
+		c.Close()
+		return
+	}
+	c.finalOnce.Do(func() {
+		c.final <- data
+		// The write pump may be stuck on a dead peer; don't wait for it forever
+		time.AfterFunc(writeWait, c.Close)
+	})
+}
+
 func (c *WSClient) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -95,6 +119,8 @@ func (c *WSClient) readPump(ctx context.Context) {
 			c.handler.HandleMessage(ctx, c.userID, msg.Payload)
 		case TypeRead:
 			c.handler.HandleRead(ctx, c.userID, msg.Payload)
+		case TypeAck:
+			c.handler.HandleAck(ctx, c, msg.Payload)
 		case TypeTyping:
 			var p struct {
 				To             string `json:"to"`
@@ -119,8 +145,18 @@ func (c *WSClient) writePump() {
 
 	for {
 		select {
+		case msg := <-c.final:
+			c.writeFinal(msg)
+			return
 		case msg, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			// Nothing queued may reach the peer once a closing frame is pending
+			select {
+			case final := <-c.final:
+				c.writeFinal(final)
+				return
+			default:
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -132,10 +168,19 @@ func (c *WSClient) writePump() {
 			}
 			slog.Info("writePump: message written successfully")
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
+
+func (c *WSClient) writeFinal(msg []byte) {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		slog.Error("ws write error", "err", err)
+		return
+	}
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ""))
+}
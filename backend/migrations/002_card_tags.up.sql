@@ -0,0 +1,10 @@
+-- NTAG 424 DNA chips bound to card tokens; last_counter guards against SUN replay
+CREATE TABLE card_tags (
+    uid             VARCHAR(14) PRIMARY KEY,
+    card_token      VARCHAR(32) UNIQUE NOT NULL,
+    last_counter    INTEGER,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER trg_card_tags_updated BEFORE UPDATE ON card_tags FOR EACH ROW EXECUTE FUNCTION update_timestamp();
@@ -0,0 +1,2 @@
+ALTER TABLE cards DROP COLUMN IF EXISTS key_version;
+ALTER TABLE card_tags DROP COLUMN IF EXISTS key_version;
@@ -0,0 +1,4 @@
+-- SUN master key version each chip was personalized with (AN10922 diversification)
+ALTER TABLE card_tags ADD COLUMN key_version SMALLINT NOT NULL DEFAULT 1;
+-- Copied from card_tags at registration; NULL for cards without an NTAG 424 DNA chip
+ALTER TABLE cards ADD COLUMN key_version SMALLINT;
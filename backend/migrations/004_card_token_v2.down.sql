@@ -0,0 +1,4 @@
+ALTER TABLE card_tags ALTER COLUMN card_token TYPE VARCHAR(32);
+ALTER TABLE card_pairs ALTER COLUMN backup_token TYPE VARCHAR(32);
+ALTER TABLE card_pairs ALTER COLUMN primary_token TYPE VARCHAR(32);
+ALTER TABLE cards ALTER COLUMN card_token TYPE VARCHAR(32);
@@ -0,0 +1,5 @@
+-- v2 card tokens (v2.{kid}.{pairID}.{type}.{mac}) no longer fit in 32 characters
+ALTER TABLE cards ALTER COLUMN card_token TYPE VARCHAR(96);
+ALTER TABLE card_pairs ALTER COLUMN primary_token TYPE VARCHAR(96);
+ALTER TABLE card_pairs ALTER COLUMN backup_token TYPE VARCHAR(96);
+ALTER TABLE card_tags ALTER COLUMN card_token TYPE VARCHAR(96);
@@ -0,0 +1,11 @@
+-- Refresh tokens rotate on every use; all tokens of one session form a family.
+-- A token presented again after used_at is set revokes the whole session.
+CREATE TABLE refresh_tokens (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    token_hash      VARCHAR(64) UNIQUE NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    used_at         TIMESTAMPTZ
+);
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
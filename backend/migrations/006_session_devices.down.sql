@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_sessions_user_active;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE sessions DROP COLUMN IF EXISTS ip;
@@ -0,0 +1,5 @@
+ALTER TABLE sessions ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX idx_sessions_user_active ON sessions(user_id, last_used_at DESC) WHERE revoked_at IS NULL;
@@ -0,0 +1,8 @@
+CREATE TABLE card_events (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    card_id         UUID NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    event           VARCHAR(20) NOT NULL CHECK (event IN ('registered', 'revoked', 'promoted', 'backup_bound')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_card_events_user ON card_events(user_id, created_at);
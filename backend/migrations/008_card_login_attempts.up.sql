@@ -0,0 +1,7 @@
+CREATE TABLE card_login_attempts (
+    card_id         UUID PRIMARY KEY REFERENCES cards(id) ON DELETE CASCADE,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    unreported      INTEGER NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMPTZ,
+    last_failed_at  TIMESTAMPTZ
+);
@@ -0,0 +1,9 @@
+CREATE OR REPLACE FUNCTION cleanup_expired_pairs()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM card_pairs WHERE expires_at < NOW();
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS registered_by;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS registered_at;
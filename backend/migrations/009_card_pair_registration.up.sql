@@ -0,0 +1,10 @@
+ALTER TABLE card_pairs ADD COLUMN registered_at TIMESTAMPTZ;
+ALTER TABLE card_pairs ADD COLUMN registered_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Registered pairs are the issuance record and must outlive their registration window
+CREATE OR REPLACE FUNCTION cleanup_expired_pairs()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM card_pairs WHERE expires_at < NOW() AND registered_at IS NULL;
+END;
+$$ LANGUAGE plpgsql;
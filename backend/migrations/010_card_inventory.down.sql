@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION cleanup_expired_pairs()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM card_pairs WHERE expires_at < NOW() AND registered_at IS NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_card_pairs_batch;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS shipped_at;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS issued_to;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS issued_at;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS serial_number;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS batch_id;
+ALTER TABLE card_pairs DROP COLUMN IF EXISTS status;
@@ -0,0 +1,23 @@
+-- Card pairs double as the physical card inventory:
+-- manufactured -> issued -> registered, with lost/revoked as terminal states
+ALTER TABLE card_pairs ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'issued'
+    CHECK (status IN ('manufactured', 'issued', 'registered', 'lost', 'revoked'));
+ALTER TABLE card_pairs ADD COLUMN batch_id VARCHAR(64);
+ALTER TABLE card_pairs ADD COLUMN serial_number VARCHAR(32) UNIQUE;
+ALTER TABLE card_pairs ADD COLUMN issued_at TIMESTAMPTZ;
+ALTER TABLE card_pairs ADD COLUMN issued_to VARCHAR(255);
+ALTER TABLE card_pairs ADD COLUMN shipped_at TIMESTAMPTZ;
+ALTER TABLE card_pairs ADD COLUMN status_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE card_pairs SET issued_at = created_at;
+UPDATE card_pairs SET status = 'registered', status_changed_at = registered_at WHERE registered_at IS NOT NULL;
+
+CREATE INDEX idx_card_pairs_batch ON card_pairs(batch_id) WHERE batch_id IS NOT NULL;
+
+-- Only ad-hoc pairs whose registration window lapsed are removed; batch inventory is kept
+CREATE OR REPLACE FUNCTION cleanup_expired_pairs()
+RETURNS void AS $$
+BEGIN
+    DELETE FROM card_pairs WHERE expires_at < NOW() AND status = 'issued' AND batch_id IS NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS admin_audit_log;
+DROP FUNCTION IF EXISTS admin_audit_log_immutable();
+DROP TABLE IF EXISTS admin_sessions;
+DROP TABLE IF EXISTS admin_users;
@@ -0,0 +1,57 @@
+CREATE TABLE admin_users (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    username        VARCHAR(50) NOT NULL UNIQUE,
+    password_hash   TEXT NOT NULL,
+    role            VARCHAR(20) NOT NULL CHECK (role IN ('card_operator', 'support', 'superadmin')),
+    totp_secret     TEXT,
+    totp_enabled    BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step  BIGINT NOT NULL DEFAULT 0,
+    disabled_at     TIMESTAMPTZ,
+    last_login_at   TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TRIGGER trg_admin_users_updated BEFORE UPDATE ON admin_users FOR EACH ROW EXECUTE FUNCTION update_timestamp();
+
+CREATE TABLE admin_sessions (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    admin_id        UUID NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    token_hash      VARCHAR(64) NOT NULL UNIQUE,
+    ip              VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    revoked_at      TIMESTAMPTZ
+);
+CREATE INDEX idx_admin_sessions_admin ON admin_sessions(admin_id) WHERE revoked_at IS NULL;
+
+-- Admin accounts are never deleted, only disabled, so the audit log keeps its actor
+CREATE TABLE admin_audit_log (
+    id              BIGSERIAL PRIMARY KEY,
+    admin_id        UUID REFERENCES admin_users(id),
+    username        VARCHAR(50) NOT NULL DEFAULT '',
+    action          VARCHAR(100) NOT NULL,
+    target          TEXT NOT NULL DEFAULT '',
+    status          INTEGER NOT NULL DEFAULT 0,
+    ip              VARCHAR(45) NOT NULL DEFAULT '',
+    detail          JSONB,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_admin_audit_log_admin ON admin_audit_log(admin_id, created_at DESC);
+CREATE INDEX idx_admin_audit_log_created ON admin_audit_log(created_at DESC);
+
+-- Append-only: rows can be inserted but never changed or removed
+CREATE OR REPLACE FUNCTION admin_audit_log_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'admin_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_admin_audit_log_no_update
+    BEFORE UPDATE OR DELETE ON admin_audit_log
+    FOR EACH ROW EXECUTE FUNCTION admin_audit_log_immutable();
+
+CREATE TRIGGER trg_admin_audit_log_no_truncate
+    BEFORE TRUNCATE ON admin_audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION admin_audit_log_immutable();
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended'));
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN suspend_reason TEXT;
+
+CREATE INDEX idx_users_suspended ON users(suspended_at) WHERE status = 'suspended';
@@ -0,0 +1,6 @@
+-- Accounts scheduled for deletion are purged with everything that cascades from users
+-- once delete_after passes; logging in before then cancels the deletion
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN delete_after TIMESTAMPTZ;
+
+CREATE INDEX idx_users_delete_after ON users(delete_after) WHERE delete_after IS NOT NULL;
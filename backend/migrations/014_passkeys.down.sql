@@ -0,0 +1,9 @@
+DELETE FROM card_events WHERE passkey_id IS NOT NULL;
+ALTER TABLE card_events DROP CONSTRAINT IF EXISTS card_events_event_check;
+ALTER TABLE card_events ADD CONSTRAINT card_events_event_check CHECK (event IN ('registered', 'revoked', 'promoted', 'backup_bound'));
+ALTER TABLE card_events DROP CONSTRAINT IF EXISTS card_events_subject_check;
+ALTER TABLE card_events DROP COLUMN IF EXISTS passkey_id;
+ALTER TABLE card_events ALTER COLUMN card_id SET NOT NULL;
+
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS passkeys;
@@ -0,0 +1,35 @@
+-- WebAuthn credentials that can stand in for the primary card at login
+CREATE TABLE passkeys (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id   BYTEA NOT NULL UNIQUE,
+    public_key      BYTEA NOT NULL,
+    sign_count      BIGINT NOT NULL DEFAULT 0,
+    aaguid          BYTEA,
+    name            VARCHAR(50) NOT NULL DEFAULT '',
+    status          VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'revoked')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at    TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ
+);
+CREATE INDEX idx_passkeys_user ON passkeys(user_id);
+
+-- One row per started ceremony, deleted when it is answered so a challenge is used at most once
+CREATE TABLE webauthn_challenges (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id         UUID REFERENCES users(id) ON DELETE CASCADE,
+    purpose         VARCHAR(10) NOT NULL CHECK (purpose IN ('register', 'login')),
+    challenge       BYTEA NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_webauthn_challenges_expires ON webauthn_challenges(expires_at);
+
+-- Card history also records passkey registrations, uses and revocations
+ALTER TABLE card_events ALTER COLUMN card_id DROP NOT NULL;
+ALTER TABLE card_events ADD COLUMN passkey_id UUID REFERENCES passkeys(id) ON DELETE CASCADE;
+ALTER TABLE card_events ADD CONSTRAINT card_events_subject_check CHECK ((card_id IS NULL) <> (passkey_id IS NULL));
+ALTER TABLE card_events DROP CONSTRAINT card_events_event_check;
+ALTER TABLE card_events ADD CONSTRAINT card_events_event_check CHECK (event IN (
+    'registered', 'revoked', 'promoted', 'backup_bound',
+    'passkey_registered', 'passkey_used', 'passkey_revoked'
+));
@@ -0,0 +1,12 @@
+DELETE FROM card_events WHERE event IN ('account_frozen', 'account_unfrozen');
+ALTER TABLE card_events DROP CONSTRAINT IF EXISTS card_events_event_check;
+ALTER TABLE card_events ADD CONSTRAINT card_events_event_check CHECK (event IN (
+    'registered', 'revoked', 'promoted', 'backup_bound',
+    'passkey_registered', 'passkey_used', 'passkey_revoked'
+));
+
+UPDATE users SET status = 'active' WHERE status = 'frozen';
+ALTER TABLE users DROP COLUMN IF EXISTS unfreeze_before;
+ALTER TABLE users DROP COLUMN IF EXISTS frozen_at;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended'));
@@ -0,0 +1,13 @@
+-- A frozen account refuses logins and realtime connections until its owner unfreezes it
+-- with the primary card before unfreeze_before, or revokes the primary card with the backup card
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'frozen'));
+ALTER TABLE users ADD COLUMN frozen_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN unfreeze_before TIMESTAMPTZ;
+
+ALTER TABLE card_events DROP CONSTRAINT card_events_event_check;
+ALTER TABLE card_events ADD CONSTRAINT card_events_event_check CHECK (event IN (
+    'registered', 'revoked', 'promoted', 'backup_bound',
+    'passkey_registered', 'passkey_used', 'passkey_revoked',
+    'account_frozen', 'account_unfrozen'
+));
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_messages_conversation;
+CREATE INDEX idx_messages_conversation ON messages(conversation_id, created_at DESC);
+
+DROP TABLE IF EXISTS message_deletions;
+
+DROP TRIGGER IF EXISTS trg_messages_seq ON messages;
+DROP TRIGGER IF EXISTS trg_conversations_seq ON conversations;
+DROP FUNCTION IF EXISTS bump_sync_seq();
+
+ALTER TABLE messages DROP COLUMN IF EXISTS seq;
+ALTER TABLE conversations DROP COLUMN IF EXISTS seq;
+DROP SEQUENCE IF EXISTS sync_seq;
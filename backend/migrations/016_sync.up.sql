@@ -0,0 +1,33 @@
+-- Every insert or update of a conversation or message takes the next value of sync_seq, and
+-- deleted messages leave a tombstone, so clients can fetch what changed after a known position.
+-- A seq only becomes visible when its transaction commits, which need not be in seq order;
+-- 019 makes sync account for that.
+CREATE SEQUENCE sync_seq;
+
+ALTER TABLE conversations ADD COLUMN seq BIGINT NOT NULL DEFAULT nextval('sync_seq');
+ALTER TABLE messages ADD COLUMN seq BIGINT NOT NULL DEFAULT nextval('sync_seq');
+
+CREATE OR REPLACE FUNCTION bump_sync_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.seq = nextval('sync_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_conversations_seq BEFORE UPDATE ON conversations FOR EACH ROW EXECUTE FUNCTION bump_sync_seq();
+CREATE TRIGGER trg_messages_seq BEFORE UPDATE ON messages FOR EACH ROW EXECUTE FUNCTION bump_sync_seq();
+
+CREATE INDEX idx_conversations_seq ON conversations(seq);
+CREATE INDEX idx_messages_seq ON messages(seq);
+
+CREATE TABLE message_deletions (
+    seq             BIGINT PRIMARY KEY DEFAULT nextval('sync_seq'),
+    message_id      UUID NOT NULL,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    deleted_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Message pages are keyed by (created_at, id) so messages sharing a timestamp keep a stable order
+DROP INDEX IF EXISTS idx_messages_conversation;
+CREATE INDEX idx_messages_conversation ON messages(conversation_id, created_at, id);
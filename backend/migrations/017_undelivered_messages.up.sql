@@ -0,0 +1,2 @@
+-- Messages still waiting for their recipient are flushed when the recipient reconnects
+CREATE INDEX idx_messages_undelivered ON messages(conversation_id, created_at, id) WHERE delivered_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_sender_temp_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS temp_id;
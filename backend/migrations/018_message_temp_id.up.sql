@@ -0,0 +1,4 @@
+-- Clients tag every send with their own temp_id, so a retried send finds the original message
+-- instead of storing it twice
+ALTER TABLE messages ADD COLUMN temp_id VARCHAR(64);
+CREATE UNIQUE INDEX idx_messages_sender_temp_id ON messages(sender_id, temp_id) WHERE temp_id IS NOT NULL;
@@ -0,0 +1,21 @@
+DROP TRIGGER IF EXISTS trg_conversations_deletion ON conversations;
+DROP FUNCTION IF EXISTS record_conversation_deletion();
+DROP TABLE IF EXISTS conversation_deletions;
+
+DROP INDEX IF EXISTS idx_message_deletions_sync;
+DROP INDEX IF EXISTS idx_messages_sync;
+DROP INDEX IF EXISTS idx_conversations_sync;
+CREATE INDEX idx_conversations_seq ON conversations(seq);
+CREATE INDEX idx_messages_seq ON messages(seq);
+
+CREATE OR REPLACE FUNCTION bump_sync_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.seq = nextval('sync_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE message_deletions DROP COLUMN IF EXISTS sync_xid;
+ALTER TABLE messages DROP COLUMN IF EXISTS sync_xid;
+ALTER TABLE conversations DROP COLUMN IF EXISTS sync_xid;
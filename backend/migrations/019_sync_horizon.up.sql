@@ -0,0 +1,48 @@
+-- sync_seq values are taken when a row is written but become visible when its transaction commits,
+-- so a sync could hand out a cursor past a lower seq that commits later. Every change now also
+-- records the transaction that made it, and sync orders changes by (sync_xid, seq) and only reads
+-- below the oldest transaction still running: nothing can commit there any more.
+ALTER TABLE conversations ADD COLUMN sync_xid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE conversations ALTER COLUMN sync_xid SET DEFAULT pg_current_xact_id()::text::bigint;
+ALTER TABLE messages ADD COLUMN sync_xid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE messages ALTER COLUMN sync_xid SET DEFAULT pg_current_xact_id()::text::bigint;
+ALTER TABLE message_deletions ADD COLUMN sync_xid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE message_deletions ALTER COLUMN sync_xid SET DEFAULT pg_current_xact_id()::text::bigint;
+
+CREATE OR REPLACE FUNCTION bump_sync_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_xid = pg_current_xact_id()::text::bigint;
+    NEW.seq = nextval('sync_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_conversations_seq;
+DROP INDEX IF EXISTS idx_messages_seq;
+CREATE INDEX idx_conversations_sync ON conversations(sync_xid, seq);
+CREATE INDEX idx_messages_sync ON messages(sync_xid, seq);
+CREATE INDEX idx_message_deletions_sync ON message_deletions(sync_xid, seq);
+
+-- A conversation goes away with either participant's account, and its peer learns it from sync
+CREATE TABLE conversation_deletions (
+    seq             BIGINT PRIMARY KEY DEFAULT nextval('sync_seq'),
+    sync_xid        BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint,
+    conversation_id UUID NOT NULL,
+    participant_1   UUID NOT NULL,
+    participant_2   UUID NOT NULL,
+    deleted_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_conversation_deletions_sync ON conversation_deletions(sync_xid, seq);
+
+CREATE OR REPLACE FUNCTION record_conversation_deletion()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO conversation_deletions (conversation_id, participant_1, participant_2)
+    VALUES (OLD.id, OLD.participant_1, OLD.participant_2);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_conversations_deletion AFTER DELETE ON conversations FOR EACH ROW EXECUTE FUNCTION record_conversation_deletion();
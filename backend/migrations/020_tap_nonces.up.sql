@@ -0,0 +1,10 @@
+-- A verified SUN tap hands the browser a short-lived, single-use nonce. Cards with a chip need it
+-- to log in, since their printed token is static and anyone who once saw the URL could replay it.
+CREATE TABLE card_tap_nonces (
+    nonce_hash      VARCHAR(64) PRIMARY KEY,
+    card_token      VARCHAR(96) NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_card_tap_nonces_token ON card_tap_nonces(card_token);
+CREATE INDEX idx_card_tap_nonces_expires ON card_tap_nonces(expires_at);
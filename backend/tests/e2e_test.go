@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"link/internal/pkg/cardtoken"
+	"link/internal/pkg/totp"
 )
 
 const baseURL = "https://localhost:8443"
@@ -24,6 +27,25 @@ var client = &http.Client{
 	},
 }
 
+// Registration only accepts pairs issued through the admin API. The test admin is the
+// bootstrap superadmin; set ADMIN_TOTP_SECRET once it has enrolled TOTP, or run the
+// server with ADMIN_REQUIRE_TOTP=false.
+var (
+	adminUsername   = envOr("ADMIN_USERNAME", "admin")
+	adminPassword   = os.Getenv("ADMIN_PASSWORD")
+	adminTOTPSecret = os.Getenv("ADMIN_TOTP_SECRET")
+
+	adminTokenOnce sync.Once
+	adminToken     string
+)
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 type apiResponse struct {
 	Data  json.RawMessage `json:"data,omitempty"`
 	Error *struct {
@@ -96,6 +118,59 @@ func doRequestWithToken(t *testing.T, method, path string, body interface{}, tok
 	return result
 }
 
+// loginAdmin 以管理員帳號登入一次，之後的測試共用同一個 admin session
+func loginAdmin(t *testing.T) string {
+	adminTokenOnce.Do(func() {
+		body := map[string]string{"username": adminUsername, "password": adminPassword}
+		if adminTOTPSecret != "" {
+			code, err := totp.Code(adminTOTPSecret, totp.Step(time.Now()))
+			if err != nil {
+				t.Fatalf("invalid ADMIN_TOTP_SECRET: %v", err)
+			}
+			body["totp_code"] = code
+		}
+
+		resp := doRequest(t, "POST", "/api/v1/admin/login", body)
+		var data struct {
+			Token string `json:"token"`
+		}
+		if resp.Error != nil || json.Unmarshal(resp.Data, &data) != nil {
+			t.Fatalf("admin login failed: %+v, are ADMIN_PASSWORD and ADMIN_TOTP_SECRET set?", resp.Error)
+		}
+		adminToken = data.Token
+	})
+	if adminToken == "" {
+		t.Fatal("admin login failed in an earlier test")
+	}
+	return adminToken
+}
+
+// issuePair 透過管理 API 發行一組卡片
+func issuePair(t *testing.T) (string, string) {
+	req, err := http.NewRequest("POST", baseURL+"/api/v1/admin/cards/generate", nil)
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	req.Header.Set("X-Admin-Token", loginAdmin(t))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			PrimaryToken string `json:"primary_token"`
+			BackupToken  string `json:"backup_token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Data.PrimaryToken == "" {
+		t.Fatalf("issue pair failed (status %d), has the admin enrolled TOTP?", resp.StatusCode)
+	}
+	return result.Data.PrimaryToken, result.Data.BackupToken
+}
+
 // TestHealthEndpoint 測試健康檢查端點
 func TestHealthEndpoint(t *testing.T) {
 	resp, err := client.Get(baseURL + "/health")
@@ -136,10 +211,7 @@ func TestCheckCard_InvalidToken(t *testing.T) {
 
 // TestCheckCard_ValidToken 測試檢查有效格式的卡片
 func TestCheckCard_ValidToken(t *testing.T) {
-	primary, _, err := cardTokenGen.GeneratePair()
-	if err != nil {
-		t.Fatalf("generate pair: %v", err)
-	}
+	primary, _ := issuePair(t)
 
 	result := doRequest(t, "GET", "/api/v1/auth/check-card/"+primary, nil)
 
@@ -159,17 +231,43 @@ func TestCheckCard_ValidToken(t *testing.T) {
 	}
 }
 
-// TestDualCardRegistrationFlow 測試雙卡註冊流程
-func TestDualCardRegistrationFlow(t *testing.T) {
-	// 等待避免觸發 rate limiting
+// TestUnissuedPairCannotRegister 測試未經發行的卡片（簽章有效）無法註冊
+func TestUnissuedPairCannotRegister(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
-	// 使用 cardtoken generator 產生配對的 tokens
 	primaryToken, backupToken, err := cardTokenGen.GeneratePair()
 	if err != nil {
 		t.Fatalf("generate pair: %v", err)
 	}
 
+	check := doRequest(t, "GET", "/api/v1/auth/check-card/"+primaryToken, nil)
+	var data struct {
+		Status string `json:"status"`
+	}
+	_ = json.Unmarshal(check.Data, &data)
+	if data.Status != "not_issued" {
+		t.Errorf("expected status 'not_issued', got '%s'", data.Status)
+	}
+
+	result := doRequest(t, "POST", "/api/v1/auth/register", map[string]string{
+		"primary_token": primaryToken,
+		"backup_token":  backupToken,
+		"password":      "testpassword123",
+		"nickname":      "未發行",
+		"public_key":    "abcd1234567890abcd1234567890abcd1234567890abcd1234567890abcd1234",
+	})
+	if result.Error == nil {
+		t.Error("expected registration with an unissued pair to fail")
+	}
+}
+
+// TestDualCardRegistrationFlow 測試雙卡註冊流程
+func TestDualCardRegistrationFlow(t *testing.T) {
+	// 等待避免觸發 rate limiting
+	time.Sleep(2 * time.Second)
+
+	primaryToken, backupToken := issuePair(t)
+
 	t.Logf("Primary token: %s", primaryToken)
 	t.Logf("Backup token: %s", backupToken)
 
@@ -341,10 +439,7 @@ func TestRegisterWithMismatchedTokens(t *testing.T) {
 func TestBackupCardRevocation(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
-	primaryToken, backupToken, err := cardTokenGen.GeneratePair()
-	if err != nil {
-		t.Fatalf("generate pair: %v", err)
-	}
+	primaryToken, backupToken := issuePair(t)
 	password := "RevokeTestPassword123!"
 
 	// 先完成註冊
@@ -443,7 +538,7 @@ func TestInvalidLogin(t *testing.T) {
 	t.Run("WrongPassword", func(t *testing.T) {
 		time.Sleep(2 * time.Second)
 
-		primaryToken, backupToken, _ := cardTokenGen.GeneratePair()
+		primaryToken, backupToken := issuePair(t)
 
 		regRes := doRequest(t, "POST", "/api/v1/auth/register", map[string]string{
 			"primary_token": primaryToken,
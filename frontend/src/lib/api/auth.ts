@@ -1,21 +1,53 @@
 import { get, post } from './client';
 import type { User } from '$lib/types';
+import type { PasskeyOptions, PasskeyCredentialJSON } from '$lib/webauthn';
 
 export interface CardCheckResult {
-	status: 'can_register' | 'invalid_token' | 'pair_already_registered' | 'primary' | 'backup' | 'revoked';
+	status:
+		| 'can_register'
+		| 'invalid_token'
+		| 'not_issued'
+		| 'pair_already_registered'
+		| 'primary'
+		| 'backup'
+		| 'revoked'
+		| 'tap_required';
 	user_id?: string;
 	card_type?: 'primary' | 'backup';
 	warning?: string;
 	paired_token?: string;
 }
 
+export interface LoginFailureNotice {
+	failed_attempts: number;
+	last_failed_at: string;
+}
+
 export interface AuthResponse {
 	user: User;
 	token: string;
+	refresh_token: string;
+	expires_at: string;
+	security_notice?: LoginFailureNotice;
+	deletion_cancelled?: boolean;
+}
+
+// 上次登入後卡片有密碼錯誤的嘗試時，提醒本人
+export function securityNoticeMessage(notice: LoginFailureNotice): string {
+	const last = new Date(notice.last_failed_at).toLocaleString();
+	return `自上次登入後，您的卡片有 ${notice.failed_attempts} 次密碼錯誤的登入嘗試（最後一次：${last}）。若不是您本人，請立即變更密碼。`;
+}
+
+export interface RefreshResponse {
+	token: string;
+	refresh_token: string;
+	expires_at: string;
 }
 
-export async function checkCard(token: string) {
-	return get<CardCheckResult>(`/auth/check-card/${token}`);
+// 有晶片的卡片須附上感應後取得的 tapNonce，單憑卡片網址上的 token 不足以登入
+export async function checkCard(token: string, tapNonce = '') {
+	const query = tapNonce ? `?tap=${encodeURIComponent(tapNonce)}` : '';
+	return get<CardCheckResult>(`/auth/check-card/${token}${query}`);
 }
 
 export async function register(data: {
@@ -28,21 +60,67 @@ export async function register(data: {
 	return post<AuthResponse>('/auth/register', data);
 }
 
-export async function login(cardToken: string, password: string) {
+export async function login(cardToken: string, password: string, tapNonce = '') {
 	return post<AuthResponse>('/auth/login', {
 		card_token: cardToken,
+		tap_nonce: tapNonce,
 		password,
 	});
 }
 
-export async function loginWithBackup(cardToken: string, password: string, confirm: boolean) {
+export async function loginWithBackup(cardToken: string, password: string, confirm: boolean, tapNonce = '') {
 	return post<AuthResponse>('/auth/login/backup', {
 		card_token: cardToken,
+		tap_nonce: tapNonce,
 		password,
 		confirm,
 	});
 }
 
+export interface FreezeResponse {
+	unfreeze_before: string;
+}
+
+// 只是暫時找不到主卡時，用附卡凍結帳號而不撤銷主卡
+export async function freeze(cardToken: string, password: string, tapNonce = '') {
+	return post<FreezeResponse>('/auth/freeze', {
+		card_token: cardToken,
+		tap_nonce: tapNonce,
+		password,
+	});
+}
+
+// 找回主卡後解除凍結並登入，須在期限內
+export async function unfreeze(cardToken: string, password: string, tapNonce = '') {
+	return post<AuthResponse>('/auth/unfreeze', {
+		card_token: cardToken,
+		tap_nonce: tapNonce,
+		password,
+	});
+}
+
+export async function passkeyLoginOptions() {
+	return post<PasskeyOptions>('/auth/passkey/options');
+}
+
+// 忘記帶卡時，以通行金鑰 + 密碼取代主卡登入
+export async function loginWithPasskey(challengeId: string, credential: PasskeyCredentialJSON, password: string) {
+	return post<AuthResponse>('/auth/login/passkey', {
+		challenge_id: challengeId,
+		credential,
+		password,
+	});
+}
+
+export async function refresh(refreshToken: string) {
+	return post<RefreshResponse>('/auth/refresh', { refresh_token: refreshToken });
+}
+
+// 新公鑰需由新密碼重新推導，與密碼一併更新
+export async function changePassword(data: { old_password: string; new_password: string; new_public_key: string }) {
+	return post<{ message: string }>('/auth/password', data);
+}
+
 export async function logout() {
 	return post<{ message: string }>('/auth/logout');
 }
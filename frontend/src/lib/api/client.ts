@@ -12,9 +12,31 @@ export function getAuthToken(): string | null {
 	return authToken;
 }
 
+// 收到 401 時呼叫，成功換到新的 access token 回傳 true
+type RefreshHandler = () => Promise<boolean>;
+
+let refreshHandler: RefreshHandler | null = null;
+let refreshing: Promise<boolean> | null = null;
+
+export function setRefreshHandler(handler: RefreshHandler | null): void {
+	refreshHandler = handler;
+}
+
+// 同時多個請求過期時只換一次 token
+function refreshOnce(): Promise<boolean> {
+	if (!refreshHandler) return Promise.resolve(false);
+	if (!refreshing) {
+		refreshing = refreshHandler().finally(() => {
+			refreshing = null;
+		});
+	}
+	return refreshing;
+}
+
 async function request<T>(
 	endpoint: string,
-	options: RequestInit = {}
+	options: RequestInit = {},
+	retried = false
 ): Promise<ApiResponse<T>> {
 	const headers: Record<string, string> = {
 		'Content-Type': 'application/json',
@@ -31,6 +53,12 @@ async function request<T>(
 			headers,
 		});
 
+		if (response.status === 401 && authToken && !retried && endpoint !== '/auth/refresh') {
+			if (await refreshOnce()) {
+				return request<T>(endpoint, options, true);
+			}
+		}
+
 		const json = await response.json();
 
 		if (!response.ok) {
@@ -66,6 +94,27 @@ export async function patch<T>(endpoint: string, body?: unknown): Promise<ApiRes
 	});
 }
 
-export async function del<T>(endpoint: string): Promise<ApiResponse<T>> {
-	return request<T>(endpoint, { method: 'DELETE' });
+export async function del<T>(endpoint: string, body?: unknown): Promise<ApiResponse<T>> {
+	return request<T>(endpoint, {
+		method: 'DELETE',
+		body: body ? JSON.stringify(body) : undefined,
+	});
+}
+
+// 下載檔案（例如個人資料匯出），失敗時回傳 null
+export async function download(endpoint: string): Promise<Blob | null> {
+	const headers: Record<string, string> = {};
+	if (authToken) {
+		headers['Authorization'] = `Bearer ${authToken}`;
+	}
+	try {
+		let response = await fetch(`${API_URL}/api/v1${endpoint}`, { headers });
+		if (response.status === 401 && authToken && (await refreshOnce())) {
+			headers['Authorization'] = `Bearer ${authToken}`;
+			response = await fetch(`${API_URL}/api/v1${endpoint}`, { headers });
+		}
+		return response.ok ? await response.blob() : null;
+	} catch {
+		return null;
+	}
 }
@@ -1,4 +1,4 @@
-import { get, del } from './client';
+import { get, post, del } from './client';
 import type { User, Message } from '$lib/types';
 
 export interface ConversationWithPeer {
@@ -15,14 +15,46 @@ export async function getConversations() {
 	return get<ConversationWithPeer[]>('/conversations');
 }
 
-export async function getMessages(conversationId: string, limit = 50, before?: string) {
+// before / after 為訊息 ID（before 也接受時間）；同一時間的訊息以 ID 排序，不會重複或遺漏
+export async function getMessages(conversationId: string, limit = 50, before?: string, after?: string) {
 	let url = `/conversations/${conversationId}/messages?limit=${limit}`;
 	if (before) {
 		url += `&before=${encodeURIComponent(before)}`;
 	}
+	if (after) {
+		url += `&after=${encodeURIComponent(after)}`;
+	}
 	return get<Message[]>(url);
 }
 
+export interface SyncResponse {
+	conversations: ConversationWithPeer[];
+	messages: Message[];
+	deleted: { id: string; conversation_id: string; deleted_at: string }[];
+	// 對方帳號刪除後整段對話（含所有訊息）一併移除
+	deleted_conversations: { id: string; deleted_at: string }[];
+	cursor: string;
+	has_more: boolean;
+}
+
+// 重新連線時取得上次同步後的變更；須持續呼叫直到 has_more 為 false，並保存 cursor
+export async function sync(cursor?: string, limit?: number) {
+	const params = new URLSearchParams();
+	if (cursor) params.set('cursor', cursor);
+	if (limit) params.set('limit', String(limit));
+	const query = params.toString();
+	return get<SyncResponse>(query ? `/sync?${query}` : '/sync');
+}
+
+// 離線時暫存的訊息以 REST 送出；同一個 tempId 重送只會回傳原本的訊息，不會重複寫入
+export async function sendMessage(to: string, encryptedContent: string, tempId: string) {
+	return post<{ temp_id: string; message: Message }>('/messages', {
+		to,
+		encrypted_content: encryptedContent,
+		temp_id: tempId
+	});
+}
+
 export async function deleteMessage(messageId: string) {
 	return del<{ id: string; conversation_id: string }>(`/messages/${messageId}`);
 }
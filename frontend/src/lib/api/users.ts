@@ -1,5 +1,6 @@
-import { get, patch } from './client';
-import type { User, Card } from '$lib/types';
+import { get, post, patch, del, download } from './client';
+import type { User, Card, CardEvent, Session, Passkey } from '$lib/types';
+import type { PasskeyOptions, PasskeyCredentialJSON } from '$lib/webauthn';
 
 export async function getMe() {
 	return get<User>('/users/me');
@@ -9,6 +10,61 @@ export async function getMyCards() {
 	return get<Card[]>('/users/me/cards');
 }
 
+export async function getMyCardHistory() {
+	return get<CardEvent[]>('/users/me/cards/history');
+}
+
+// 以主卡 + 密碼授權，綁定新的副卡
+export async function bindBackupCard(data: {
+	primary_token: string;
+	tap_nonce?: string;
+	password: string;
+	backup_token: string;
+}) {
+	return post<Card>('/users/me/cards/backup', data);
+}
+
+export async function getMyPasskeys() {
+	return get<Passkey[]>('/users/me/passkeys');
+}
+
+export async function passkeyOptions() {
+	return post<PasskeyOptions>('/users/me/passkeys/options');
+}
+
+// 以主卡 + 密碼授權，註冊新的通行金鑰
+export async function registerPasskey(data: {
+	primary_token: string;
+	tap_nonce?: string;
+	password: string;
+	challenge_id: string;
+	name: string;
+	credential: PasskeyCredentialJSON;
+}) {
+	return post<Passkey>('/users/me/passkeys', data);
+}
+
+export async function revokePasskey(passkeyId: string) {
+	return del<{ message: string }>(`/users/me/passkeys/${passkeyId}`);
+}
+
+export async function getMySessions() {
+	return get<Session[]>('/users/me/sessions');
+}
+
+export async function revokeSession(sessionId: string) {
+	return del<{ message: string }>(`/users/me/sessions/${sessionId}`);
+}
+
+// 以卡片 + 密碼授權申請刪除帳號，保留期間內重新登入即取消
+export async function deleteAccount(data: { card_token: string; tap_nonce?: string; password: string }) {
+	return del<{ delete_after: string }>('/users/me', data);
+}
+
+export async function exportMyData() {
+	return download('/users/me/export');
+}
+
 export async function updateMe(data: { nickname?: string; avatar_url?: string; public_key?: string }) {
 	return patch<User>('/users/me', data);
 }
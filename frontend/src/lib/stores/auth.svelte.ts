@@ -1,5 +1,6 @@
 import type { User } from '$lib/types';
-import { setAuthToken } from '$lib/api/client';
+import { setAuthToken, setRefreshHandler } from '$lib/api/client';
+import { refresh } from '$lib/api/auth';
 
 const AUTH_KEY = 'link_auth';
 
@@ -12,6 +13,26 @@ interface AuthState {
 function createAuthStore() {
 	let user = $state<User | null>(null);
 	let token = $state<string | null>(null);
+	let refreshToken: string | null = null;
+
+	function persist() {
+		localStorage.setItem(AUTH_KEY, JSON.stringify({ user, token, refreshToken }));
+	}
+
+	// access token 過期時以 refresh token 換新；refresh token 只能用一次
+	async function renew(): Promise<boolean> {
+		if (!refreshToken) return false;
+		const res = await refresh(refreshToken);
+		if (!res.data) {
+			logout();
+			return false;
+		}
+		token = res.data.token;
+		refreshToken = res.data.refresh_token;
+		setAuthToken(token);
+		persist();
+		return true;
+	}
 
 	function init() {
 		if (typeof window === 'undefined') return;
@@ -21,23 +42,28 @@ function createAuthStore() {
 				const data = JSON.parse(stored);
 				user = data.user;
 				token = data.token;
+				refreshToken = data.refreshToken ?? null;
 				setAuthToken(token);
 			} catch {
 				localStorage.removeItem(AUTH_KEY);
 			}
 		}
+		setRefreshHandler(renew);
 	}
 
-	function login(userData: User, authToken: string) {
+	function login(userData: User, authToken: string, authRefreshToken: string) {
 		user = userData;
 		token = authToken;
+		refreshToken = authRefreshToken;
 		setAuthToken(authToken);
-		localStorage.setItem(AUTH_KEY, JSON.stringify({ user: userData, token: authToken }));
+		setRefreshHandler(renew);
+		persist();
 	}
 
 	function logout() {
 		user = null;
 		token = null;
+		refreshToken = null;
 		setAuthToken(null);
 		localStorage.removeItem(AUTH_KEY);
 	}
@@ -45,7 +71,7 @@ function createAuthStore() {
 	function updateUser(userData: Partial<User>) {
 		if (user) {
 			user = { ...user, ...userData };
-			localStorage.setItem(AUTH_KEY, JSON.stringify({ user, token }));
+			persist();
 		}
 	}
 
@@ -55,6 +55,13 @@ function createConversationsStore() {
 		}
 	}
 
+	// 好友變更密碼後公鑰會改變
+	function updatePeerPublicKey(userId: string, publicKey: string): void {
+		conversations = conversations.map((c) =>
+			c.peer.id === userId ? { ...c, peer: { ...c.peer, public_key: publicKey } } : c
+		);
+	}
+
 	function addOrUpdate(item: ConversationItem): void {
 		const existing = conversations.find((c) => c.id === item.id);
 		if (existing) {
@@ -78,6 +85,7 @@ function createConversationsStore() {
 		setActive,
 		updateLastMessage,
 		incrementUnread,
+		updatePeerPublicKey,
 		addOrUpdate,
 	};
 }
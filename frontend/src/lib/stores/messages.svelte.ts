@@ -243,6 +243,18 @@ function createMessagesStore() {
 		}
 	}
 
+	// 對方收到先前離線時送出的訊息
+	function markDelivered(conversationId: string, messageId: string, deliveredAt: string): void {
+		const existing = messagesByConversation[conversationId];
+		if (existing) {
+			// Force reactivity
+			messagesByConversation = {
+				...messagesByConversation,
+				[conversationId]: existing.map((m) => (m.id === messageId ? { ...m, deliveredAt } : m))
+			};
+		}
+	}
+
 	return {
 		get messagesByConversation() {
 			return messagesByConversation;
@@ -258,6 +270,7 @@ function createMessagesStore() {
 		getMessages,
 		deleteMessage,
 		removeMessage,
+		markDelivered,
 		clear,
 	};
 }
@@ -90,6 +90,8 @@ function createTransportStore() {
 	let offlineHandler: ((userId: string) => void) | null = null;
 	let deliveredHandler: ((tempId: string, msg: EncryptedMessage) => void) | null = null;
 	let deletedHandler: ((messageId: string, conversationId: string) => void) | null = null;
+	let keyChangedHandler: ((userId: string, publicKey: string) => void) | null = null;
+	let securityHandler: ((reason: string) => void) | null = null;
 
 	function attachHandlers() {
 		if (transport) {
@@ -99,6 +101,8 @@ function createTransportStore() {
 			if (offlineHandler) transport.onOffline = offlineHandler;
 			if (deliveredHandler) transport.onDelivered = deliveredHandler;
 			if (deletedHandler) transport.onDeleted = deletedHandler;
+			if (keyChangedHandler) transport.onKeyChanged = keyChangedHandler;
+			if (securityHandler) transport.onSecurity = securityHandler;
 		}
 	}
 
@@ -146,6 +150,20 @@ function createTransportStore() {
 		}
 	}
 
+	function onKeyChanged(handler: (userId: string, publicKey: string) => void): void {
+		keyChangedHandler = handler;
+		if (transport) {
+			transport.onKeyChanged = handler;
+		}
+	}
+
+	function onSecurity(handler: (reason: string) => void): void {
+		securityHandler = handler;
+		if (transport) {
+			transport.onSecurity = handler;
+		}
+	}
+
 	async function sendMessage(to: string, encryptedContent: string, tempId: string): Promise<void> {
 		await transport?.sendMessage(to, encryptedContent, tempId);
 	}
@@ -179,6 +197,8 @@ function createTransportStore() {
 		onOffline,
 		onDelivered,
 		onDeleted,
+		onKeyChanged,
+		onSecurity,
 		sendMessage,
 		sendTyping,
 		sendRead,
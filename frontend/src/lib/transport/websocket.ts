@@ -1,4 +1,5 @@
 import type { ITransport, EncryptedMessage } from '$lib/types';
+import { getAuthToken } from '$lib/api/client';
 
 export interface WebSocketConfig {
 	url: string;
@@ -21,14 +22,18 @@ export function createWebSocketTransport(config: WebSocketConfig): ITransport {
 		onOffline: null,
 		onDelivered: null,
 		onDeleted: null,
+		onKeyChanged: null,
+		onSecurity: null,
 		onConnected: null,
 
 		async connect(): Promise<void> {
 			return new Promise((resolve, reject) => {
 				intentionalClose = false;
-				const wsUrl = `${url}?token=${token.substring(0, 20)}...`;
+				// 重連時使用 refresh 後的最新 access token
+				const current = getAuthToken() ?? token;
+				const wsUrl = `${url}?token=${current.substring(0, 20)}...`;
 				console.log('WebSocket connecting to:', wsUrl);
-				ws = new WebSocket(`${url}?token=${token}`);
+				ws = new WebSocket(`${url}?token=${current}`);
 
 				ws.onopen = () => {
 					console.log('WebSocket connection opened');
@@ -113,9 +118,15 @@ export function createWebSocketTransport(config: WebSocketConfig): ITransport {
 	function handleMessage(msg: { t: string; p: unknown }): void {
 		console.log('handleMessage called, type:', msg.t, 'onDelivered exists:', !!transport.onDelivered);
 		switch (msg.t) {
-			case 'msg':
-				transport.onMessage?.(msg.p as EncryptedMessage);
+			case 'msg': {
+				const mp = msg.p as EncryptedMessage;
+				transport.onMessage?.(mp);
+				// 回報已收到，伺服器據此標記送達並通知寄件者
+				if (ws?.readyState === WebSocket.OPEN) {
+					ws.send(JSON.stringify({ t: 'ack', p: { message_ids: [mp.id] } }));
+				}
 				break;
+			}
 			case 'typing': {
 				const tp = msg.p as { conversation_id: string; from: string };
 				transport.onTyping?.(tp.conversation_id, tp.from);
@@ -151,6 +162,18 @@ export function createWebSocketTransport(config: WebSocketConfig): ITransport {
 				transport.onDeleted?.(delp.id, delp.conversation_id);
 				break;
 			}
+			case 'key_changed': {
+				const kp = msg.p as { user_id: string; public_key: string };
+				transport.onKeyChanged?.(kp.user_id, kp.public_key);
+				break;
+			}
+			case 'security': {
+				// 連線即將被伺服器關閉，舊的 session 已失效，不再重連
+				intentionalClose = true;
+				const sp = msg.p as { reason: string };
+				transport.onSecurity?.(sp.reason);
+				break;
+			}
 		}
 	}
 
@@ -30,6 +30,8 @@ export function createWebTransportClient(config: WebTransportConfig): ITransport
 		onOffline: null,
 		onDelivered: null,
 		onDeleted: null,
+		onKeyChanged: null,
+		onSecurity: null,
 		onConnected: null,
 
 		async connect(): Promise<void> {
@@ -144,9 +146,13 @@ export function createWebTransportClient(config: WebTransportConfig): ITransport
 
 	function handleMessage(msg: { t: string; p: unknown }): void {
 		switch (msg.t) {
-			case 'msg':
-				transport.onMessage?.(msg.p as EncryptedMessage);
+			case 'msg': {
+				const mp = msg.p as EncryptedMessage;
+				transport.onMessage?.(mp);
+				// 回報已收到，伺服器據此標記送達並通知寄件者
+				send({ t: 'ack', p: { message_ids: [mp.id] } }).catch(() => {});
 				break;
+			}
 			case 'typing': {
 				const tp = msg.p as { conversation_id: string; from: string };
 				transport.onTyping?.(tp.conversation_id, tp.from);
@@ -172,6 +178,18 @@ export function createWebTransportClient(config: WebTransportConfig): ITransport
 				transport.onDeleted?.(delp.id, delp.conversation_id);
 				break;
 			}
+			case 'key_changed': {
+				const kp = msg.p as { user_id: string; public_key: string };
+				transport.onKeyChanged?.(kp.user_id, kp.public_key);
+				break;
+			}
+			case 'security': {
+				// 連線即將被伺服器關閉，舊的 session 已失效，不再重連
+				intentionalClose = true;
+				const sp = msg.p as { reason: string };
+				transport.onSecurity?.(sp.reason);
+				break;
+			}
 		}
 	}
 
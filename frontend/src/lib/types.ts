@@ -18,6 +18,43 @@ export interface Card {
 	revoked_at?: string;
 }
 
+export interface CardEvent {
+	id: string;
+	card_id?: string;
+	passkey_id?: string;
+	event:
+		| 'registered'
+		| 'revoked'
+		| 'promoted'
+		| 'backup_bound'
+		| 'passkey_registered'
+		| 'passkey_used'
+		| 'passkey_revoked'
+		| 'account_frozen'
+		| 'account_unfrozen';
+	created_at: string;
+}
+
+// 可取代主卡登入的通行金鑰（搭配密碼）
+export interface Passkey {
+	id: string;
+	name: string;
+	status: 'active' | 'revoked';
+	created_at: string;
+	last_used_at?: string;
+	revoked_at?: string;
+}
+
+export interface Session {
+	id: string;
+	ip: string;
+	user_agent: string;
+	created_at: string;
+	last_used_at: string;
+	expires_at: string;
+	current: boolean;
+}
+
 export interface Friendship {
 	id: string;
 	requester_id: string;
@@ -45,6 +82,9 @@ export interface Message {
 	sender_id: string;
 	encrypted_content: string;
 	created_at: string;
+	delivered_at?: string | null;
+	read_at?: string | null;
+	temp_id?: string;
 }
 
 export interface DecryptedMessage extends Omit<Message, 'encrypted_content'> {
@@ -88,6 +128,9 @@ export interface ITransport {
 	onOffline: ((userId: string) => void) | null;
 	onDelivered: ((tempId: string, msg: EncryptedMessage) => void) | null;
 	onDeleted: ((messageId: string, conversationId: string) => void) | null;
+	onKeyChanged: ((userId: string, publicKey: string) => void) | null;
+	// 伺服器強制斷線前的最後一個訊框，例如卡片已被撤銷
+	onSecurity: ((reason: string) => void) | null;
 	onConnected: ((connected: boolean) => void) | null;
 }
 
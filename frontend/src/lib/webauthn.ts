@@ -0,0 +1,80 @@
+// 通行金鑰 (WebAuthn) 輔助函式：伺服器以 base64url 傳遞二進位欄位，瀏覽器 API 需要 ArrayBuffer
+
+export interface PasskeyOptions {
+	challenge_id: string;
+	public_key: any;
+}
+
+// PublicKeyCredential.toJSON() 的格式
+export interface PasskeyCredentialJSON {
+	id: string;
+	type: string;
+	response: Record<string, string>;
+}
+
+function fromBase64url(value: string): ArrayBuffer {
+	const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+	const binary = atob(base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), '='));
+	const bytes = new Uint8Array(binary.length);
+	for (let i = 0; i < binary.length; i++) bytes[i] = binary.charCodeAt(i);
+	return bytes.buffer;
+}
+
+function toBase64url(buffer: ArrayBuffer | null): string {
+	if (!buffer) return '';
+	let binary = '';
+	for (const b of new Uint8Array(buffer)) binary += String.fromCharCode(b);
+	return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+export function passkeysSupported(): boolean {
+	return typeof window !== 'undefined' && !!window.PublicKeyCredential && !!navigator.credentials;
+}
+
+// 建立新的通行金鑰，使用者取消時回傳 null
+export async function createPasskey(options: PasskeyOptions): Promise<PasskeyCredentialJSON | null> {
+	const pk = options.public_key;
+	const credential = (await navigator.credentials.create({
+		publicKey: {
+			...pk,
+			challenge: fromBase64url(pk.challenge),
+			user: { ...pk.user, id: fromBase64url(pk.user.id) },
+			excludeCredentials: (pk.excludeCredentials ?? []).map((c: { type: 'public-key'; id: string }) => ({
+				type: c.type,
+				id: fromBase64url(c.id),
+			})),
+		},
+	})) as PublicKeyCredential | null;
+	if (!credential) return null;
+
+	const response = credential.response as AuthenticatorAttestationResponse;
+	return {
+		id: credential.id,
+		type: credential.type,
+		response: {
+			clientDataJSON: toBase64url(response.clientDataJSON),
+			attestationObject: toBase64url(response.attestationObject),
+		},
+	};
+}
+
+// 以通行金鑰簽署登入挑戰，使用者取消時回傳 null
+export async function getPasskey(options: PasskeyOptions): Promise<PasskeyCredentialJSON | null> {
+	const pk = options.public_key;
+	const credential = (await navigator.credentials.get({
+		publicKey: { ...pk, challenge: fromBase64url(pk.challenge) },
+	})) as PublicKeyCredential | null;
+	if (!credential) return null;
+
+	const response = credential.response as AuthenticatorAssertionResponse;
+	return {
+		id: credential.id,
+		type: credential.type,
+		response: {
+			clientDataJSON: toBase64url(response.clientDataJSON),
+			authenticatorData: toBase64url(response.authenticatorData),
+			signature: toBase64url(response.signature),
+			userHandle: toBase64url(response.userHandle),
+		},
+	};
+}